@@ -28,6 +28,8 @@ type ClusterConfigSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
+	// AzKeyVaultURL is the URL of the Azure Key Vault, required by the AzureKeyVault backend
+	// +kubebuilder:validation:Optional
 	AzKeyVaultURL string `json:"azKeyVaultURL"`
 
 	// +kubebuilder:validation:Optional
@@ -50,6 +52,107 @@ type ClusterConfigSpec struct {
 
 	// +kubebuilder:default:=true
 	AllowAzKeyVaultCertificateDeletion bool `json:"allowAzKeyVaultCertificateDeletion"`
+
+	// ClusterID identifies this cluster in the ownership tags written to every imported certificate
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=default
+	ClusterID string `json:"clusterId,omitempty"`
+
+	// AdoptionPolicy controls whether certificates not tagged as owned by this cluster may be updated or deleted.
+	// An untagged certificate named <namespace>-<name> is only taken over without it when the SyncSecretAKV shows
+	// that an earlier version of the controller synced it before the ownership tags; it is then tagged.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=Never
+	AdoptionPolicy CertificateAdoptionPolicy `json:"adoptionPolicy,omitempty"`
+
+	// CertificateTags are static tags added to every imported certificate
+	// +kubebuilder:validation:Optional
+	CertificateTags map[string]string `json:"certificateTags,omitempty"`
+
+	// CertificateTagTemplates are tags whose values are Go templates rendered against the Secret,
+	// e.g. "{{ .Namespace }}/{{ .Name }}" or "{{ index .Labels \"team\" }}"
+	// +kubebuilder:validation:Optional
+	CertificateTagTemplates map[string]string `json:"certificateTagTemplates,omitempty"`
+
+	// PropagateLabels lists the Secret label keys copied to the certificate tags
+	// +kubebuilder:validation:Optional
+	PropagateLabels []string `json:"propagateLabels,omitempty"`
+
+	// PropagateAnnotations lists the Secret annotation keys copied to the certificate tags
+	// +kubebuilder:validation:Optional
+	PropagateAnnotations []string `json:"propagateAnnotations,omitempty"`
+
+	// CertificatePolicy is applied on every import, drift is corrected on resync
+	// +kubebuilder:validation:Optional
+	CertificatePolicy *CertificatePolicySpec `json:"certificatePolicy,omitempty"`
+
+	// MinimumRSAKeySize is the smallest RSA key size accepted before uploading a certificate
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1024
+	// +kubebuilder:default:=2048
+	MinimumRSAKeySize int32 `json:"minimumRSAKeySize,omitempty"`
+
+	// AllowedDNSNames restricts the DNS names each namespace may sync. When set, a certificate is only
+	// uploaded if a policy selects its namespace and every DNS name matches that policy's patterns.
+	// +kubebuilder:validation:Optional
+	AllowedDNSNames []DNSNamePolicy `json:"allowedDNSNames,omitempty"`
+
+	// UnmatchPolicy controls what happens to a synced Secret that no longer matches the filters
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=Retain
+	UnmatchPolicy UnmatchPolicy `json:"unmatchPolicy,omitempty"`
+
+	// GarbageCollection controls the periodic removal of certificates owned by this cluster whose SyncSecretAKV no longer exists
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=ReportOnly
+	GarbageCollection GarbageCollectionMode `json:"garbageCollection,omitempty"`
+
+	// MaxDeletionsPerWindow is the number of certificates that may be deleted from the vault within
+	// DeletionWindow. Further deletions wait for the approve-deletions annotation. 0 disables the limit.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default:=10
+	MaxDeletionsPerWindow *int32 `json:"maxDeletionsPerWindow,omitempty"`
+
+	// DeletionWindow is the sliding window MaxDeletionsPerWindow applies to
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:="1h"
+	DeletionWindow *metav1.Duration `json:"deletionWindow,omitempty"`
+
+	// DeletionGracePeriod keeps the certificate of a deleted Secret for this long. A Secret re-created with the
+	// same name within the period resumes syncing without the certificate being deleted. Unset deletes right away.
+	// +kubebuilder:validation:Optional
+	DeletionGracePeriod *metav1.Duration `json:"deletionGracePeriod,omitempty"`
+
+	// CertificateDiscovery matches Secrets synced for the first time to certificates already in the vault. A matched
+	// certificate is tagged as managed and, when its content is identical, adopted without importing a new version.
+	// Only the certificates the AdoptionPolicy allows to take over are matched.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=Disabled
+	CertificateDiscovery CertificateDiscoveryMode `json:"certificateDiscovery,omitempty"`
+
+	// CertificateNameTemplate is a Go template rendering the name of the existing certificate matched by Name
+	// discovery from the Secret .Namespace, .Name, .Labels and .Annotations. Defaults to "{{ .Namespace }}-{{ .Name }}".
+	// +kubebuilder:validation:Optional
+	CertificateNameTemplate string `json:"certificateNameTemplate,omitempty"`
+
+	// DryRun computes and records in status, events and logs what would be imported, updated, deleted or
+	// purged without calling any mutating Azure Key Vault API
+	// +kubebuilder:validation:Optional
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// Backend is the certificate store the Secrets are synced to
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=AzureKeyVault
+	Backend CertificateStoreBackend `json:"backend,omitempty"`
+
+	// HashiCorpVault configures the HashiCorp Vault KV v2 store, required by the HashiCorpVault backend
+	// +kubebuilder:validation:Optional
+	HashiCorpVault *HashiCorpVaultSpec `json:"hashiCorpVault,omitempty"`
+
+	// Filesystem configures the directory the certificates are written to, required by the Filesystem backend
+	// +kubebuilder:validation:Optional
+	Filesystem *FilesystemSpec `json:"filesystem,omitempty"`
 }
 
 // ClusterConfigStatus defines the observed state of ClusterConfig
@@ -59,10 +162,38 @@ type ClusterConfigStatus struct {
 
 	ConfigStatus        string `json:"syncStatus"`
 	ConfigStatusMessage string `json:"syncStatusMessage"`
+
+	// ObservedGeneration is the generation of the ClusterConfig last processed by the controller
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions describe the latest observations of the Azure Key Vault connection
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// OrphanedCertificates is the number of certificates owned by this cluster without a SyncSecretAKV,
+	// left by the last garbage collection once it deleted what it was allowed to
+	// +optional
+	OrphanedCertificates int32 `json:"orphanedCertificates,omitempty"`
+
+	// LastGarbageCollectionTime is when the garbage collector last listed the Azure Key Vault
+	// +optional
+	LastGarbageCollectionTime *metav1.Time `json:"lastGarbageCollectionTime,omitempty"`
+
+	// DeletionBrake records the certificate deletions counted by the deletion brake, so the window and an
+	// engaged brake survive a restart of the controller
+	// +optional
+	DeletionBrake *DeletionBrakeStatus `json:"deletionBrake,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="Orphans",type=integer,JSONPath=`.status.orphanedCertificates`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 // +kubebuilder:resource:scope=Cluster
 
 // ClusterConfig is the Schema for the clusterconfigs API
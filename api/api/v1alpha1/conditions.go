@@ -0,0 +1,75 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// Condition types shared by SyncSecretAKV, Config and ClusterConfig
+const (
+	// ConditionReady is True when the resource is fully reconciled and working
+	ConditionReady = "Ready"
+	// ConditionSynced is True when the certificate was last imported into Azure Key Vault successfully.
+	// Only set on SyncSecretAKV.
+	ConditionSynced = "Synced"
+	// ConditionDegraded is True when the last reconciliation failed
+	ConditionDegraded = "Degraded"
+	// ConditionCredentialsValid is True when the Azure Key Vault credentials could list the vault.
+	// Only set on Config and ClusterConfig.
+	ConditionCredentialsValid = "CredentialsValid"
+)
+
+// Reasons used with the Ready, Synced, Degraded and CredentialsValid conditions
+const (
+	ReasonSucceeded            = "Succeeded"
+	ReasonAuthenticationFailed = "AuthenticationFailed"
+	ReasonAccessDenied         = "AccessDenied"
+	ReasonThrottled            = "Throttled"
+	ReasonVaultUnavailable     = "VaultUnavailable"
+	ReasonAzureRequestFailed   = "AzureRequestFailed"
+	ReasonRequestFailed        = "RequestFailed"
+	ReasonCertificateNotOwned  = "CertificateNotOwned"
+	ReasonCertificateRejected  = "CertificateRejected"
+	ReasonSyncFailed           = "SyncFailed"
+	ReasonSecretUnmatched      = "SecretUnmatched"
+	ReasonDeletionBrakeEngaged = "DeletionBrakeEngaged"
+	ReasonSecretDeleted        = "SecretDeleted"
+	ReasonDryRun               = "DryRun"
+	ReasonPaused               = "Paused"
+	ReasonClusterIDRequired    = "ClusterIDRequired"
+)
+
+// AnnotationUnmatched is set on a SyncSecretAKV by the UnmatchPolicy StopSyncing while its Secret does not
+// match the Config filters. The certificate is not updated until the annotation is removed.
+const AnnotationUnmatched = "syncsecretakv.io/unmatched"
+
+// AnnotationSecretDeletedAt is set on a SyncSecretAKV whose Secret was deleted while the Config has a
+// DeletionGracePeriod. The certificate is deleted once the period has passed since the RFC 3339 timestamp.
+const AnnotationSecretDeletedAt = "syncsecretakv.io/secret-deleted-at"
+
+// AnnotationApproveDeletions on a Config or ClusterConfig releases the deletion brake once MaxDeletionsPerWindow
+// was reached. Each new value allows another MaxDeletionsPerWindow deletions.
+const AnnotationApproveDeletions = "syncsecretakv.io/approve-deletions"
+
+// AnnotationPaused set to "true" on a Secret or its SyncSecretAKV stops all syncing of the Secret, including the
+// deletion of its certificate, until the annotation is removed.
+const AnnotationPaused = "syncsecretakv.io/paused"
+
+// AnnotationForceSync on a Secret or its SyncSecretAKV triggers one re-import of the certificate for each new value,
+// typically a timestamp. The value handled last is recorded in the SyncSecretAKV status lastForceSync.
+const AnnotationForceSync = "syncsecretakv.io/force-sync"
+
+// FinalizerCertificate is set on a SyncSecretAKV while the Config allows certificate deletion. It holds the deletion
+// of the SyncSecretAKV until its certificate, under the name recorded in the status, is deleted and purged.
+const FinalizerCertificate = "syncsecretakv.io/certificate"
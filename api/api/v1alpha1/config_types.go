@@ -23,11 +23,206 @@ import (
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// CertificateAdoptionPolicy describes how the controller treats an Azure Key Vault certificate
+// that already exists under the target name but is not tagged as owned by this cluster.
+// +kubebuilder:validation:Enum=Never;Unmanaged;Always
+type CertificateAdoptionPolicy string
+
+const (
+	// AdoptionPolicyNever refuses to update or delete any certificate not owned by this cluster.
+	AdoptionPolicyNever CertificateAdoptionPolicy = "Never"
+	// AdoptionPolicyUnmanaged takes over certificates that carry no managed-by tag at all.
+	AdoptionPolicyUnmanaged CertificateAdoptionPolicy = "Unmanaged"
+	// AdoptionPolicyAlways takes over any certificate, including ones owned by another cluster or secret.
+	AdoptionPolicyAlways CertificateAdoptionPolicy = "Always"
+)
+
+// UnmatchPolicy describes what happens to a synced Secret that stops matching the Config filters,
+// because its labels or annotations changed or its namespace was removed from FilterMatchingNamespace.
+// +kubebuilder:validation:Enum=Retain;StopSyncing;Delete
+type UnmatchPolicy string
+
+const (
+	// UnmatchPolicyRetain keeps the SyncSecretAKV and the Azure Key Vault certificate, which is no longer
+	// updated from the Secret but still has its policy drift repaired.
+	UnmatchPolicyRetain UnmatchPolicy = "Retain"
+	// UnmatchPolicyStopSyncing keeps the SyncSecretAKV and the Azure Key Vault certificate but stops updating them.
+	UnmatchPolicyStopSyncing UnmatchPolicy = "StopSyncing"
+	// UnmatchPolicyDelete deletes the SyncSecretAKV, and the certificate when AllowAzKeyVaultCertificateDeletion is set.
+	UnmatchPolicyDelete UnmatchPolicy = "Delete"
+)
+
+// GarbageCollectionMode describes what the garbage collector does with orphaned certificates, the certificates
+// tagged as owned by this cluster whose SyncSecretAKV no longer exists.
+// +kubebuilder:validation:Enum=Disabled;ReportOnly;Delete
+type GarbageCollectionMode string
+
+const (
+	// GarbageCollectionDisabled does not look for orphaned certificates.
+	GarbageCollectionDisabled GarbageCollectionMode = "Disabled"
+	// GarbageCollectionReportOnly counts orphaned certificates in the status without deleting them.
+	GarbageCollectionReportOnly GarbageCollectionMode = "ReportOnly"
+	// GarbageCollectionDelete deletes and purges orphaned certificates when AllowAzKeyVaultCertificateDeletion is set.
+	GarbageCollectionDelete GarbageCollectionMode = "Delete"
+)
+
+// CertificateDiscoveryMode describes how a Secret synced for the first time is matched to a certificate that already
+// exists in Azure Key Vault, such as one uploaded by scripts before the controller was installed.
+// +kubebuilder:validation:Enum=Disabled;Name;Thumbprint;NameOrThumbprint
+type CertificateDiscoveryMode string
+
+const (
+	// CertificateDiscoveryDisabled always imports the Secret under the default certificate name.
+	CertificateDiscoveryDisabled CertificateDiscoveryMode = "Disabled"
+	// CertificateDiscoveryName adopts the certificate named after CertificateNameTemplate.
+	CertificateDiscoveryName CertificateDiscoveryMode = "Name"
+	// CertificateDiscoveryThumbprint adopts the certificate with the same thumbprint as the Secret certificate.
+	CertificateDiscoveryThumbprint CertificateDiscoveryMode = "Thumbprint"
+	// CertificateDiscoveryNameOrThumbprint matches by name first, then by thumbprint.
+	CertificateDiscoveryNameOrThumbprint CertificateDiscoveryMode = "NameOrThumbprint"
+)
+
+// CertificateStoreBackend is the kind of certificate store the Secrets of a Config are synced to
+// +kubebuilder:validation:Enum=AzureKeyVault;HashiCorpVault;Filesystem
+type CertificateStoreBackend string
+
+const (
+	// CertificateStoreAzureKeyVault syncs the Secrets to the Azure Key Vault at AzKeyVaultURL.
+	CertificateStoreAzureKeyVault CertificateStoreBackend = "AzureKeyVault"
+	// CertificateStoreHashiCorpVault syncs the Secrets to the HashiCorp Vault KV v2 secrets engine set in HashiCorpVault.
+	CertificateStoreHashiCorpVault CertificateStoreBackend = "HashiCorpVault"
+	// CertificateStoreFilesystem writes the Secrets as PEM and PFX files to the directory set in Filesystem.
+	CertificateStoreFilesystem CertificateStoreBackend = "Filesystem"
+)
+
+// FilesystemSpec defines the directory, usually a mounted PersistentVolumeClaim, the certificates are written to
+type FilesystemSpec struct {
+	// Path is the absolute path of the directory in the controller container
+	// +kubebuilder:validation:Pattern=`^/`
+	Path string `json:"path"`
+
+	// PathTemplate is a Go template rendering the directory of a certificate below Path from .Name, the certificate
+	// name. Defaults to "{{ .Name }}".
+	// +kubebuilder:validation:Optional
+	PathTemplate string `json:"pathTemplate,omitempty"`
+
+	// FileMode is the octal permission of the written files
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^0?[0-7]{3}$`
+	// +kubebuilder:default:="0600"
+	FileMode string `json:"fileMode,omitempty"`
+
+	// DirectoryMode is the octal permission of the created directories
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^0?[0-7]{3}$`
+	// +kubebuilder:default:="0700"
+	DirectoryMode string `json:"directoryMode,omitempty"`
+}
+
+// HashiCorpVaultSpec defines the HashiCorp Vault KV v2 secrets engine the certificates are written to
+type HashiCorpVaultSpec struct {
+	// Address of the Vault server, for example https://vault.example.com:8200
+	Address string `json:"address"`
+
+	// Mount is the path the KV v2 secrets engine is mounted at
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=secret
+	Mount string `json:"mount,omitempty"`
+
+	// PathTemplate is a Go template rendering the path of a certificate in the mount from .Name, the certificate
+	// name. Defaults to "syncsecretakv/{{ .Name }}".
+	// +kubebuilder:validation:Optional
+	PathTemplate string `json:"pathTemplate,omitempty"`
+
+	// Role is the role of the Kubernetes auth method the controller logs in with using its service account token.
+	// When empty the controller uses the token in its VAULT_TOKEN environment variable.
+	// +kubebuilder:validation:Optional
+	Role string `json:"role,omitempty"`
+
+	// AuthMount is the path the Kubernetes auth method is mounted at
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=kubernetes
+	AuthMount string `json:"authMount,omitempty"`
+
+	// Namespace is the Vault Enterprise namespace of the mount
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// CABundle is the PEM encoded CA bundle verifying the Vault server certificate, the system roots when empty
+	// +kubebuilder:validation:Optional
+	CABundle string `json:"caBundle,omitempty"`
+}
+
+// Content types supported when importing a certificate into Azure Key Vault
+const (
+	CertificateContentTypePEM    = "application/x-pem-file"
+	CertificateContentTypePKCS12 = "application/x-pkcs12"
+)
+
+// CertificatePolicySpec defines the Azure Key Vault certificate policy and attributes
+// applied on every import. Unset fields keep the Azure Key Vault defaults.
+type CertificatePolicySpec struct {
+	// Exportable allows the private key to be exported from Azure Key Vault
+	// +kubebuilder:validation:Optional
+	Exportable *bool `json:"exportable,omitempty"`
+
+	// ReuseKey controls whether the same key pair is used on certificate renewal
+	// +kubebuilder:validation:Optional
+	ReuseKey *bool `json:"reuseKey,omitempty"`
+
+	// ContentType of the secret backing the certificate
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=application/x-pem-file;application/x-pkcs12
+	ContentType string `json:"contentType,omitempty"`
+
+	// Enabled sets whether the imported certificate is enabled
+	// +kubebuilder:validation:Optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// EmailNotifications are lifetime actions that email the vault certificate contacts before expiry
+	// +kubebuilder:validation:Optional
+	EmailNotifications []CertificateEmailNotification `json:"emailNotifications,omitempty"`
+}
+
+// CertificateEmailNotification triggers an email to the certificate contacts.
+// Exactly one of DaysBeforeExpiry or LifetimePercentage must be set.
+type CertificateEmailNotification struct {
+	// DaysBeforeExpiry sends the notification this many days before the certificate expires
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	DaysBeforeExpiry *int32 `json:"daysBeforeExpiry,omitempty"`
+
+	// LifetimePercentage sends the notification when this percentage of the certificate lifetime has elapsed
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=99
+	LifetimePercentage *int32 `json:"lifetimePercentage,omitempty"`
+}
+
+// DNSNamePolicy allows the namespaces it selects to sync certificates whose DNS names match its patterns.
+// A namespace is selected when it is listed in Namespaces or its labels match NamespaceSelector.
+type DNSNamePolicy struct {
+	// Namespaces the policy applies to
+	// +kubebuilder:validation:Optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// NamespaceSelector selects the namespaces the policy applies to by label
+	// +kubebuilder:validation:Optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// Patterns are the allowed DNS names, either exact names or wildcards such as "*.example.com"
+	// matching a single leftmost label. IP address, URI and email names are only allowed when listed exactly.
+	// +kubebuilder:validation:MinItems=1
+	Patterns []string `json:"patterns"`
+}
+
 // ConfigSpec defines the desired state of Config
 type ConfigSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
+	// AzKeyVaultURL is the URL of the Azure Key Vault, required by the AzureKeyVault backend
+	// +kubebuilder:validation:Optional
 	AzKeyVaultURL string `json:"azKeyVaultURL"`
 
 	// +kubebuilder:validation:Optional
@@ -50,6 +245,107 @@ type ConfigSpec struct {
 
 	// +kubebuilder:default:=true
 	AllowAzKeyVaultCertificateDeletion bool `json:"allowAzKeyVaultCertificateDeletion"`
+
+	// ClusterID identifies this cluster in the ownership tags written to every imported certificate
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=default
+	ClusterID string `json:"clusterId,omitempty"`
+
+	// AdoptionPolicy controls whether certificates not tagged as owned by this cluster may be updated or deleted.
+	// An untagged certificate named <namespace>-<name> is only taken over without it when the SyncSecretAKV shows
+	// that an earlier version of the controller synced it before the ownership tags; it is then tagged.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=Never
+	AdoptionPolicy CertificateAdoptionPolicy `json:"adoptionPolicy,omitempty"`
+
+	// CertificateTags are static tags added to every imported certificate
+	// +kubebuilder:validation:Optional
+	CertificateTags map[string]string `json:"certificateTags,omitempty"`
+
+	// CertificateTagTemplates are tags whose values are Go templates rendered against the Secret,
+	// e.g. "{{ .Namespace }}/{{ .Name }}" or "{{ index .Labels \"team\" }}"
+	// +kubebuilder:validation:Optional
+	CertificateTagTemplates map[string]string `json:"certificateTagTemplates,omitempty"`
+
+	// PropagateLabels lists the Secret label keys copied to the certificate tags
+	// +kubebuilder:validation:Optional
+	PropagateLabels []string `json:"propagateLabels,omitempty"`
+
+	// PropagateAnnotations lists the Secret annotation keys copied to the certificate tags
+	// +kubebuilder:validation:Optional
+	PropagateAnnotations []string `json:"propagateAnnotations,omitempty"`
+
+	// CertificatePolicy is applied on every import, drift is corrected on resync
+	// +kubebuilder:validation:Optional
+	CertificatePolicy *CertificatePolicySpec `json:"certificatePolicy,omitempty"`
+
+	// MinimumRSAKeySize is the smallest RSA key size accepted before uploading a certificate
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1024
+	// +kubebuilder:default:=2048
+	MinimumRSAKeySize int32 `json:"minimumRSAKeySize,omitempty"`
+
+	// AllowedDNSNames restricts the DNS names each namespace may sync. When set, a certificate is only
+	// uploaded if a policy selects its namespace and every DNS name matches that policy's patterns.
+	// +kubebuilder:validation:Optional
+	AllowedDNSNames []DNSNamePolicy `json:"allowedDNSNames,omitempty"`
+
+	// UnmatchPolicy controls what happens to a synced Secret that no longer matches the filters
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=Retain
+	UnmatchPolicy UnmatchPolicy `json:"unmatchPolicy,omitempty"`
+
+	// GarbageCollection controls the periodic removal of certificates owned by this cluster whose SyncSecretAKV no longer exists
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=ReportOnly
+	GarbageCollection GarbageCollectionMode `json:"garbageCollection,omitempty"`
+
+	// MaxDeletionsPerWindow is the number of certificates that may be deleted from the vault within
+	// DeletionWindow. Further deletions wait for the approve-deletions annotation. 0 disables the limit.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default:=10
+	MaxDeletionsPerWindow *int32 `json:"maxDeletionsPerWindow,omitempty"`
+
+	// DeletionWindow is the sliding window MaxDeletionsPerWindow applies to
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:="1h"
+	DeletionWindow *metav1.Duration `json:"deletionWindow,omitempty"`
+
+	// DeletionGracePeriod keeps the certificate of a deleted Secret for this long. A Secret re-created with the
+	// same name within the period resumes syncing without the certificate being deleted. Unset deletes right away.
+	// +kubebuilder:validation:Optional
+	DeletionGracePeriod *metav1.Duration `json:"deletionGracePeriod,omitempty"`
+
+	// CertificateDiscovery matches Secrets synced for the first time to certificates already in the vault. A matched
+	// certificate is tagged as managed and, when its content is identical, adopted without importing a new version.
+	// Only the certificates the AdoptionPolicy allows to take over are matched.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=Disabled
+	CertificateDiscovery CertificateDiscoveryMode `json:"certificateDiscovery,omitempty"`
+
+	// CertificateNameTemplate is a Go template rendering the name of the existing certificate matched by Name
+	// discovery from the Secret .Namespace, .Name, .Labels and .Annotations. Defaults to "{{ .Namespace }}-{{ .Name }}".
+	// +kubebuilder:validation:Optional
+	CertificateNameTemplate string `json:"certificateNameTemplate,omitempty"`
+
+	// DryRun computes and records in status, events and logs what would be imported, updated, deleted or
+	// purged without calling any mutating Azure Key Vault API
+	// +kubebuilder:validation:Optional
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// Backend is the certificate store the Secrets are synced to
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=AzureKeyVault
+	Backend CertificateStoreBackend `json:"backend,omitempty"`
+
+	// HashiCorpVault configures the HashiCorp Vault KV v2 store, required by the HashiCorpVault backend
+	// +kubebuilder:validation:Optional
+	HashiCorpVault *HashiCorpVaultSpec `json:"hashiCorpVault,omitempty"`
+
+	// Filesystem configures the directory the certificates are written to, required by the Filesystem backend
+	// +kubebuilder:validation:Optional
+	Filesystem *FilesystemSpec `json:"filesystem,omitempty"`
 }
 
 // ConfigStatus defines the observed state of Config
@@ -59,10 +355,53 @@ type ConfigStatus struct {
 
 	ConfigStatus        string `json:"syncStatus"`
 	ConfigStatusMessage string `json:"syncStatusMessage"`
+
+	// ObservedGeneration is the generation of the Config last processed by the controller
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions describe the latest observations of the Azure Key Vault connection
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// OrphanedCertificates is the number of certificates owned by this cluster without a SyncSecretAKV,
+	// left by the last garbage collection once it deleted what it was allowed to
+	// +optional
+	OrphanedCertificates int32 `json:"orphanedCertificates,omitempty"`
+
+	// LastGarbageCollectionTime is when the garbage collector last listed the Azure Key Vault
+	// +optional
+	LastGarbageCollectionTime *metav1.Time `json:"lastGarbageCollectionTime,omitempty"`
+
+	// DeletionBrake records the certificate deletions counted by the deletion brake, so the window and an
+	// engaged brake survive a restart of the controller
+	// +optional
+	DeletionBrake *DeletionBrakeStatus `json:"deletionBrake,omitempty"`
+}
+
+// DeletionBrakeStatus is the state of the deletion brake of the vault of a Config
+type DeletionBrakeStatus struct {
+	// Deletions are the times of the certificate deletions within the DeletionWindow
+	// +optional
+	Deletions []metav1.Time `json:"deletions,omitempty"`
+
+	// Approval is the value of the approve-deletions annotation that last released the brake
+	// +optional
+	Approval string `json:"approval,omitempty"`
+
+	// Engaged is true while deletions wait for a new approval
+	// +optional
+	Engaged bool `json:"engaged,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="Orphans",type=integer,JSONPath=`.status.orphanedCertificates`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Config is the Schema for the configs API
 type Config struct {
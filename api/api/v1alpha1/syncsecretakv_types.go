@@ -23,6 +23,42 @@ import (
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// ConditionCertificateValid reports whether the certificate in the Secret passed validation before upload
+const ConditionCertificateValid = "CertificateValid"
+
+// Reasons used with the CertificateValid condition
+const (
+	ReasonCertificateValid       = "Valid"
+	ReasonMalformedCertificate   = "MalformedCertificate"
+	ReasonMalformedPrivateKey    = "MalformedPrivateKey"
+	ReasonKeyMismatch            = "KeyMismatch"
+	ReasonCertificateNotYetValid = "NotYetValid"
+	ReasonCertificateExpired     = "Expired"
+	ReasonIncompleteChain        = "IncompleteChain"
+	ReasonKeyTooSmall            = "KeyTooSmall"
+)
+
+// ConditionDNSNamesAllowed reports whether the certificate DNS names are allowed for the Secret namespace
+const ConditionDNSNamesAllowed = "DNSNamesAllowed"
+
+// Reasons used with the DNSNamesAllowed condition
+const (
+	ReasonDNSNamesAllowed     = "Allowed"
+	ReasonNamespaceNotAllowed = "NamespaceNotAllowed"
+	ReasonDNSNameNotAllowed   = "DNSNameNotAllowed"
+)
+
+// FailureClass classifies a failed synchronization
+// +kubebuilder:validation:Enum=Transient;Terminal
+type FailureClass string
+
+const (
+	// FailureClassTransient failures such as throttling, 5xx responses and network errors are retried with backoff
+	FailureClassTransient FailureClass = "Transient"
+	// FailureClassTerminal failures such as an invalid certificate or missing permissions are not retried
+	FailureClassTerminal FailureClass = "Terminal"
+)
+
 // SyncSecretAKVSpec defines the desired state of SyncSecretAKV
 type SyncSecretAKVSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -42,10 +78,84 @@ type SyncSecretAKVStatus struct {
 	// Important: Run "make" to regenerate code after modifying this file
 	SyncStatus        string `json:"syncStatus"`
 	SyncStatusMessage string `json:"syncStatusMessage"`
+
+	// VaultURL is the Azure Key Vault the certificate was last imported into
+	// +optional
+	VaultURL string `json:"vaultURL,omitempty"`
+
+	// CertificateName is the name of the Azure Key Vault certificate the Secret is synced to. It differs from
+	// <namespace>-<name> when discovery adopted an existing certificate under another name.
+	// +optional
+	CertificateName string `json:"certificateName,omitempty"`
+
+	// CertificateID is the Azure Key Vault identifier of the imported certificate version
+	// +optional
+	CertificateID string `json:"certificateId,omitempty"`
+
+	// CertificateVersion is the Azure Key Vault version of the imported certificate
+	// +optional
+	CertificateVersion string `json:"certificateVersion,omitempty"`
+
+	// Thumbprint is the base64url encoded SHA-1 thumbprint (x5t) of the imported certificate
+	// +optional
+	Thumbprint string `json:"thumbprint,omitempty"`
+
+	// Subject is the distinguished name of the imported certificate
+	// +optional
+	Subject string `json:"subject,omitempty"`
+
+	// DNSNames are the DNS subject alternative names of the imported certificate
+	// +optional
+	DNSNames []string `json:"dnsNames,omitempty"`
+
+	// NotBefore is the start of the validity period of the imported certificate
+	// +optional
+	NotBefore *metav1.Time `json:"notBefore,omitempty"`
+
+	// NotAfter is the expiry of the imported certificate
+	// +optional
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+
+	// LastSyncTime is the time of the last successful import
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+
+	// LastAttemptTime is the time of the last import attempt, successful or not
+	// +optional
+	LastAttemptTime *metav1.Time `json:"lastAttemptTime,omitempty"`
+
+	// AttemptCount is the number of consecutive failed import attempts, reset on a successful import
+	// +optional
+	AttemptCount int32 `json:"attemptCount,omitempty"`
+
+	// FailureClass classifies the last failure: Transient failures are retried with exponential backoff,
+	// Terminal failures wait for the Secret or Config to change. Empty after a successful sync.
+	// +optional
+	FailureClass FailureClass `json:"failureClass,omitempty"`
+
+	// LastForceSync is the value of the syncsecretakv.io/force-sync annotation handled by the last re-import
+	// +optional
+	LastForceSync string `json:"lastForceSync,omitempty"`
+
+	// ObservedGeneration is the generation of the SyncSecretAKV last processed by the controller
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions describe the latest observations of the certificate synchronization
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Vault",type=string,JSONPath=`.status.vaultURL`
+// +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.status.certificateVersion`
+// +kubebuilder:printcolumn:name="Expiry",type=string,JSONPath=`.status.notAfter`
+// +kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.syncStatus`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // SyncSecretAKV is the Schema for the syncsecretakvs API
 type SyncSecretAKV struct {
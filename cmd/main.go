@@ -20,15 +20,20 @@ import (
 	"crypto/tls"
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
@@ -38,6 +43,8 @@ import (
 	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
 	apicontroller "github.com/welasco/syncsecretakv/internal/controller/api"
 	corecontroller "github.com/welasco/syncsecretakv/internal/controller/core"
+	"github.com/welasco/syncsecretakv/internal/events"
+	"github.com/welasco/syncsecretakv/internal/ratelimit"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -60,6 +67,18 @@ func main() {
 	var secureMetrics bool
 	var enableHTTP2 bool
 	var tlsOpts []func(*tls.Config)
+	var keyVaultQPS float64
+	var keyVaultBurst int
+	var secretMaxConcurrentReconciles int
+	var syncSecretAKVMaxConcurrentReconciles int
+	var configMaxConcurrentReconciles int
+	var keyVaultTimeout time.Duration
+	var keyVaultOperationTimeouts string
+	var keyVaultDrainTimeout time.Duration
+	var secretLabelSelector string
+	var garbageCollectionInterval time.Duration
+	var syncStateMetricsInterval time.Duration
+	var dryRun bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
@@ -70,6 +89,33 @@ func main() {
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.Float64Var(&keyVaultQPS, "keyvault-qps", ratelimit.DefaultQPS,
+		"Maximum number of requests per second sent to each Azure Key Vault, shared by all controllers.")
+	flag.IntVar(&keyVaultBurst, "keyvault-burst", ratelimit.DefaultBurst,
+		"Maximum burst of requests sent to each Azure Key Vault.")
+	flag.IntVar(&secretMaxConcurrentReconciles, "secret-max-concurrent-reconciles", 1,
+		"Maximum number of Secrets reconciled in parallel.")
+	flag.IntVar(&syncSecretAKVMaxConcurrentReconciles, "syncsecretakv-max-concurrent-reconciles", 1,
+		"Maximum number of SyncSecretAKVs reconciled in parallel.")
+	flag.IntVar(&configMaxConcurrentReconciles, "config-max-concurrent-reconciles", 1,
+		"Maximum number of Configs and ClusterConfigs reconciled in parallel.")
+	flag.DurationVar(&keyVaultTimeout, "keyvault-timeout", apicontroller.DefaultOperationTimeout,
+		"Timeout of each Azure Key Vault call.")
+	flag.StringVar(&keyVaultOperationTimeouts, "keyvault-operation-timeouts", "",
+		"Comma separated Operation=duration pairs overriding --keyvault-timeout for individual Azure Key Vault "+
+			"operations, for example ImportCertificate=1m,ListCertificates=2m.")
+	flag.DurationVar(&keyVaultDrainTimeout, "keyvault-drain-timeout", apicontroller.DefaultDrainTimeout,
+		"How long Azure Key Vault calls in flight may complete once the manager is stopping.")
+	flag.StringVar(&secretLabelSelector, "secret-label-selector", "",
+		"Only sync the kubernetes.io/tls Secrets matching this label selector, for example "+
+			"syncsecretakv.io/sync=true. All kubernetes.io/tls Secrets are synced when empty.")
+	flag.DurationVar(&garbageCollectionInterval, "garbage-collection-interval", apicontroller.DefaultGarbageCollectionInterval,
+		"How often the Azure Key Vault is checked for orphaned certificates.")
+	flag.DurationVar(&syncStateMetricsInterval, "sync-state-metrics-interval", apicontroller.DefaultSyncStateMetricsInterval,
+		"How often the SyncSecretAKVs are recounted by sync state for the syncsecretakv_secrets metric.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Record what would be imported, updated, deleted or purged in Azure Key Vault without changing it, "+
+			"for every Config and ClusterConfig.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -77,6 +123,31 @@ func main() {
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	ratelimit.Vaults.Configure(keyVaultQPS, keyVaultBurst)
+
+	operationTimeouts, err := apicontroller.ParseOperationTimeouts(keyVaultOperationTimeouts)
+	if err != nil {
+		setupLog.Error(err, "invalid --keyvault-operation-timeouts")
+		os.Exit(1)
+	}
+	apicontroller.KeyVaultTimeouts = apicontroller.OperationTimeouts{
+		Default:    keyVaultTimeout,
+		Operations: operationTimeouts,
+		Drain:      keyVaultDrainTimeout,
+	}
+	apicontroller.DryRun = dryRun
+	// Only kubernetes.io/tls Secrets are cached, optionally narrowed down by the label selector
+	var secretSelector labels.Selector
+	if secretLabelSelector != "" {
+		secretSelector, err = labels.Parse(secretLabelSelector)
+		if err != nil {
+			setupLog.Error(err, "invalid --secret-label-selector")
+			os.Exit(1)
+		}
+	}
+
+	// Leave the reconcilers time to drain the Azure Key Vault calls in flight before the manager returns
+	gracefulShutdownTimeout := keyVaultDrainTimeout + 10*time.Second
 
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
@@ -122,12 +193,18 @@ func main() {
 	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		Metrics:                metricsServerOptions,
-		WebhookServer:          webhookServer,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "104ae454.syncsecretakv.io",
+		Scheme:                  scheme,
+		Metrics:                 metricsServerOptions,
+		WebhookServer:           webhookServer,
+		HealthProbeBindAddress:  probeAddr,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        "104ae454.syncsecretakv.io",
+		GracefulShutdownTimeout: &gracefulShutdownTimeout,
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				&corev1.Secret{}: corecontroller.SecretCacheOptions(),
+			},
+		},
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -146,33 +223,57 @@ func main() {
 	}
 
 	if err = (&corecontroller.SecretReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                events.NewDeduplicatingRecorder(mgr.GetEventRecorderFor("secret-controller"), events.DefaultDeduplicationWindow),
+		MaxConcurrentReconciles: secretMaxConcurrentReconciles,
+		LabelSelector:           secretSelector,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Secret")
 		os.Exit(1)
 	}
 	if err = (&apicontroller.SyncSecretAKVReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                events.NewDeduplicatingRecorder(mgr.GetEventRecorderFor("syncsecretakv-controller"), events.DefaultDeduplicationWindow),
+		MaxConcurrentReconciles: syncSecretAKVMaxConcurrentReconciles,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SyncSecretAKV")
 		os.Exit(1)
 	}
 	if err = (&apicontroller.ConfigReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                events.NewDeduplicatingRecorder(mgr.GetEventRecorderFor("config-controller"), events.DefaultDeduplicationWindow),
+		MaxConcurrentReconciles: configMaxConcurrentReconciles,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Config")
 		os.Exit(1)
 	}
 	if err = (&apicontroller.ClusterConfigReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                events.NewDeduplicatingRecorder(mgr.GetEventRecorderFor("clusterconfig-controller"), events.DefaultDeduplicationWindow),
+		MaxConcurrentReconciles: configMaxConcurrentReconciles,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterConfig")
 		os.Exit(1)
 	}
+	if err = mgr.Add(&apicontroller.GarbageCollector{
+		Client:   mgr.GetClient(),
+		Recorder: events.NewDeduplicatingRecorder(mgr.GetEventRecorderFor("garbage-collector"), events.DefaultDeduplicationWindow),
+		Interval: garbageCollectionInterval,
+	}); err != nil {
+		setupLog.Error(err, "unable to add garbage collector")
+		os.Exit(1)
+	}
+	if err = mgr.Add(&apicontroller.SyncStateMetrics{
+		Reader:   mgr.GetClient(),
+		Interval: syncStateMetricsInterval,
+	}); err != nil {
+		setupLog.Error(err, "unable to add sync state metrics")
+		os.Exit(1)
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -0,0 +1,100 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azurekeyvault
+
+import (
+	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azcertificates"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+)
+
+// BuildCertificatePolicy converts the Config certificate policy into an Azure Key Vault certificate policy
+func BuildCertificatePolicy(spec *apiv1alpha1.CertificatePolicySpec) *azcertificates.CertificatePolicy {
+	if spec == nil {
+		return nil
+	}
+
+	contentType := certstore.ContentType(spec)
+	policy := &azcertificates.CertificatePolicy{
+		SecretProperties: &azcertificates.SecretProperties{
+			ContentType: &contentType,
+		},
+	}
+
+	if spec.Exportable != nil || spec.ReuseKey != nil {
+		policy.KeyProperties = &azcertificates.KeyProperties{
+			Exportable: spec.Exportable,
+			ReuseKey:   spec.ReuseKey,
+		}
+	}
+
+	for _, notification := range spec.EmailNotifications {
+		action := azcertificates.CertificatePolicyActionEmailContacts
+		policy.LifetimeActions = append(policy.LifetimeActions, &azcertificates.LifetimeAction{
+			Action: &azcertificates.Action{ActionType: &action},
+			Trigger: &azcertificates.Trigger{
+				DaysBeforeExpiry:   notification.DaysBeforeExpiry,
+				LifetimePercentage: notification.LifetimePercentage,
+			},
+		})
+	}
+
+	return policy
+}
+
+// BuildCertificateAttributes converts the Config certificate policy into Azure Key Vault certificate attributes
+func BuildCertificateAttributes(spec *apiv1alpha1.CertificatePolicySpec) *azcertificates.CertificateAttributes {
+	if spec == nil || spec.Enabled == nil {
+		return nil
+	}
+	return &azcertificates.CertificateAttributes{Enabled: spec.Enabled}
+}
+
+// PolicySpec converts the policy and attributes of an Azure Key Vault certificate back into a Config certificate
+// policy, so it can be compared with the Config. Lifetime actions other than emailing the contacts are reported
+// as notifications without a trigger, which never match the Config.
+func PolicySpec(policy *azcertificates.CertificatePolicy, attributes *azcertificates.CertificateAttributes) *apiv1alpha1.CertificatePolicySpec {
+	if policy == nil && attributes == nil {
+		return nil
+	}
+
+	spec := &apiv1alpha1.CertificatePolicySpec{}
+	if attributes != nil {
+		spec.Enabled = attributes.Enabled
+	}
+	if policy == nil {
+		return spec
+	}
+	if policy.SecretProperties != nil && policy.SecretProperties.ContentType != nil {
+		spec.ContentType = *policy.SecretProperties.ContentType
+	}
+	if policy.KeyProperties != nil {
+		spec.Exportable = policy.KeyProperties.Exportable
+		spec.ReuseKey = policy.KeyProperties.ReuseKey
+	}
+	for _, action := range policy.LifetimeActions {
+		notification := apiv1alpha1.CertificateEmailNotification{}
+		if action != nil && action.Action != nil && action.Action.ActionType != nil && action.Trigger != nil &&
+			*action.Action.ActionType == azcertificates.CertificatePolicyActionEmailContacts {
+			notification.DaysBeforeExpiry = action.Trigger.DaysBeforeExpiry
+			notification.LifetimePercentage = action.Trigger.LifetimePercentage
+		}
+		spec.EmailNotifications = append(spec.EmailNotifications, notification)
+	}
+	return spec
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azurekeyvault
+
+import (
+	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azcertificates"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+var _ = Describe("Certificate policy", func() {
+	spec := &apiv1alpha1.CertificatePolicySpec{
+		Exportable: ptr.To(true),
+		ReuseKey:   ptr.To(false),
+		Enabled:    ptr.To(true),
+		EmailNotifications: []apiv1alpha1.CertificateEmailNotification{
+			{DaysBeforeExpiry: ptr.To(int32(30))},
+		},
+	}
+
+	It("should build the Azure Key Vault policy from the Config", func() {
+		policy := BuildCertificatePolicy(spec)
+		Expect(*policy.SecretProperties.ContentType).To(Equal(apiv1alpha1.CertificateContentTypePEM))
+		Expect(*policy.KeyProperties.Exportable).To(BeTrue())
+		Expect(*policy.KeyProperties.ReuseKey).To(BeFalse())
+		Expect(policy.LifetimeActions).To(HaveLen(1))
+		Expect(*policy.LifetimeActions[0].Action.ActionType).To(Equal(azcertificates.CertificatePolicyActionEmailContacts))
+		Expect(*policy.LifetimeActions[0].Trigger.DaysBeforeExpiry).To(Equal(int32(30)))
+
+		Expect(*BuildCertificateAttributes(spec).Enabled).To(BeTrue())
+		Expect(BuildCertificatePolicy(nil)).To(BeNil())
+		Expect(BuildCertificateAttributes(nil)).To(BeNil())
+	})
+
+	It("should convert the Azure Key Vault policy back into the Config policy", func() {
+		current := PolicySpec(BuildCertificatePolicy(spec), BuildCertificateAttributes(spec))
+		Expect(current.ContentType).To(Equal(apiv1alpha1.CertificateContentTypePEM))
+		Expect(current.Exportable).To(Equal(spec.Exportable))
+		Expect(current.ReuseKey).To(Equal(spec.ReuseKey))
+		Expect(current.Enabled).To(Equal(spec.Enabled))
+		Expect(current.EmailNotifications).To(Equal(spec.EmailNotifications))
+
+		Expect(PolicySpec(nil, nil)).To(BeNil())
+	})
+
+	It("should report lifetime actions other than emailing the contacts without a trigger", func() {
+		action := azcertificates.CertificatePolicyActionAutoRenew
+		policy := &azcertificates.CertificatePolicy{
+			LifetimeActions: []*azcertificates.LifetimeAction{{
+				Action:  &azcertificates.Action{ActionType: &action},
+				Trigger: &azcertificates.Trigger{DaysBeforeExpiry: ptr.To(int32(30))},
+			}},
+		}
+		Expect(PolicySpec(policy, nil).EmailNotifications).To(Equal([]apiv1alpha1.CertificateEmailNotification{{}}))
+	})
+})
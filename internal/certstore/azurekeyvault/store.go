@@ -0,0 +1,331 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package azurekeyvault implements the certstore.Store of an Azure Key Vault
+package azurekeyvault
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azcertificates"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+	"github.com/welasco/syncsecretakv/internal/ratelimit"
+)
+
+// deletedCertificatePollInterval is how often a deleted certificate is checked until the deletion completed
+const deletedCertificatePollInterval = 2 * time.Second
+
+// Store is the certstore.Store of an Azure Key Vault
+type Store struct {
+	client *azcertificates.Client
+}
+
+var (
+	_ certstore.PolicyStore  = &Store{}
+	_ certstore.DeletedStore = &Store{}
+)
+
+// cachedStore is a Store with the authentication settings of the Config it was created for
+type cachedStore struct {
+	settings string
+	store    *Store
+}
+
+var (
+	storesMu sync.Mutex
+	// stores holds the Stores by vault URL, Stores are opened on every reconcile and reusing them keeps the
+	// tokens cached by the credential and the connections of the client
+	stores = map[string]cachedStore{}
+)
+
+// New returns the Store of the Azure Key Vault of the Config. It authenticates with the client secret when the
+// Config sets one, with the managed identity of the client ID otherwise, and falls back to the default Azure credential.
+// The Store is reused until the Config changes the authentication settings of the vault.
+func New(config *apiv1alpha1.Config) (*Store, error) {
+	if config.Spec.AzKeyVaultURL == "" {
+		return nil, errors.New("azKeyVaultURL is required by the AzureKeyVault backend")
+	}
+
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	settings := credentialSettings(config)
+	if cached, ok := stores[config.Spec.AzKeyVaultURL]; ok && cached.settings == settings {
+		return cached.store, nil
+	}
+	credential, err := newCredential(config)
+	if err != nil {
+		return nil, err
+	}
+	store, err := NewWithCredential(config.Spec.AzKeyVaultURL, credential)
+	if err != nil {
+		return nil, err
+	}
+	stores[config.Spec.AzKeyVaultURL] = cachedStore{settings: settings, store: store}
+	return store, nil
+}
+
+// credentialSettings identifies the credential newCredential returns for the Config, without keeping the client secret
+func credentialSettings(config *apiv1alpha1.Config) string {
+	secret := sha256.Sum256([]byte(config.Spec.AzKeyVaultClientSecret))
+	return strings.Join([]string{config.Spec.AzKeyVaultTenantID, config.Spec.AzKeyVaultClientID, hex.EncodeToString(secret[:])}, "|")
+}
+
+// NewWithCredential returns the Store of the Azure Key Vault at vaultURL authenticating with credential
+func NewWithCredential(vaultURL string, credential azcore.TokenCredential) (*Store, error) {
+	return NewWithClientOptions(vaultURL, credential, nil)
+}
+
+// NewWithClientOptions returns the Store of the Azure Key Vault at vaultURL with the client options, which the
+// tests use to connect to the fake Key Vault
+func NewWithClientOptions(vaultURL string, credential azcore.TokenCredential, options *azcertificates.ClientOptions) (*Store, error) {
+	clientOptions := &azcertificates.ClientOptions{}
+	if options != nil {
+		*clientOptions = *options
+	}
+	// Every client of the vault shares its rate limiter, so all reconcilers stay within the same budget
+	clientOptions.PerRetryPolicies = append(append([]policy.Policy{}, clientOptions.PerRetryPolicies...), ratelimit.Policy(ratelimit.Vaults.For(vaultURL)))
+	client, err := azcertificates.NewClient(vaultURL, credential, clientOptions)
+	if err != nil {
+		log.Log.Error(err, "AzureKeyVaultStore - Failed to create a client connection to Azure Key Vault")
+		return nil, err
+	}
+	return &Store{client: client}, nil
+}
+
+func newCredential(config *apiv1alpha1.Config) (azcore.TokenCredential, error) {
+	if config.Spec.AzKeyVaultClientSecret != "" && config.Spec.AzKeyVaultClientID != "" && config.Spec.AzKeyVaultTenantID != "" {
+		log.Log.Info("AzureKeyVaultStore - Using Client Secret for Azure Key Vault Authentication with TenantID: " + config.Spec.AzKeyVaultTenantID + ", ClientID: " + config.Spec.AzKeyVaultClientID)
+		credential, err := azidentity.NewClientSecretCredential(config.Spec.AzKeyVaultTenantID, config.Spec.AzKeyVaultClientID, config.Spec.AzKeyVaultClientSecret, nil)
+		if err != nil {
+			log.Log.Error(err, "AzureKeyVaultStore - Failed to obtain a NewClientSecretCredential")
+		}
+		return credential, err
+	}
+
+	if config.Spec.AzKeyVaultClientID != "" {
+		log.Log.Info("AzureKeyVaultStore - Using Managed Identity for Azure Key Vault Authentication with ClientID: " + config.Spec.AzKeyVaultClientID)
+		clientID := azidentity.ClientID(config.Spec.AzKeyVaultClientID)
+		credential, err := azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{ID: &clientID})
+		if err != nil {
+			log.Log.Error(err, "AzureKeyVaultStore - Failed to obtain a NewManagedIdentityCredential")
+		}
+		return credential, err
+	}
+
+	log.Log.Info("AzureKeyVaultStore - Using Default Azure Credential for Azure Key Vault Authentication")
+	credential, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		log.Log.Error(err, "AzureKeyVaultStore - Failed to obtain a NewDefaultAzureCredential")
+	}
+	return credential, err
+}
+
+// Import imports the certificate as a new version, PEM encoded with a PKCS#8 key or as a PKCS#12 archive
+// depending on the content type of the policy
+func (s *Store) Import(ctx context.Context, name string, request certstore.ImportRequest) (*certstore.Certificate, error) {
+	var certificate string
+	if certstore.ContentType(request.Policy) == apiv1alpha1.CertificateContentTypePKCS12 {
+		pfx, err := certstore.EncodePKCS12(request.CertificatePEM, request.PrivateKeyPEM)
+		if err != nil {
+			log.Log.Error(err, "AzureKeyVaultStore - Failed to encode certificate as PKCS#12")
+			return nil, err
+		}
+		certificate = base64.StdEncoding.EncodeToString(pfx)
+	} else {
+		key, err := certstore.PKCS8PEM(request.PrivateKeyPEM)
+		if err != nil {
+			log.Log.Error(err, "AzureKeyVaultStore - Error converting the private key to PKCS#8")
+			return nil, err
+		}
+		certificate = string(request.CertificatePEM) + "\n" + string(key)
+	}
+
+	parameters := azcertificates.ImportCertificateParameters{
+		Base64EncodedCertificate: &certificate,
+		CertificatePolicy:        BuildCertificatePolicy(request.Policy),
+		CertificateAttributes:    BuildCertificateAttributes(request.Policy),
+		Tags:                     toAzureTags(request.Tags),
+	}
+	response, err := s.client.ImportCertificate(ctx, name, parameters, nil)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return toCertificate(name, response.CertificateBundle), nil
+}
+
+// Get returns the current version of the certificate with its policy and attributes
+func (s *Store) Get(ctx context.Context, name string) (*certstore.Certificate, error) {
+	response, err := s.client.GetCertificate(ctx, name, "", nil)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return toCertificate(name, response.CertificateBundle), nil
+}
+
+// Delete deletes the certificate and waits until Azure Key Vault completed the deletion, purging earlier fails
+// with a conflict
+func (s *Store) Delete(ctx context.Context, name string) error {
+	if _, err := s.client.DeleteCertificate(ctx, name, nil); err != nil {
+		return wrapError(err)
+	}
+	return wait.PollUntilContextCancel(ctx, deletedCertificatePollInterval, true, func(ctx context.Context) (bool, error) {
+		_, err := s.client.GetDeletedCertificate(ctx, name, nil)
+		if isNotFound(err) {
+			return false, nil
+		}
+		return err == nil, wrapError(err)
+	})
+}
+
+// Purge permanently removes the deleted certificate
+func (s *Store) Purge(ctx context.Context, name string) error {
+	_, err := s.client.PurgeDeletedCertificate(ctx, name, nil)
+	return wrapError(err)
+}
+
+// GetDeleted returns the deleted certificate, which can be recovered or purged
+func (s *Store) GetDeleted(ctx context.Context, name string) (*certstore.Certificate, error) {
+	response, err := s.client.GetDeletedCertificate(ctx, name, nil)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	certificate := &certstore.Certificate{
+		Name:       name,
+		Thumbprint: response.X509Thumbprint,
+		Tags:       fromAzureTags(response.Tags),
+	}
+	if response.ID != nil {
+		certificate.ID = string(*response.ID)
+		certificate.Version = response.ID.Version()
+	}
+	return certificate, nil
+}
+
+// List returns every certificate of the vault, without policies
+func (s *Store) List(ctx context.Context) ([]*certstore.Certificate, error) {
+	certificates := []*certstore.Certificate{}
+	pager := s.client.NewListCertificatesPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		for _, item := range page.Value {
+			if item == nil || item.ID == nil {
+				continue
+			}
+			certificates = append(certificates, &certstore.Certificate{
+				Name:       item.ID.Name(),
+				ID:         string(*item.ID),
+				Thumbprint: item.X509Thumbprint,
+				Tags:       fromAzureTags(item.Tags),
+			})
+		}
+	}
+	return certificates, nil
+}
+
+// SetTags replaces the tags of the certificate
+func (s *Store) SetTags(ctx context.Context, name string, tags map[string]string) (*certstore.Certificate, error) {
+	response, err := s.client.UpdateCertificate(ctx, name, "", azcertificates.UpdateCertificateParameters{Tags: toAzureTags(tags)}, nil)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return toCertificate(name, response.CertificateBundle), nil
+}
+
+// UpdatePolicy applies the policy of the Config to the certificate
+func (s *Store) UpdatePolicy(ctx context.Context, name string, spec *apiv1alpha1.CertificatePolicySpec) error {
+	policy := BuildCertificatePolicy(spec)
+	if policy == nil {
+		return nil
+	}
+	_, err := s.client.UpdateCertificatePolicy(ctx, name, *policy, nil)
+	return wrapError(err)
+}
+
+// UpdateAttributes applies the attributes of the Config policy to the certificate
+func (s *Store) UpdateAttributes(ctx context.Context, name string, spec *apiv1alpha1.CertificatePolicySpec) error {
+	parameters := azcertificates.UpdateCertificateParameters{CertificateAttributes: BuildCertificateAttributes(spec)}
+	_, err := s.client.UpdateCertificate(ctx, name, "", parameters, nil)
+	return wrapError(err)
+}
+
+func toCertificate(name string, bundle azcertificates.CertificateBundle) *certstore.Certificate {
+	certificate := &certstore.Certificate{
+		Name:       name,
+		Thumbprint: bundle.X509Thumbprint,
+		Tags:       fromAzureTags(bundle.Tags),
+		Policy:     PolicySpec(bundle.Policy, bundle.Attributes),
+	}
+	if bundle.ID != nil {
+		certificate.ID = string(*bundle.ID)
+		certificate.Version = bundle.ID.Version()
+	}
+	return certificate
+}
+
+func toAzureTags(tags map[string]string) map[string]*string {
+	if tags == nil {
+		return nil
+	}
+	azureTags := make(map[string]*string, len(tags))
+	for key, value := range tags {
+		value := value
+		azureTags[key] = &value
+	}
+	return azureTags
+}
+
+func fromAzureTags(azureTags map[string]*string) map[string]string {
+	tags := make(map[string]string, len(azureTags))
+	for key, value := range azureTags {
+		if value != nil {
+			tags[key] = *value
+		}
+	}
+	return tags
+}
+
+// isNotFound reports whether err is a 404 returned by Azure Key Vault
+func isNotFound(err error) bool {
+	var responseErr *azcore.ResponseError
+	return errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusNotFound
+}
+
+// wrapError marks the 404 responses of Azure Key Vault with certstore.ErrNotFound
+func wrapError(err error) error {
+	if isNotFound(err) {
+		return fmt.Errorf("%w: %w", certstore.ErrNotFound, err)
+	}
+	return err
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azurekeyvault
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azcertificates"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+	"github.com/welasco/syncsecretakv/internal/certstore/certstoretest"
+	"github.com/welasco/syncsecretakv/internal/fakekeyvault"
+)
+
+var _ = Describe("Store", func() {
+	It("should mark the 404 responses of Azure Key Vault as not found", func() {
+		Expect(certstore.IsNotFound(wrapError(&azcore.ResponseError{StatusCode: http.StatusNotFound}))).To(BeTrue())
+		Expect(certstore.IsNotFound(wrapError(&azcore.ResponseError{StatusCode: http.StatusForbidden}))).To(BeFalse())
+		Expect(certstore.IsNotFound(wrapError(errors.New("connection reset")))).To(BeFalse())
+		Expect(wrapError(nil)).To(BeNil())
+	})
+
+	It("should convert the certificate bundle", func() {
+		id := azcertificates.ID("https://vault.vault.azure.net/certificates/default-app/0123456789abcdef")
+		owner := "ops"
+		certificate := toCertificate("default-app", azcertificates.CertificateBundle{
+			ID:             &id,
+			X509Thumbprint: []byte("thumbprint"),
+			Tags:           map[string]*string{"owner": &owner, "empty": nil},
+		})
+		Expect(certificate.ID).To(Equal(string(id)))
+		Expect(certificate.Version).To(Equal("0123456789abcdef"))
+		Expect(certificate.Thumbprint).To(Equal([]byte("thumbprint")))
+		Expect(certificate.Tags).To(Equal(map[string]string{"owner": "ops"}))
+		Expect(certificate.Policy).To(BeNil())
+		Expect(fromAzureTags(toAzureTags(certificate.Tags))).To(Equal(certificate.Tags))
+	})
+
+	It("should reuse the Store until the authentication settings of the vault change", func() {
+		config := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{
+			AzKeyVaultURL:          "https://reuse.vault.azure.net/",
+			AzKeyVaultTenantID:     "00000000-0000-0000-0000-000000000000",
+			AzKeyVaultClientID:     "11111111-1111-1111-1111-111111111111",
+			AzKeyVaultClientSecret: "secret",
+		}}
+		store, err := New(config)
+		Expect(err).NotTo(HaveOccurred())
+		again, err := New(config.DeepCopy())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(BeIdenticalTo(store))
+
+		config.Spec.AzKeyVaultClientSecret = "rotated"
+		rotated, err := New(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rotated).NotTo(BeIdenticalTo(store))
+		again, err = New(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(BeIdenticalTo(rotated))
+
+		config.Spec.AzKeyVaultURL = "https://other.vault.azure.net/"
+		other, err := New(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(other).NotTo(BeIdenticalTo(rotated))
+	})
+
+	It("should import, read, tag, list, delete and purge certificates in the fake Key Vault", func() {
+		server := fakekeyvault.NewServer()
+		DeferCleanup(server.Close)
+		store, err := NewWithClientOptions(server.URL(), fakekeyvault.Credential{}, server.ClientOptions())
+		Expect(err).NotTo(HaveOccurred())
+		ctx := context.Background()
+
+		certificate := certstoretest.SelfSigned("app.example.com")
+		thumbprint := sha1.Sum(certificate.Leaf.Raw)
+
+		for _, contentType := range []string{apiv1alpha1.CertificateContentTypePEM, apiv1alpha1.CertificateContentTypePKCS12} {
+			imported, err := store.Import(ctx, "default-app", certstore.ImportRequest{
+				CertificatePEM: certificate.CertificatePEM,
+				PrivateKeyPEM:  certificate.PrivateKeyPEM,
+				Tags:           map[string]string{"owner": "default/app"},
+				Policy:         &apiv1alpha1.CertificatePolicySpec{ContentType: contentType},
+			})
+			Expect(err).NotTo(HaveOccurred(), contentType)
+			Expect(imported.Thumbprint).To(Equal(thumbprint[:]))
+			Expect(imported.Policy.ContentType).To(Equal(contentType))
+		}
+
+		tagged, err := store.SetTags(ctx, "default-app", map[string]string{"owner": "other/app"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tagged.Tags).To(Equal(map[string]string{"owner": "other/app"}))
+		certificates, err := store.List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(certificates).To(HaveLen(1))
+		Expect(certificates[0].Name).To(Equal("default-app"))
+
+		Expect(store.Delete(ctx, "default-app")).To(Succeed())
+		_, err = store.Get(ctx, "default-app")
+		Expect(certstore.IsNotFound(err)).To(BeTrue())
+		deleted, err := store.GetDeleted(ctx, "default-app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deleted.Tags).To(Equal(map[string]string{"owner": "other/app"}))
+		Expect(store.Purge(ctx, "default-app")).To(Succeed())
+		Expect(server.IsDeleted("default-app")).To(BeFalse())
+		_, err = store.GetDeleted(ctx, "default-app")
+		Expect(certstore.IsNotFound(err)).To(BeTrue())
+		Expect(certstore.IsNotFound(store.Purge(ctx, "default-app"))).To(BeTrue())
+	})
+})
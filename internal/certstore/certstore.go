@@ -0,0 +1,97 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package certstore defines the backends the certificates of Kubernetes Secrets are synced to
+package certstore
+
+import (
+	"context"
+	"errors"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+// ErrNotFound is wrapped by the errors of a Store when the certificate does not exist
+var ErrNotFound = errors.New("certificate not found")
+
+// IsNotFound reports whether err means the certificate does not exist in the store
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// Certificate is the current version of a certificate in a Store
+type Certificate struct {
+	// Name is the name of the certificate in the store
+	Name string
+	// ID identifies the certificate version in the store
+	ID string
+	// Version is the version of the certificate, empty for stores without versions
+	Version string
+	// Thumbprint is the SHA-1 thumbprint of the leaf certificate
+	Thumbprint []byte
+	// Tags are the metadata recording who owns the certificate
+	Tags map[string]string
+	// Policy is the policy the store applies to the certificate, nil for stores without policies.
+	// Certificates returned by List carry no policy.
+	Policy *apiv1alpha1.CertificatePolicySpec
+}
+
+// ImportRequest is the content of a Kubernetes TLS Secret imported into a Store
+type ImportRequest struct {
+	// CertificatePEM is the PEM encoded certificate chain, leaf first
+	CertificatePEM []byte
+	// PrivateKeyPEM is the PEM encoded PKCS#1, PKCS#8 or EC private key
+	PrivateKeyPEM []byte
+	// Tags are set on the imported certificate
+	Tags map[string]string
+	// Policy is the Config certificate policy, nil keeps the store defaults
+	Policy *apiv1alpha1.CertificatePolicySpec
+}
+
+// Store is a backend holding certificates. Each method works on the current version of the named certificate
+// and returns an error wrapping ErrNotFound when it does not exist.
+type Store interface {
+	// Import stores the certificate as a new version of the named certificate
+	Import(ctx context.Context, name string, request ImportRequest) (*Certificate, error)
+	// Get returns the named certificate
+	Get(ctx context.Context, name string) (*Certificate, error)
+	// Delete deletes the certificate. It returns once the deletion completed, stores with soft delete keep
+	// the certificate recoverable until it is purged.
+	Delete(ctx context.Context, name string) error
+	// Purge permanently removes a deleted certificate, stores without soft delete return nil
+	Purge(ctx context.Context, name string) error
+	// List returns every certificate of the store
+	List(ctx context.Context) ([]*Certificate, error)
+	// SetTags replaces the tags of the certificate
+	SetTags(ctx context.Context, name string, tags map[string]string) (*Certificate, error)
+}
+
+// PolicyStore is implemented by stores keeping a policy and attributes next to each certificate, which can
+// drift from the Config and be corrected without importing the certificate again
+type PolicyStore interface {
+	Store
+	// UpdatePolicy applies the policy of the Config to the certificate
+	UpdatePolicy(ctx context.Context, name string, policy *apiv1alpha1.CertificatePolicySpec) error
+	// UpdateAttributes applies the attributes of the Config policy, such as Enabled, to the certificate
+	UpdateAttributes(ctx context.Context, name string, policy *apiv1alpha1.CertificatePolicySpec) error
+}
+
+// DeletedStore is implemented by stores with soft delete, where a deleted certificate can be read until it is purged
+type DeletedStore interface {
+	Store
+	// GetDeleted returns the deleted certificate, an error wrapping ErrNotFound when it is not deleted or was purged
+	GetDeleted(ctx context.Context, name string) (*Certificate, error)
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package certstoretest provides the certificate fixtures shared by the tests of the certificate stores
+package certstoretest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// Certificate is a self-signed certificate with its private key
+type Certificate struct {
+	Leaf *x509.Certificate
+	Key  *ecdsa.PrivateKey
+	// CertificatePEM is the PEM encoded certificate
+	CertificatePEM []byte
+	// PrivateKeyPEM is the PEM encoded PKCS#8 private key
+	PrivateKeyPEM []byte
+}
+
+// SelfSigned returns a P-256 certificate for commonName, valid from an hour ago until an hour from now. It must
+// be called from a running spec, failures are reported through Gomega.
+func SelfSigned(commonName string) *Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	leaf, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+	return &Certificate{
+		Leaf:           leaf,
+		Key:            key,
+		CertificatePEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		PrivateKeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// PEM returns the PEM encoded certificate and private key
+func (c *Certificate) PEM() ([]byte, []byte) {
+	return c.CertificatePEM, c.PrivateKeyPEM
+}
+
+// Bundle returns the certificate followed by its private key, as imported into Azure Key Vault
+func (c *Certificate) Bundle() string {
+	return string(c.CertificatePEM) + string(c.PrivateKeyPEM)
+}
@@ -0,0 +1,518 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package filesystem implements the certstore.Store of a local directory, usually a mounted PersistentVolumeClaim
+// shared with workloads that cannot reach a vault
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+)
+
+// Defaults of the Filesystem settings of the Config
+const (
+	DefaultPathTemplate  = "{{ .Name }}"
+	DefaultFileMode      = 0o600
+	DefaultDirectoryMode = 0o700
+)
+
+// Files written to the directory of each certificate
+const (
+	// FileCertificate is the PEM encoded leaf certificate followed by its chain
+	FileCertificate = "tls.crt"
+	// FilePrivateKey is the PEM encoded PKCS#8 private key
+	FilePrivateKey = "tls.key"
+	// FileCAChain is the PEM encoded chain of the leaf certificate, empty for self-signed certificates
+	FileCAChain = "ca.crt"
+	// FilePKCS12 is the PKCS#12 archive without password, only written when the policy asks for PKCS#12
+	FilePKCS12 = "tls.pfx"
+	// FileMetadata holds the name, version and tags of the certificate. It is written last, a directory
+	// without it is not a certificate.
+	FileMetadata = "metadata.json"
+)
+
+// certificateFiles are the files of a certificate directory, FileMetadata last
+var certificateFiles = []string{FileCertificate, FilePrivateKey, FileCAChain, FilePKCS12, FileMetadata}
+
+// DeletedDirectory is the directory below the root deleted certificates are moved to until they are purged
+const DeletedDirectory = ".deleted"
+
+// DataLink is the symbolic link of a certificate directory to the directory of its current version. The files of
+// the certificate directory are symbolic links to the same files below DataLink.
+const DataLink = "..data"
+
+// versionDirectoryPrefix starts the names of the version directories of a certificate
+const versionDirectoryPrefix = "..version-"
+
+// Store is the certstore.Store of a local directory. Each certificate is a directory holding PEM and PFX files.
+// Every version is written to a new version directory and published by replacing DataLink with a single atomic
+// rename, so readers following the links never see the files of two versions or a partially written file.
+// Delete moves the directory below DeletedDirectory, Purge removes it.
+type Store struct {
+	root          string
+	pathTemplate  *template.Template
+	fileMode      os.FileMode
+	directoryMode os.FileMode
+}
+
+var _ certstore.DeletedStore = &Store{}
+
+// metadata is the content of FileMetadata
+type metadata struct {
+	Name    string            `json:"name"`
+	Version int64             `json:"version"`
+	Tags    map[string]string `json:"tags"`
+}
+
+// New returns the Store of the directory of the Config
+func New(config *apiv1alpha1.Config) (*Store, error) {
+	spec := config.Spec.Filesystem
+	if spec == nil || spec.Path == "" {
+		return nil, errors.New("filesystem.path is required by the Filesystem backend")
+	}
+	if !filepath.IsAbs(spec.Path) {
+		return nil, fmt.Errorf("filesystem.path must be absolute: %q", spec.Path)
+	}
+
+	fileMode, err := parseMode(spec.FileMode, DefaultFileMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filesystem.fileMode: %w", err)
+	}
+	directoryMode, err := parseMode(spec.DirectoryMode, DefaultDirectoryMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filesystem.directoryMode: %w", err)
+	}
+	text := spec.PathTemplate
+	if text == "" {
+		text = DefaultPathTemplate
+	}
+	pathTemplate, err := template.New("pathTemplate").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filesystem.pathTemplate: %w", err)
+	}
+
+	return &Store{
+		root:          filepath.Clean(spec.Path),
+		pathTemplate:  pathTemplate,
+		fileMode:      fileMode,
+		directoryMode: directoryMode,
+	}, nil
+}
+
+// URL returns the file URL of the directory, which identifies the store in metrics, status and deletion limits
+func URL(spec *apiv1alpha1.FilesystemSpec) string {
+	return "file://" + filepath.Clean(spec.Path)
+}
+
+// Import writes the certificate files to a new version of the directory of the certificate
+func (s *Store) Import(ctx context.Context, name string, request certstore.ImportRequest) (*certstore.Certificate, error) {
+	dir, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := certstore.ParseCertificates(request.CertificatePEM)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse certificate: %w", err)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate found in tls.crt")
+	}
+	key, err := certstore.PKCS8PEM(request.PrivateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{
+		FileCertificate: encodeCertificates(chain),
+		FilePrivateKey:  key,
+		FileCAChain:     encodeCertificates(chain[1:]),
+	}
+	if certstore.ContentType(request.Policy) == apiv1alpha1.CertificateContentTypePKCS12 {
+		pfx, err := certstore.EncodePKCS12(request.CertificatePEM, request.PrivateKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		files[FilePKCS12] = pfx
+	}
+
+	if err := os.MkdirAll(dir, s.directoryMode); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(dir, s.directoryMode); err != nil {
+		return nil, err
+	}
+	existing, err := s.readMetadata(dir)
+	if err != nil && !certstore.IsNotFound(err) {
+		return nil, err
+	}
+	version := int64(1)
+	if existing != nil {
+		version = existing.Version + 1
+	}
+
+	files[FileMetadata], err = marshalMetadata(&metadata{Name: name, Version: version, Tags: request.Tags})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.writeVersion(dir, files); err != nil {
+		return nil, err
+	}
+	return s.read(dir)
+}
+
+// Get reads the certificate from its directory
+func (s *Store) Get(ctx context.Context, name string) (*certstore.Certificate, error) {
+	dir, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.read(dir)
+}
+
+// Delete moves the directory of the certificate below DeletedDirectory, replacing an earlier deleted copy
+func (s *Store) Delete(ctx context.Context, name string) error {
+	dir, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if _, err := s.readMetadata(dir); err != nil {
+		return err
+	}
+	deleted, err := s.deletedPath(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(deleted); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(deleted), s.directoryMode); err != nil {
+		return err
+	}
+	return os.Rename(dir, deleted)
+}
+
+// Purge removes the deleted copy of the certificate
+func (s *Store) Purge(ctx context.Context, name string) error {
+	dir, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.deletedPath(dir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(deleted); err != nil {
+		return wrapError(err)
+	}
+	return os.RemoveAll(deleted)
+}
+
+// GetDeleted reads the deleted copy of the certificate
+func (s *Store) GetDeleted(ctx context.Context, name string) (*certstore.Certificate, error) {
+	dir, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := s.deletedPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	return s.read(deleted)
+}
+
+// List returns the certificates of every directory below the root holding a metadata file, deleted
+// certificates excluded
+func (s *Store) List(ctx context.Context) ([]*certstore.Certificate, error) {
+	certificates := []*certstore.Certificate{}
+	err := filepath.WalkDir(s.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == s.root && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if entry.IsDir() && path != s.root && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if entry.IsDir() || entry.Name() != FileMetadata {
+			return nil
+		}
+		certificate, err := s.read(filepath.Dir(path))
+		if certstore.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		certificates = append(certificates, certificate)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return certificates, nil
+}
+
+// SetTags writes a new version of the directory of the certificate with the same files and the tags in the
+// metadata. The version number in the metadata is kept.
+func (s *Store) SetTags(ctx context.Context, name string, tags map[string]string) (*certstore.Certificate, error) {
+	dir, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.readMetadata(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	for _, file := range certificateFiles {
+		data, err := os.ReadFile(filepath.Join(currentVersion(dir), file))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files[file] = data
+	}
+	existing.Tags = tags
+	files[FileMetadata], err = marshalMetadata(existing)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.writeVersion(dir, files); err != nil {
+		return nil, err
+	}
+	return s.read(dir)
+}
+
+// read reads the metadata and the certificate of the same version of the certificate directory
+func (s *Store) read(dir string) (*certstore.Certificate, error) {
+	version := currentVersion(dir)
+	existing, err := s.readMetadata(version)
+	if err != nil {
+		return nil, err
+	}
+	certificatePEM, err := os.ReadFile(filepath.Join(version, FileCertificate))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	thumbprint, err := certstore.Thumbprint(certificatePEM)
+	if err != nil {
+		return nil, err
+	}
+	tags := existing.Tags
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	return &certstore.Certificate{
+		Name:       existing.Name,
+		ID:         "file://" + dir,
+		Version:    strconv.FormatInt(existing.Version, 10),
+		Thumbprint: thumbprint,
+		Tags:       tags,
+	}, nil
+}
+
+func (s *Store) readMetadata(dir string) (*metadata, error) {
+	data, err := os.ReadFile(filepath.Join(dir, FileMetadata))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	existing := &metadata{}
+	if err := json.Unmarshal(data, existing); err != nil {
+		return nil, fmt.Errorf("invalid %s in %s: %w", FileMetadata, dir, err)
+	}
+	return existing, nil
+}
+
+func marshalMetadata(written *metadata) ([]byte, error) {
+	return json.MarshalIndent(written, "", "  ")
+}
+
+// currentVersion returns the directory DataLink points to, or dir itself for a certificate written before the
+// version directories
+func currentVersion(dir string) string {
+	target, err := os.Readlink(filepath.Join(dir, DataLink))
+	if err != nil {
+		return dir
+	}
+	return filepath.Join(dir, target)
+}
+
+// writeVersion writes the files to a new version directory and switches DataLink to it with an atomic rename. The
+// files of the certificate directory are then linked below DataLink, FileMetadata last, and files missing from the
+// new version are removed. Earlier version directories are removed once they are no longer linked.
+func (s *Store) writeVersion(dir string, files map[string][]byte) error {
+	version, err := os.MkdirTemp(dir, versionDirectoryPrefix)
+	if err != nil {
+		return err
+	}
+	published := false
+	defer func() {
+		if !published {
+			os.RemoveAll(version)
+		}
+	}()
+	if err := os.Chmod(version, s.directoryMode); err != nil {
+		return err
+	}
+	for file, data := range files {
+		if err := s.writeFile(version, file, data); err != nil {
+			return err
+		}
+	}
+
+	if err := replaceSymlink(dir, DataLink, filepath.Base(version)); err != nil {
+		return err
+	}
+	published = true
+	for _, file := range certificateFiles {
+		if _, ok := files[file]; !ok {
+			if err := os.Remove(filepath.Join(dir, file)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			continue
+		}
+		if err := replaceSymlink(dir, file, filepath.Join(DataLink, file)); err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), versionDirectoryPrefix) && entry.Name() != filepath.Base(version) {
+			if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// replaceSymlink points the link name of dir to target, replacing a file or link of that name with an atomic rename
+func replaceSymlink(dir string, name string, target string) error {
+	link := filepath.Join(dir, name)
+	if current, err := os.Readlink(link); err == nil && current == target {
+		return nil
+	}
+	temp := filepath.Join(dir, "."+name+".link-"+strconv.FormatInt(time.Now().UnixNano(), 10))
+	if err := os.Symlink(target, temp); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, link); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return nil
+}
+
+// writeFile replaces the file with an atomic rename of a temporary file written and synced in the same directory
+func (s *Store) writeFile(dir string, name string, data []byte) error {
+	temp, err := os.CreateTemp(dir, "."+name+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if err := temp.Chmod(s.fileMode); err != nil {
+		temp.Close()
+		return err
+	}
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), filepath.Join(dir, name))
+}
+
+// path renders the path template for the certificate and returns its directory below the root
+func (s *Store) path(name string) (string, error) {
+	var rendered bytes.Buffer
+	if err := s.pathTemplate.Execute(&rendered, struct{ Name string }{Name: name}); err != nil {
+		return "", fmt.Errorf("unable to render filesystem.pathTemplate: %w", err)
+	}
+	segments := strings.Split(strings.Trim(rendered.String(), "/"), "/")
+	for _, segment := range segments {
+		// Segments starting with a dot are reserved for the deleted certificates and the temporary files
+		if segment == "" || strings.HasPrefix(segment, ".") {
+			return "", fmt.Errorf("filesystem.pathTemplate rendered an invalid path for certificate %q: %q", name, rendered.String())
+		}
+	}
+	return filepath.Join(append([]string{s.root}, segments...)...), nil
+}
+
+// deletedPath returns where the directory of a certificate is moved to when it is deleted
+func (s *Store) deletedPath(dir string) (string, error) {
+	relative, err := filepath.Rel(s.root, dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, DeletedDirectory, relative), nil
+}
+
+func encodeCertificates(certificates []*x509.Certificate) []byte {
+	var encoded []byte
+	for _, certificate := range certificates {
+		encoded = append(encoded, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})...)
+	}
+	return encoded
+}
+
+func parseMode(value string, defaultMode os.FileMode) (os.FileMode, error) {
+	if value == "" {
+		return defaultMode, nil
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("%q is not an octal permission", value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// wrapError marks the missing files with certstore.ErrNotFound
+func wrapError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %w", certstore.ErrNotFound, err)
+	}
+	return err
+}
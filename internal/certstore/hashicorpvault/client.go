@@ -0,0 +1,224 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hashicorpvault
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/welasco/syncsecretakv/internal/ratelimit"
+)
+
+// ServiceAccountTokenPath is the service account token the controller logs in to the Kubernetes auth method with
+var ServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// TokenEnvVar is the environment variable holding the Vault token used when the Config sets no role
+const TokenEnvVar = "VAULT_TOKEN"
+
+// ErrLoginFailed is wrapped by the errors returned when the controller cannot obtain a Vault token
+var ErrLoginFailed = errors.New("unable to log in to hashicorp vault")
+
+// ResponseError is an error response of HashiCorp Vault
+type ResponseError struct {
+	StatusCode int
+	Errors     []string
+}
+
+func (e *ResponseError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("hashicorp vault returned %d", e.StatusCode)
+	}
+	return fmt.Sprintf("hashicorp vault returned %d: %s", e.StatusCode, strings.Join(e.Errors, "; "))
+}
+
+// cachedToken is a Vault token obtained from the Kubernetes auth method
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+var (
+	tokensMu sync.Mutex
+	// tokens holds the Vault tokens by address, namespace, auth mount and role, Stores are opened on every reconcile
+	tokens = map[string]cachedToken{}
+
+	clientsMu sync.Mutex
+	// clients holds the HTTP clients by CA bundle so connections are reused across Stores
+	clients = map[string]*http.Client{}
+)
+
+// httpClient returns the HTTP client trusting caBundle, or the system roots when it is empty
+func httpClient(caBundle string) (*http.Client, error) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if client, ok := clients[caBundle]; ok {
+		return client, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caBundle != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(caBundle)) {
+			return nil, errors.New("hashiCorpVault.caBundle contains no PEM encoded certificate")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	client := &http.Client{Transport: transport}
+	clients[caBundle] = client
+	return client, nil
+}
+
+// do sends a request to the Vault API and decodes the JSON response into out when it is not nil. A 403 response
+// to a token of the Kubernetes auth method logs in again once, the token may have been revoked.
+func (s *Store) do(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	err := s.send(ctx, method, path, body, out)
+	var responseErr *ResponseError
+	if s.role != "" && errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusForbidden {
+		s.forgetToken()
+		err = s.send(ctx, method, path, body, out)
+	}
+	return err
+}
+
+func (s *Store) send(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	token, err := s.token(ctx)
+	if err != nil {
+		return err
+	}
+	return s.request(ctx, method, path, token, body, out)
+}
+
+// request sends a single request to the Vault API, waiting for the rate limiter of the Vault first
+func (s *Store) request(ctx context.Context, method string, path string, token string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.address+"/v1/"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if s.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.namespace)
+	}
+
+	if err := s.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if delay, ok := ratelimit.RetryAfter(resp); ok {
+			s.limiter.PauseFor(delay)
+		}
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		responseErr := &ResponseError{StatusCode: resp.StatusCode}
+		var errorBody struct {
+			Errors []string `json:"errors"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&errorBody) == nil {
+			responseErr.Errors = errorBody.Errors
+		}
+		return responseErr
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// token returns the Vault token of the Store: the cached token of the Kubernetes auth method role, a new one
+// after logging in, or the VAULT_TOKEN environment variable when the Config sets no role
+func (s *Store) token(ctx context.Context) (string, error) {
+	if s.role == "" {
+		if token := os.Getenv(TokenEnvVar); token != "" {
+			return token, nil
+		}
+		return "", fmt.Errorf("%w: set hashiCorpVault.role or the %s environment variable", ErrLoginFailed, TokenEnvVar)
+	}
+
+	tokensMu.Lock()
+	cached, ok := tokens[s.tokenKey()]
+	tokensMu.Unlock()
+	if ok && (cached.expires.IsZero() || time.Now().Before(cached.expires)) {
+		return cached.token, nil
+	}
+
+	jwt, err := os.ReadFile(ServiceAccountTokenPath)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrLoginFailed, err)
+	}
+	var login struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int64  `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	body := map[string]string{"role": s.role, "jwt": strings.TrimSpace(string(jwt))}
+	if err := s.request(ctx, http.MethodPost, "auth/"+s.authMount+"/login", "", body, &login); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrLoginFailed, err)
+	}
+	if login.Auth.ClientToken == "" {
+		return "", fmt.Errorf("%w: no client token in the login response", ErrLoginFailed)
+	}
+
+	// Log in again once most of the lease has passed rather than renewing the token
+	cached = cachedToken{token: login.Auth.ClientToken}
+	if login.Auth.LeaseDuration > 0 {
+		cached.expires = time.Now().Add(time.Duration(login.Auth.LeaseDuration) * time.Second * 4 / 5)
+	}
+	tokensMu.Lock()
+	tokens[s.tokenKey()] = cached
+	tokensMu.Unlock()
+	return cached.token, nil
+}
+
+func (s *Store) forgetToken() {
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+	delete(tokens, s.tokenKey())
+}
+
+func (s *Store) tokenKey() string {
+	return strings.Join([]string{s.address, s.namespace, s.authMount, s.role}, "|")
+}
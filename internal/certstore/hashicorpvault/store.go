@@ -0,0 +1,412 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package hashicorpvault implements the certstore.Store of a HashiCorp Vault KV v2 secrets engine
+package hashicorpvault
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+	"github.com/welasco/syncsecretakv/internal/ratelimit"
+)
+
+// Defaults of the HashiCorpVault settings of the Config
+const (
+	DefaultMount        = "secret"
+	DefaultAuthMount    = "kubernetes"
+	DefaultPathTemplate = "syncsecretakv/{{ .Name }}"
+)
+
+// Fields of the KV v2 secret holding a certificate
+const (
+	// FieldName is the certificate name the secret was written for
+	FieldName = "name"
+	// FieldCertificate is the PEM encoded leaf certificate
+	FieldCertificate = "certificate"
+	// FieldPrivateKey is the PEM encoded PKCS#8 private key
+	FieldPrivateKey = "private_key"
+	// FieldCAChain is the PEM encoded chain of the leaf certificate, empty for self-signed certificates
+	FieldCAChain = "ca_chain"
+	// FieldPKCS12 is the base64 encoded PKCS#12 archive, only written when the policy asks for PKCS#12
+	FieldPKCS12 = "pkcs12"
+)
+
+// Store is the certstore.Store of a HashiCorp Vault KV v2 secrets engine. Each certificate is a secret whose
+// fields hold the certificate, key and chain and whose custom metadata holds the tags. Delete soft deletes the
+// latest version, which can be undeleted until Purge removes every version and the metadata.
+type Store struct {
+	client       *http.Client
+	limiter      *ratelimit.VaultLimiter
+	address      string
+	mount        string
+	namespace    string
+	authMount    string
+	role         string
+	pathTemplate *template.Template
+}
+
+var _ certstore.DeletedStore = &Store{}
+
+// New returns the Store of the HashiCorp Vault of the Config
+func New(config *apiv1alpha1.Config) (*Store, error) {
+	spec := config.Spec.HashiCorpVault
+	if spec == nil || spec.Address == "" {
+		return nil, errors.New("hashiCorpVault.address is required by the HashiCorpVault backend")
+	}
+
+	client, err := httpClient(spec.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	text := spec.PathTemplate
+	if text == "" {
+		text = DefaultPathTemplate
+	}
+	pathTemplate, err := template.New("pathTemplate").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hashiCorpVault.pathTemplate: %w", err)
+	}
+
+	s := &Store{
+		client:       client,
+		limiter:      ratelimit.Vaults.For(MountURL(spec)),
+		address:      strings.TrimSuffix(spec.Address, "/"),
+		mount:        strings.Trim(valueOrDefault(spec.Mount, DefaultMount), "/"),
+		namespace:    spec.Namespace,
+		authMount:    strings.Trim(valueOrDefault(spec.AuthMount, DefaultAuthMount), "/"),
+		role:         spec.Role,
+		pathTemplate: pathTemplate,
+	}
+	return s, nil
+}
+
+// MountURL returns the URL of the KV v2 mount, which identifies the store in metrics, status and rate limits
+func MountURL(spec *apiv1alpha1.HashiCorpVaultSpec) string {
+	return strings.TrimSuffix(spec.Address, "/") + "/v1/" + strings.Trim(valueOrDefault(spec.Mount, DefaultMount), "/")
+}
+
+// versionMetadata is the state of a version of a KV v2 secret
+type versionMetadata struct {
+	DeletionTime string `json:"deletion_time"`
+	Destroyed    bool   `json:"destroyed"`
+}
+
+// isDeleted reports whether the version is soft deleted or destroyed, its data can no longer be read
+func (v versionMetadata) isDeleted() bool {
+	return v.DeletionTime != "" || v.Destroyed
+}
+
+// secretResponse is the response of reading a KV v2 secret
+type secretResponse struct {
+	Data struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata struct {
+			versionMetadata
+			Version        int64             `json:"version"`
+			CustomMetadata map[string]string `json:"custom_metadata"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+// metadataResponse is the response of reading the metadata of a KV v2 secret
+type metadataResponse struct {
+	Data struct {
+		CurrentVersion int64                      `json:"current_version"`
+		CustomMetadata map[string]string          `json:"custom_metadata"`
+		Versions       map[string]versionMetadata `json:"versions"`
+	} `json:"data"`
+}
+
+// Import writes the certificate as a new version of its secret. The tags are written first so the certificate
+// is never readable without the tags recording its owner.
+func (s *Store) Import(ctx context.Context, name string, request certstore.ImportRequest) (*certstore.Certificate, error) {
+	secretPath, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := certstore.ParseCertificates(request.CertificatePEM)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse certificate: %w", err)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate found in tls.crt")
+	}
+	key, err := certstore.PKCS8PEM(request.PrivateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]string{
+		FieldName:        name,
+		FieldCertificate: encodeCertificates(chain[:1]),
+		FieldPrivateKey:  string(key),
+		FieldCAChain:     encodeCertificates(chain[1:]),
+	}
+	if certstore.ContentType(request.Policy) == apiv1alpha1.CertificateContentTypePKCS12 {
+		pfx, err := certstore.EncodePKCS12(request.CertificatePEM, request.PrivateKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		data[FieldPKCS12] = base64.StdEncoding.EncodeToString(pfx)
+	}
+
+	if err := s.setMetadata(ctx, secretPath, request.Tags); err != nil {
+		return nil, err
+	}
+	var written struct {
+		Data struct {
+			Version int64 `json:"version"`
+		} `json:"data"`
+	}
+	if err := s.do(ctx, http.MethodPost, s.mount+"/data/"+secretPath, map[string]interface{}{"data": data}, &written); err != nil {
+		return nil, wrapError(err)
+	}
+
+	thumbprint := sha1.Sum(chain[0].Raw)
+	return s.certificate(name, secretPath, written.Data.Version, thumbprint[:], request.Tags), nil
+}
+
+// Get reads the latest version of the secret of the certificate, a soft deleted or destroyed version is not found
+func (s *Store) Get(ctx context.Context, name string) (*certstore.Certificate, error) {
+	secretPath, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.read(ctx, name, secretPath)
+}
+
+// Delete soft deletes the latest version of the secret of the certificate
+func (s *Store) Delete(ctx context.Context, name string) error {
+	secretPath, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	return wrapError(s.do(ctx, http.MethodDelete, s.mount+"/data/"+secretPath, nil, nil))
+}
+
+// Purge permanently removes every version and the metadata of the secret of the certificate
+func (s *Store) Purge(ctx context.Context, name string) error {
+	secretPath, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	return wrapError(s.do(ctx, http.MethodDelete, s.mount+"/metadata/"+secretPath, nil, nil))
+}
+
+// GetDeleted reads the metadata of the secret of the certificate when its latest version is soft deleted or
+// destroyed. The certificate has the tags of the secret and no thumbprint, the data of the version is not readable.
+func (s *Store) GetDeleted(ctx context.Context, name string) (*certstore.Certificate, error) {
+	secretPath, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	var metadata metadataResponse
+	if err := s.do(ctx, http.MethodGet, s.mount+"/metadata/"+secretPath, nil, &metadata); err != nil {
+		return nil, wrapError(err)
+	}
+	version := metadata.Data.CurrentVersion
+	if !metadata.Data.Versions[strconv.FormatInt(version, 10)].isDeleted() {
+		return nil, fmt.Errorf("%w: version %d of %s is not deleted", certstore.ErrNotFound, version, secretPath)
+	}
+	return s.certificate(name, secretPath, version, nil, metadata.Data.CustomMetadata), nil
+}
+
+// List returns the certificates below the static part of the path template, the directory the controller writes to.
+// Secrets without a name field are named after their path.
+func (s *Store) List(ctx context.Context) ([]*certstore.Certificate, error) {
+	certificates := []*certstore.Certificate{}
+	err := s.walk(ctx, s.listPrefix(), func(secretPath string) error {
+		secret, err := s.readSecret(ctx, secretPath)
+		if certstore.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name, _ := secret.Data.Data[FieldName].(string)
+		if name == "" {
+			name = path.Base(secretPath)
+		}
+		certificates = append(certificates, s.toCertificate(name, secretPath, secret))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return certificates, nil
+}
+
+// SetTags replaces the custom metadata of the secret of the certificate
+func (s *Store) SetTags(ctx context.Context, name string, tags map[string]string) (*certstore.Certificate, error) {
+	secretPath, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.setMetadata(ctx, secretPath, tags); err != nil {
+		return nil, err
+	}
+	return s.read(ctx, name, secretPath)
+}
+
+func (s *Store) read(ctx context.Context, name string, secretPath string) (*certstore.Certificate, error) {
+	secret, err := s.readSecret(ctx, secretPath)
+	if err != nil {
+		return nil, err
+	}
+	return s.toCertificate(name, secretPath, secret), nil
+}
+
+// readSecret reads the latest version of the secret. Vault answers a soft deleted version with its metadata and
+// no data, which is reported as not found like a missing secret.
+func (s *Store) readSecret(ctx context.Context, secretPath string) (*secretResponse, error) {
+	var secret secretResponse
+	if err := s.do(ctx, http.MethodGet, s.mount+"/data/"+secretPath, nil, &secret); err != nil {
+		return nil, wrapError(err)
+	}
+	if secret.Data.Metadata.isDeleted() || secret.Data.Data == nil {
+		return nil, fmt.Errorf("%w: version %d of %s is deleted", certstore.ErrNotFound, secret.Data.Metadata.Version, secretPath)
+	}
+	return &secret, nil
+}
+
+func (s *Store) setMetadata(ctx context.Context, secretPath string, tags map[string]string) error {
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	return wrapError(s.do(ctx, http.MethodPost, s.mount+"/metadata/"+secretPath, map[string]interface{}{"custom_metadata": tags}, nil))
+}
+
+// walk calls visit with the path of every secret below prefix
+func (s *Store) walk(ctx context.Context, prefix string, visit func(secretPath string) error) error {
+	var list struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	err := s.do(ctx, http.MethodGet, s.mount+"/metadata/"+prefix+"?list=true", nil, &list)
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return wrapError(err)
+	}
+	for _, key := range list.Data.Keys {
+		if strings.HasSuffix(key, "/") {
+			err = s.walk(ctx, prefix+key, visit)
+		} else {
+			err = visit(prefix + key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// path renders the path template for the certificate, escaping each segment
+func (s *Store) path(name string) (string, error) {
+	var rendered bytes.Buffer
+	if err := s.pathTemplate.Execute(&rendered, struct{ Name string }{Name: name}); err != nil {
+		return "", fmt.Errorf("unable to render hashiCorpVault.pathTemplate: %w", err)
+	}
+	segments := strings.Split(strings.Trim(rendered.String(), "/"), "/")
+	for i, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("hashiCorpVault.pathTemplate rendered an invalid path for certificate %q: %q", name, rendered.String())
+		}
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// listPrefix returns the directory of the path template before its first action, where List starts walking
+func (s *Store) listPrefix() string {
+	text := s.pathTemplate.Root.String()
+	if i := strings.Index(text, "{{"); i >= 0 {
+		text = text[:i]
+	}
+	text = strings.TrimLeft(text, "/")
+	if i := strings.LastIndex(text, "/"); i >= 0 {
+		return text[:i+1]
+	}
+	return ""
+}
+
+func (s *Store) toCertificate(name string, secretPath string, secret *secretResponse) *certstore.Certificate {
+	var thumbprint []byte
+	if leaf, ok := secret.Data.Data[FieldCertificate].(string); ok {
+		thumbprint, _ = certstore.Thumbprint([]byte(leaf))
+	}
+	return s.certificate(name, secretPath, secret.Data.Metadata.Version, thumbprint, secret.Data.Metadata.CustomMetadata)
+}
+
+func (s *Store) certificate(name string, secretPath string, version int64, thumbprint []byte, tags map[string]string) *certstore.Certificate {
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	versionText := strconv.FormatInt(version, 10)
+	return &certstore.Certificate{
+		Name:       name,
+		ID:         s.address + "/v1/" + s.mount + "/data/" + secretPath + "?version=" + versionText,
+		Version:    versionText,
+		Thumbprint: thumbprint,
+		Tags:       tags,
+	}
+}
+
+func encodeCertificates(certificates []*x509.Certificate) string {
+	var encoded []byte
+	for _, certificate := range certificates {
+		encoded = append(encoded, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})...)
+	}
+	return string(encoded)
+}
+
+func valueOrDefault(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// isNotFound reports whether err is a 404 returned by HashiCorp Vault
+func isNotFound(err error) bool {
+	var responseErr *ResponseError
+	return errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusNotFound
+}
+
+// wrapError marks the 404 responses of HashiCorp Vault with certstore.ErrNotFound
+func wrapError(err error) error {
+	if isNotFound(err) {
+		return fmt.Errorf("%w: %w", certstore.ErrNotFound, err)
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certstore
+
+import (
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+// ContentType returns the content type a certificate is stored with, PEM unless the policy asks for PKCS#12
+func ContentType(policy *apiv1alpha1.CertificatePolicySpec) string {
+	if policy == nil || policy.ContentType == "" {
+		return apiv1alpha1.CertificateContentTypePEM
+	}
+	return policy.ContentType
+}
+
+// ParseCertificates parses every CERTIFICATE block of a PEM bundle
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certificates, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+}
+
+// ParsePrivateKey parses a PEM encoded PKCS#1, PKCS#8 or EC private key
+func ParsePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block containing the private key")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, errors.New("unsupported private key type: " + block.Type)
+	}
+}
+
+// PKCS8PEM converts a PEM encoded private key to a PEM encoded PKCS#8 private key
+func PKCS8PEM(keyPEM []byte) ([]byte, error) {
+	privateKey, err := ParsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	pkcs8PrivateKey, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert the private key to PKCS#8: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8PrivateKey}), nil
+}
+
+// EncodePKCS12 bundles the PEM encoded certificate chain and private key into a PKCS#12 archive without password
+func EncodePKCS12(certificatePEM []byte, keyPEM []byte) ([]byte, error) {
+	certificates, err := ParseCertificates(certificatePEM)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse certificate: %w", err)
+	}
+	if len(certificates) == 0 {
+		return nil, errors.New("no certificate found in tls.crt")
+	}
+
+	privateKey, err := ParsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	pfx, err := pkcs12.LegacyDES.Encode(privateKey, certificates[0], certificates[1:], "")
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode pkcs12: %w", err)
+	}
+	return pfx, nil
+}
+
+// Thumbprint returns the SHA-1 thumbprint of the leaf of a PEM encoded certificate chain
+func Thumbprint(certificatePEM []byte) ([]byte, error) {
+	certificates, err := ParseCertificates(certificatePEM)
+	if err != nil {
+		return nil, err
+	}
+	if len(certificates) == 0 {
+		return nil, errors.New("no certificate found in tls.crt")
+	}
+	thumbprint := sha1.Sum(certificates[0].Raw)
+	return thumbprint[:], nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"software.sslmate.com/src/go-pkcs12"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+var _ = Describe("PEM encoding", func() {
+	var (
+		leaf    *x509.Certificate
+		certPEM []byte
+		keyPEM  []byte
+	)
+
+	BeforeEach(func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "app.example.com"},
+			DNSNames:     []string{"app.example.com"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		Expect(err).NotTo(HaveOccurred())
+		leaf, err = x509.ParseCertificate(der)
+		Expect(err).NotTo(HaveOccurred())
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		Expect(err).NotTo(HaveOccurred())
+		certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	})
+
+	It("should convert the private key to PKCS#8", func() {
+		converted, err := PKCS8PEM(keyPEM)
+		Expect(err).NotTo(HaveOccurred())
+		block, _ := pem.Decode(converted)
+		Expect(block.Type).To(Equal("PRIVATE KEY"))
+		_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = PKCS8PEM([]byte("not a key"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should encode the certificate and key as PKCS#12", func() {
+		pfx, err := EncodePKCS12(certPEM, keyPEM)
+		Expect(err).NotTo(HaveOccurred())
+		_, certificate, _, err := pkcs12.DecodeChain(pfx, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(certificate.DNSNames).To(ConsistOf("app.example.com"))
+
+		_, err = EncodePKCS12(nil, keyPEM)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should compute the thumbprint of the leaf certificate", func() {
+		expected := sha1.Sum(leaf.Raw)
+		Expect(Thumbprint(certPEM)).To(Equal(expected[:]))
+	})
+
+	It("should default the content type to PEM", func() {
+		Expect(ContentType(nil)).To(Equal(apiv1alpha1.CertificateContentTypePEM))
+		Expect(ContentType(&apiv1alpha1.CertificatePolicySpec{ContentType: apiv1alpha1.CertificateContentTypePKCS12})).To(Equal(apiv1alpha1.CertificateContentTypePKCS12))
+	})
+})
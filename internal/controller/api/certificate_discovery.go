@@ -0,0 +1,201 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+)
+
+// DefaultCertificateNameTemplate renders the name the controller imports a Secret under
+const DefaultCertificateNameTemplate = "{{ .Namespace }}-{{ .Name }}"
+
+// DiscoveredCertificate is a pre-existing certificate matched to a Secret and tagged as managed
+type DiscoveredCertificate struct {
+	Name        string
+	Certificate *certstore.Certificate
+	// Identical is true when the certificate holds the same certificate as the Secret, no import is needed
+	Identical bool
+}
+
+// AzKeyVaultCertificateName returns the name of the Azure Key Vault certificate the SyncSecretAKV is synced to
+func AzKeyVaultCertificateName(syncSecretAKV *apiv1alpha1.SyncSecretAKV) string {
+	if syncSecretAKV.Status.CertificateName != "" {
+		return syncSecretAKV.Status.CertificateName
+	}
+	return syncSecretAKV.Namespace + "-" + syncSecretAKV.Name
+}
+
+// DiscoveryEnabled reports whether the Config matches first syncs to existing certificates
+func DiscoveryEnabled(config *apiv1alpha1.Config) bool {
+	return config.Spec.CertificateDiscovery != "" && config.Spec.CertificateDiscovery != apiv1alpha1.CertificateDiscoveryDisabled
+}
+
+// RenderCertificateName renders the Config CertificateNameTemplate for the Secret
+func RenderCertificateName(config *apiv1alpha1.Config, secret *corev1.Secret) (string, error) {
+	text := config.Spec.CertificateNameTemplate
+	if text == "" {
+		text = DefaultCertificateNameTemplate
+	}
+	tmpl, err := template.New("certificateNameTemplate").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid certificateNameTemplate: %w", err)
+	}
+	data := certificateTagTemplateData{
+		Namespace:   secret.Namespace,
+		Name:        secret.Name,
+		Labels:      secret.Labels,
+		Annotations: secret.Annotations,
+	}
+	var name bytes.Buffer
+	if err := tmpl.Execute(&name, data); err != nil {
+		return "", fmt.Errorf("unable to render certificateNameTemplate: %w", err)
+	}
+	if name.Len() == 0 {
+		return "", errors.New("certificateNameTemplate rendered an empty name")
+	}
+	return name.String(), nil
+}
+
+// FindCertificateByThumbprint returns the name of the first certificate whose SHA-1 thumbprint is thumbprint and
+// which the Config AdoptionPolicy allows to take over
+func FindCertificateByThumbprint(certificates []*certstore.Certificate, thumbprint []byte, config *apiv1alpha1.Config, secret *corev1.Secret) (string, bool) {
+	for _, certificate := range certificates {
+		if certificate == nil || !bytes.Equal(certificate.Thumbprint, thumbprint) {
+			continue
+		}
+		ownership := GetCertificateOwnership(certificate.Tags, config, secret.Namespace, secret.Name)
+		if !IsCertificateManageable(ownership, config.Spec.AdoptionPolicy) {
+			log.Log.Info("SyncSecretAKVController - Certificate with a matching thumbprint is owned by someone else, not adopting it: " + certificate.Name)
+			continue
+		}
+		return certificate.Name, true
+	}
+	return "", false
+}
+
+// AdoptionTags returns the tags of an adopted certificate: the tags the controller would set on import, followed
+// by the tags already on the certificate as long as Azure Key Vault accepts more
+func AdoptionTags(config *apiv1alpha1.Config, secret *corev1.Secret, existing map[string]string) (map[string]string, error) {
+	tags, err := BuildCertificateTags(config, secret)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range sortedKeys(existing) {
+		if _, ok := tags[key]; ok || len(tags) >= MaxCertificateTags {
+			continue
+		}
+		tags[key] = existing[key]
+	}
+	return tags, nil
+}
+
+// DiscoverCertificate looks for an existing certificate in the store for a Secret synced for the first time, by
+// name and/or thumbprint as set by the Config CertificateDiscovery, and tags it as managed by the controller.
+// It returns nil when no adoptable certificate matched. In dry run the certificate is not tagged.
+func DiscoverCertificate(ctx context.Context, store certstore.Store, config *apiv1alpha1.Config, secret *corev1.Secret, leaf *x509.Certificate) (*DiscoveredCertificate, error) {
+
+	mode := config.Spec.CertificateDiscovery
+	thumbprint := sha1.Sum(leaf.Raw)
+
+	name := ""
+	if mode == apiv1alpha1.CertificateDiscoveryName || mode == apiv1alpha1.CertificateDiscoveryNameOrThumbprint {
+		candidate, err := RenderCertificateName(config, secret)
+		if err != nil {
+			return nil, err
+		}
+		callCtx, cancel := keyVaultContext(ctx, OperationGetCertificate)
+		start := time.Now()
+		existing, err := store.Get(callCtx, candidate)
+		cancel()
+		observeKeyVaultOperation(config, OperationGetCertificate, start, err)
+		if err != nil && !certstore.IsNotFound(err) {
+			return nil, err
+		}
+		if err == nil {
+			ownership := GetCertificateOwnership(existing.Tags, config, secret.Namespace, secret.Name)
+			if IsCertificateManageable(ownership, config.Spec.AdoptionPolicy) {
+				name = candidate
+			} else {
+				log.Log.Info("SyncSecretAKVController - Certificate matching the name template is owned by someone else, not adopting it: " + candidate)
+			}
+		}
+	}
+
+	if name == "" && (mode == apiv1alpha1.CertificateDiscoveryThumbprint || mode == apiv1alpha1.CertificateDiscoveryNameOrThumbprint) {
+		callCtx, cancel := keyVaultContext(ctx, OperationListCertificates)
+		start := time.Now()
+		certificates, err := store.List(callCtx)
+		cancel()
+		observeKeyVaultOperation(config, OperationListCertificates, start, err)
+		if err != nil {
+			return nil, err
+		}
+		name, _ = FindCertificateByThumbprint(certificates, thumbprint[:], config, secret)
+	}
+
+	if name == "" {
+		return nil, nil
+	}
+
+	// Tag the certificate as managed, keeping the tags set by whoever uploaded it
+	callCtx, cancel := keyVaultContext(ctx, OperationGetCertificate)
+	start := time.Now()
+	existing, err := store.Get(callCtx, name)
+	cancel()
+	observeKeyVaultOperation(config, OperationGetCertificate, start, err)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := AdoptionTags(config, secret, existing.Tags)
+	if err != nil {
+		return nil, err
+	}
+	identical := bytes.Equal(existing.Thumbprint, thumbprint[:])
+	if IsDryRun(config) {
+		log.Log.Info("SyncSecretAKVController - " + dryRunMessage("adopt existing Azure Key Vault Certificate: "+name))
+		return &DiscoveredCertificate{Name: name, Certificate: existing, Identical: identical}, nil
+	}
+	log.Log.Info("SyncSecretAKVController - Adopting existing Azure Key Vault Certificate per CertificateDiscovery " + string(mode) + ": " + name)
+	callCtx, cancel = keyVaultContext(ctx, OperationUpdateCertificate)
+	start = time.Now()
+	updated, err := store.SetTags(callCtx, name, tags)
+	cancel()
+	observeKeyVaultOperation(config, OperationUpdateCertificate, start, err)
+	if err != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Failed to tag Azure Key Vault Certificate as managed")
+		return nil, err
+	}
+
+	return &DiscoveredCertificate{
+		Name:        name,
+		Certificate: updated,
+		Identical:   identical,
+	}, nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"crypto/sha1"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+)
+
+var _ = Describe("Certificate discovery", func() {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "my-tls",
+			Namespace:   "payments",
+			Labels:      map[string]string{"app": "checkout"},
+			Annotations: map[string]string{"legacy-name": "checkout-prod-cert"},
+		},
+	}
+
+	item := func(name string, thumbprint []byte, tags map[string]string) *certstore.Certificate {
+		return &certstore.Certificate{Name: name, Thumbprint: thumbprint, Tags: tags}
+	}
+
+	It("should render the certificate name template", func() {
+		config := &apiv1alpha1.Config{}
+		Expect(RenderCertificateName(config, secret)).To(Equal("payments-my-tls"))
+
+		config.Spec.CertificateNameTemplate = `{{ index .Annotations "legacy-name" }}`
+		Expect(RenderCertificateName(config, secret)).To(Equal("checkout-prod-cert"))
+
+		config.Spec.CertificateNameTemplate = `{{ index .Annotations "missing" }}`
+		_, err := RenderCertificateName(config, secret)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should match certificates by thumbprint as allowed by the adoption policy", func() {
+		config := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{ClusterID: "blue"}}
+		thumbprint := sha1.Sum([]byte("certificate"))
+		foreign := OwnershipTags(&apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{ClusterID: "green"}}, secret.Namespace, secret.Name)
+		items := []*certstore.Certificate{
+			item("other", []byte("different"), nil),
+			item("green-copy", thumbprint[:], foreign),
+			item("uploaded-by-script", thumbprint[:], map[string]string{"owner": "ops"}),
+		}
+
+		// The default AdoptionPolicy Never does not take over untagged certificates
+		_, found := FindCertificateByThumbprint(items, thumbprint[:], config, secret)
+		Expect(found).To(BeFalse())
+
+		config.Spec.AdoptionPolicy = apiv1alpha1.AdoptionPolicyUnmanaged
+		name, found := FindCertificateByThumbprint(items, thumbprint[:], config, secret)
+		Expect(found).To(BeTrue())
+		Expect(name).To(Equal("uploaded-by-script"))
+
+		config.Spec.AdoptionPolicy = apiv1alpha1.AdoptionPolicyAlways
+		name, _ = FindCertificateByThumbprint(items, thumbprint[:], config, secret)
+		Expect(name).To(Equal("green-copy"))
+
+		_, found = FindCertificateByThumbprint(items[:1], thumbprint[:], config, secret)
+		Expect(found).To(BeFalse())
+	})
+
+	It("should tag adopted certificates as managed and keep their existing tags", func() {
+		config := &apiv1alpha1.Config{}
+		tags, err := AdoptionTags(config, secret, map[string]string{
+			"owner":                 "ops",
+			CertificateTagManagedBy: "script",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tags).To(HaveKeyWithValue("owner", "ops"))
+		Expect(GetCertificateOwnership(tags, config, secret.Namespace, secret.Name)).To(Equal(CertificateOwned))
+	})
+
+	It("should name the certificate after the adopted one", func() {
+		syncSecretAKV := &apiv1alpha1.SyncSecretAKV{ObjectMeta: metav1.ObjectMeta{Name: "my-tls", Namespace: "payments"}}
+		Expect(AzKeyVaultCertificateName(syncSecretAKV)).To(Equal("payments-my-tls"))
+
+		syncSecretAKV.Status.CertificateName = "checkout-prod-cert"
+		Expect(AzKeyVaultCertificateName(syncSecretAKV)).To(Equal("checkout-prod-cert"))
+	})
+})
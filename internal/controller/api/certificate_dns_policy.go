@@ -0,0 +1,153 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"crypto/x509"
+	"net"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+// CertificateDNSNames returns the DNS names of the certificate, falling back to the common name
+// when the certificate has no DNS subject alternative names
+func CertificateDNSNames(certificate *x509.Certificate) []string {
+	if len(certificate.DNSNames) > 0 {
+		return certificate.DNSNames
+	}
+	if certificate.Subject.CommonName != "" {
+		return []string{certificate.Subject.CommonName}
+	}
+	return nil
+}
+
+// CheckAllowedDNSNames enforces the Config AllowedDNSNames policies for a certificate synced from the namespace.
+// Without policies every DNS name is allowed. Otherwise every DNS name must match a pattern of a policy
+// selecting the namespace.
+func CheckAllowedDNSNames(config *apiv1alpha1.Config, namespace *corev1.Namespace, dnsNames []string) *CertificateValidationError {
+	if len(config.Spec.AllowedDNSNames) == 0 {
+		return nil
+	}
+
+	patterns, validationErr := namespacePatterns(config, namespace)
+	if validationErr != nil {
+		return validationErr
+	}
+	if len(dnsNames) == 0 {
+		return newValidationError(apiv1alpha1.ReasonDNSNameNotAllowed, "the certificate has no DNS names")
+	}
+
+	for _, dnsName := range dnsNames {
+		if !slices.ContainsFunc(patterns, func(pattern string) bool { return dnsNameMatches(pattern, dnsName) }) {
+			return newValidationError(apiv1alpha1.ReasonDNSNameNotAllowed, "DNS name %s is not allowed for namespace %s", dnsName, namespace.Name)
+		}
+	}
+	return nil
+}
+
+// CheckAllowedCertificateNames enforces the Config AllowedDNSNames policies on every name of the certificate.
+// The DNS names are checked by CheckAllowedDNSNames. IP address, URI and email subject alternative names are not
+// DNS names and wildcards never match them, they are only allowed when a pattern of the namespace lists them exactly.
+// The common name is only checked when the certificate has no subject alternative name at all.
+func CheckAllowedCertificateNames(config *apiv1alpha1.Config, namespace *corev1.Namespace, certificate *x509.Certificate) *CertificateValidationError {
+	if len(config.Spec.AllowedDNSNames) == 0 {
+		return nil
+	}
+
+	patterns, validationErr := namespacePatterns(config, namespace)
+	if validationErr != nil {
+		return validationErr
+	}
+	otherNames := len(certificate.IPAddresses) + len(certificate.URIs) + len(certificate.EmailAddresses)
+	if len(certificate.DNSNames) > 0 || otherNames == 0 {
+		if validationErr := CheckAllowedDNSNames(config, namespace, CertificateDNSNames(certificate)); validationErr != nil {
+			return validationErr
+		}
+	}
+	for _, ip := range certificate.IPAddresses {
+		if !slices.ContainsFunc(patterns, func(pattern string) bool { return ip.Equal(net.ParseIP(pattern)) }) {
+			return newValidationError(apiv1alpha1.ReasonDNSNameNotAllowed, "IP address %s is not allowed for namespace %s", ip, namespace.Name)
+		}
+	}
+	for _, uri := range certificate.URIs {
+		if !slices.Contains(patterns, uri.String()) {
+			return newValidationError(apiv1alpha1.ReasonDNSNameNotAllowed, "URI %s is not allowed for namespace %s", uri, namespace.Name)
+		}
+	}
+	for _, email := range certificate.EmailAddresses {
+		if !slices.ContainsFunc(patterns, func(pattern string) bool { return strings.EqualFold(pattern, email) }) {
+			return newValidationError(apiv1alpha1.ReasonDNSNameNotAllowed, "email address %s is not allowed for namespace %s", email, namespace.Name)
+		}
+	}
+	return nil
+}
+
+// namespacePatterns returns the patterns of the AllowedDNSNames policies selecting the namespace
+func namespacePatterns(config *apiv1alpha1.Config, namespace *corev1.Namespace) ([]string, *CertificateValidationError) {
+	var patterns []string
+	for _, policy := range config.Spec.AllowedDNSNames {
+		selected, err := policySelectsNamespace(policy, namespace)
+		if err != nil {
+			return nil, newValidationError(apiv1alpha1.ReasonNamespaceNotAllowed, "invalid namespace selector in allowedDNSNames: %v", err)
+		}
+		if selected {
+			patterns = append(patterns, policy.Patterns...)
+		}
+	}
+	if len(patterns) == 0 {
+		return nil, newValidationError(apiv1alpha1.ReasonNamespaceNotAllowed, "no allowedDNSNames policy applies to namespace %s", namespace.Name)
+	}
+	return patterns, nil
+}
+
+func policySelectsNamespace(policy apiv1alpha1.DNSNamePolicy, namespace *corev1.Namespace) (bool, error) {
+	if slices.Contains(policy.Namespaces, namespace.Name) {
+		return true, nil
+	}
+	if policy.NamespaceSelector == nil {
+		return false, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(policy.NamespaceSelector)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(namespace.Labels)), nil
+}
+
+// dnsNameMatches compares a DNS name against an exact pattern or a wildcard pattern such as "*.example.com".
+// A wildcard matches exactly one leftmost label, so "*.example.com" matches "app.example.com" but not
+// "example.com" or "a.b.example.com". A wildcard DNS name only matches an identical wildcard pattern.
+func dnsNameMatches(pattern string, dnsName string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	dnsName = strings.ToLower(strings.TrimSuffix(dnsName, "."))
+
+	if pattern == dnsName {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(pattern, "*.")
+	if !ok {
+		return false
+	}
+	label, rest, found := strings.Cut(dnsName, ".")
+	return found && label != "" && label != "*" && rest == suffix
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"crypto/x509"
+	"net"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+var _ = Describe("Certificate DNS name policy", func() {
+	config := &apiv1alpha1.Config{
+		Spec: apiv1alpha1.ConfigSpec{
+			AllowedDNSNames: []apiv1alpha1.DNSNamePolicy{
+				{
+					Namespaces: []string{"gateway"},
+					Patterns:   []string{"www.example.com", "*.example.com"},
+				},
+				{
+					NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}},
+					Patterns:          []string{"*.payments.example.com"},
+				},
+			},
+		},
+	}
+
+	namespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+
+	It("should allow everything when no policy is configured", func() {
+		Expect(CheckAllowedDNSNames(&apiv1alpha1.Config{}, namespace("any", nil), []string{"evil.com"})).To(BeNil())
+	})
+
+	It("should allow DNS names matching a policy selecting the namespace", func() {
+		Expect(CheckAllowedDNSNames(config, namespace("gateway", nil), []string{"www.example.com", "api.example.com"})).To(BeNil())
+		Expect(CheckAllowedDNSNames(config, namespace("checkout", map[string]string{"team": "payments"}), []string{"pay.payments.example.com"})).To(BeNil())
+	})
+
+	It("should reject namespaces no policy selects", func() {
+		validationErr := CheckAllowedDNSNames(config, namespace("tenant", nil), []string{"www.example.com"})
+		Expect(validationErr).NotTo(BeNil())
+		Expect(validationErr.Reason).To(Equal(apiv1alpha1.ReasonNamespaceNotAllowed))
+	})
+
+	It("should reject DNS names outside the namespace patterns", func() {
+		validationErr := CheckAllowedDNSNames(config, namespace("checkout", map[string]string{"team": "payments"}), []string{"www.example.com"})
+		Expect(validationErr).NotTo(BeNil())
+		Expect(validationErr.Reason).To(Equal(apiv1alpha1.ReasonDNSNameNotAllowed))
+
+		validationErr = CheckAllowedDNSNames(config, namespace("gateway", nil), []string{"api.example.com", "evil.com"})
+		Expect(validationErr).NotTo(BeNil())
+		Expect(validationErr.Reason).To(Equal(apiv1alpha1.ReasonDNSNameNotAllowed))
+	})
+
+	It("should only allow IP address, URI and email names listed exactly", func() {
+		policy := config.DeepCopy()
+		policy.Spec.AllowedDNSNames[0].Patterns = append(policy.Spec.AllowedDNSNames[0].Patterns, "10.0.0.1", "spiffe://example.com/gateway")
+		gateway := namespace("gateway", nil)
+		spiffe, err := url.Parse("spiffe://example.com/gateway")
+		Expect(err).NotTo(HaveOccurred())
+		other, err := url.Parse("spiffe://example.com/admin")
+		Expect(err).NotTo(HaveOccurred())
+
+		ipOnly := &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("10.0.0.1")}}
+		Expect(CheckAllowedCertificateNames(policy, gateway, ipOnly)).To(BeNil())
+		Expect(CheckAllowedCertificateNames(config, gateway, ipOnly)).NotTo(BeNil())
+
+		ipOnly.IPAddresses = append(ipOnly.IPAddresses, net.ParseIP("192.168.0.1"))
+		validationErr := CheckAllowedCertificateNames(policy, gateway, ipOnly)
+		Expect(validationErr).NotTo(BeNil())
+		Expect(validationErr.Reason).To(Equal(apiv1alpha1.ReasonDNSNameNotAllowed))
+		Expect(validationErr.Message).To(ContainSubstring("192.168.0.1"))
+
+		Expect(CheckAllowedCertificateNames(policy, gateway, &x509.Certificate{DNSNames: []string{"app.example.com"}, URIs: []*url.URL{spiffe}})).To(BeNil())
+		Expect(CheckAllowedCertificateNames(policy, gateway, &x509.Certificate{DNSNames: []string{"app.example.com"}, URIs: []*url.URL{other}})).NotTo(BeNil())
+		Expect(CheckAllowedCertificateNames(policy, gateway, &x509.Certificate{DNSNames: []string{"app.example.com"}, EmailAddresses: []string{"ops@example.com"}})).NotTo(BeNil())
+		Expect(CheckAllowedCertificateNames(policy, gateway, &x509.Certificate{DNSNames: []string{"evil.com"}, URIs: []*url.URL{spiffe}})).NotTo(BeNil())
+	})
+
+	It("should match wildcards against a single label", func() {
+		Expect(dnsNameMatches("*.example.com", "app.example.com")).To(BeTrue())
+		Expect(dnsNameMatches("*.example.com", "APP.Example.com.")).To(BeTrue())
+		Expect(dnsNameMatches("*.example.com", "*.example.com")).To(BeTrue())
+		Expect(dnsNameMatches("*.example.com", "example.com")).To(BeFalse())
+		Expect(dnsNameMatches("*.example.com", "a.b.example.com")).To(BeFalse())
+		Expect(dnsNameMatches("*.example.com", "*.payments.example.com")).To(BeFalse())
+		Expect(dnsNameMatches("www.example.com", "api.example.com")).To(BeFalse())
+	})
+})
@@ -0,0 +1,159 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+)
+
+// Tags written to every certificate imported by the controller. They record which
+// cluster and which Secret own the certificate so that certificates created by
+// other teams or other clusters are never overwritten or purged by accident.
+const (
+	CertificateTagManagedBy  = "managed-by"
+	CertificateTagClusterID  = "syncsecretakv-cluster-id"
+	CertificateTagNamespace  = "syncsecretakv-namespace"
+	CertificateTagSecretName = "syncsecretakv-secret-name"
+
+	// CertificateManagedByValue is the value of the managed-by tag for certificates owned by this controller
+	CertificateManagedByValue = "syncsecretakv"
+
+	// DefaultClusterID is used when the Config does not set a ClusterID
+	DefaultClusterID = "default"
+)
+
+// ErrCertificateNotOwned is returned when the target certificate exists in Azure Key Vault but is
+// owned by someone else and the Config AdoptionPolicy does not allow taking it over.
+var ErrCertificateNotOwned = errors.New("certificate exists in azure key vault and is not owned by this controller")
+
+// CertificateOwnership describes who owns an existing Azure Key Vault certificate
+type CertificateOwnership string
+
+const (
+	// CertificateOwned means the certificate is tagged with this cluster and this Secret
+	CertificateOwned CertificateOwnership = "Owned"
+	// CertificateUnmanaged means the certificate carries no managed-by tag
+	CertificateUnmanaged CertificateOwnership = "Unmanaged"
+	// CertificateForeign means the certificate is managed, but by another cluster, Secret or tool
+	CertificateForeign CertificateOwnership = "Foreign"
+)
+
+// ClusterIDForConfig returns the cluster ID configured in the Config, falling back to DefaultClusterID
+func ClusterIDForConfig(config *apiv1alpha1.Config) string {
+	if config.Spec.ClusterID == "" {
+		return DefaultClusterID
+	}
+	return config.Spec.ClusterID
+}
+
+// HasExplicitClusterID reports whether the Config sets a ClusterID other than DefaultClusterID. Clusters sharing
+// a vault without one all tag their certificates with the same cluster ID.
+func HasExplicitClusterID(config *apiv1alpha1.Config) bool {
+	return config.Spec.ClusterID != "" && config.Spec.ClusterID != DefaultClusterID
+}
+
+// OwnershipTags returns the tags identifying the certificate as owned by the given Secret in this cluster
+func OwnershipTags(config *apiv1alpha1.Config, namespace string, secretName string) map[string]string {
+	return map[string]string{
+		CertificateTagManagedBy:  CertificateManagedByValue,
+		CertificateTagClusterID:  ClusterIDForConfig(config),
+		CertificateTagNamespace:  namespace,
+		CertificateTagSecretName: secretName,
+	}
+}
+
+// GetCertificateOwnership compares the tags of an existing certificate against the ownership tags expected for the Secret
+func GetCertificateOwnership(tags map[string]string, config *apiv1alpha1.Config, namespace string, secretName string) CertificateOwnership {
+	if tags[CertificateTagManagedBy] == "" {
+		return CertificateUnmanaged
+	}
+
+	for key, expected := range OwnershipTags(config, namespace, secretName) {
+		if value, ok := tags[key]; !ok || value != expected {
+			return CertificateForeign
+		}
+	}
+	return CertificateOwned
+}
+
+// IsCertificateManageable reports whether the controller may update or delete a certificate with the given ownership
+func IsCertificateManageable(ownership CertificateOwnership, policy apiv1alpha1.CertificateAdoptionPolicy) bool {
+	switch ownership {
+	case CertificateOwned:
+		return true
+	case CertificateUnmanaged:
+		return policy == apiv1alpha1.AdoptionPolicyUnmanaged || policy == apiv1alpha1.AdoptionPolicyAlways
+	default:
+		return policy == apiv1alpha1.AdoptionPolicyAlways
+	}
+}
+
+// HasSyncedCertificate reports whether the SyncSecretAKV shows that this controller already imported its certificate
+// into the store of the Config: an earlier sync recorded the Secret resource version it imported, as controller
+// versions before the ownership tags did, or the certificate ID. A SyncSecretAKV last synced to another vault does not.
+func HasSyncedCertificate(syncSecretAKV *apiv1alpha1.SyncSecretAKV, config *apiv1alpha1.Config) bool {
+	if syncSecretAKV.Status.VaultURL != "" && syncSecretAKV.Status.VaultURL != StoreURL(config) {
+		return false
+	}
+	return syncSecretAKV.Spec.SyncSecretAKVResourceVersion != "" || syncSecretAKV.Status.CertificateID != ""
+}
+
+// IsLegacyCertificate reports whether a certificate without managed-by tag has the default name of the Secret and
+// was synced by this controller, see HasSyncedCertificate. Controller versions before the ownership tags imported
+// every Secret under that name without tags, so such a certificate is treated as owned and tagged on the next
+// reconcile. Other untagged certificates follow the AdoptionPolicy.
+func IsLegacyCertificate(ownership CertificateOwnership, azKeyVaultCertificateName string, secretName types.NamespacedName, synced bool) bool {
+	return synced && ownership == CertificateUnmanaged && azKeyVaultCertificateName == secretName.Namespace+"-"+secretName.Name
+}
+
+// TagLegacyCertificate adds the ownership tags to a legacy certificate, keeping the tags it already has.
+// In dry run the certificate is not tagged.
+func TagLegacyCertificate(ctx context.Context, store certstore.Store, config *apiv1alpha1.Config, azKeyVaultCertificateName string, secretName types.NamespacedName, existing map[string]string) error {
+
+	if IsDryRun(config) {
+		log.Log.Info("SyncSecretAKVController - " + dryRunMessage("tag legacy Azure Key Vault Certificate with the ownership tags: "+azKeyVaultCertificateName))
+		return nil
+	}
+
+	tags := map[string]string{}
+	for key, value := range existing {
+		tags[key] = value
+	}
+	for key, value := range OwnershipTags(config, secretName.Namespace, secretName.Name) {
+		tags[key] = value
+	}
+
+	log.Log.Info("SyncSecretAKVController - Tagging legacy Azure Key Vault Certificate with the ownership tags: " + azKeyVaultCertificateName)
+	callCtx, cancel := keyVaultContext(ctx, OperationUpdateCertificate)
+	start := time.Now()
+	_, err := store.SetTags(callCtx, azKeyVaultCertificateName, tags)
+	cancel()
+	observeKeyVaultOperation(config, OperationUpdateCertificate, start, err)
+	if err != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Failed to tag legacy Azure Key Vault Certificate")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+var _ = Describe("Certificate ownership", func() {
+	config := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{ClusterID: "cluster-a"}}
+
+	It("should recognize certificates tagged for the same Secret", func() {
+		tags := OwnershipTags(config, "default", "my-tls")
+		Expect(GetCertificateOwnership(tags, config, "default", "my-tls")).To(Equal(CertificateOwned))
+	})
+
+	It("should treat certificates without a managed-by tag as unmanaged", func() {
+		tags := map[string]string{"team": "payments"}
+		Expect(GetCertificateOwnership(tags, config, "default", "my-tls")).To(Equal(CertificateUnmanaged))
+		Expect(GetCertificateOwnership(nil, config, "default", "my-tls")).To(Equal(CertificateUnmanaged))
+	})
+
+	It("should treat certificates owned by another cluster or Secret as foreign", func() {
+		other := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{ClusterID: "cluster-b"}}
+		Expect(GetCertificateOwnership(OwnershipTags(other, "default", "my-tls"), config, "default", "my-tls")).To(Equal(CertificateForeign))
+		Expect(GetCertificateOwnership(OwnershipTags(config, "default", "other-tls"), config, "default", "my-tls")).To(Equal(CertificateForeign))
+	})
+
+	It("should fall back to the default cluster ID", func() {
+		Expect(ClusterIDForConfig(&apiv1alpha1.Config{})).To(Equal(DefaultClusterID))
+	})
+
+	It("should only manage foreign certificates when the adoption policy allows it", func() {
+		Expect(IsCertificateManageable(CertificateOwned, apiv1alpha1.AdoptionPolicyNever)).To(BeTrue())
+		Expect(IsCertificateManageable(CertificateUnmanaged, "")).To(BeFalse())
+		Expect(IsCertificateManageable(CertificateUnmanaged, apiv1alpha1.AdoptionPolicyNever)).To(BeFalse())
+		Expect(IsCertificateManageable(CertificateUnmanaged, apiv1alpha1.AdoptionPolicyUnmanaged)).To(BeTrue())
+		Expect(IsCertificateManageable(CertificateForeign, apiv1alpha1.AdoptionPolicyUnmanaged)).To(BeFalse())
+		Expect(IsCertificateManageable(CertificateForeign, apiv1alpha1.AdoptionPolicyAlways)).To(BeTrue())
+	})
+
+	It("should treat untagged certificates under the default name as legacy once synced", func() {
+		secretName := types.NamespacedName{Namespace: "default", Name: "my-tls"}
+		Expect(IsLegacyCertificate(CertificateUnmanaged, "default-my-tls", secretName, true)).To(BeTrue())
+		Expect(IsLegacyCertificate(CertificateUnmanaged, "default-my-tls", secretName, false)).To(BeFalse())
+		Expect(IsLegacyCertificate(CertificateUnmanaged, "checkout-prod-cert", secretName, true)).To(BeFalse())
+		Expect(IsLegacyCertificate(CertificateForeign, "default-my-tls", secretName, true)).To(BeFalse())
+	})
+
+	It("should only find an earlier sync to the store of the Config", func() {
+		config := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{AzKeyVaultURL: "https://vault.vault.azure.net/"}}
+		syncSecretAKV := &apiv1alpha1.SyncSecretAKV{}
+		Expect(HasSyncedCertificate(syncSecretAKV, config)).To(BeFalse())
+
+		syncSecretAKV.Spec.SyncSecretAKVResourceVersion = "42"
+		Expect(HasSyncedCertificate(syncSecretAKV, config)).To(BeTrue())
+
+		syncSecretAKV.Spec.SyncSecretAKVResourceVersion = ""
+		syncSecretAKV.Status.CertificateID = "https://vault.vault.azure.net/certificates/default-my-tls/1"
+		syncSecretAKV.Status.VaultURL = config.Spec.AzKeyVaultURL
+		Expect(HasSyncedCertificate(syncSecretAKV, config)).To(BeTrue())
+
+		syncSecretAKV.Status.VaultURL = "https://other.vault.azure.net/"
+		Expect(HasSyncedCertificate(syncSecretAKV, config)).To(BeFalse())
+	})
+})
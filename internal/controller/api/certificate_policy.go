@@ -0,0 +1,184 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+)
+
+// certificatePolicyDrifted reports whether the fields set in the Config differ from the current policy of the certificate.
+// Content type is not compared here since it can only be corrected by importing the certificate again.
+func certificatePolicyDrifted(spec *apiv1alpha1.CertificatePolicySpec, current *apiv1alpha1.CertificatePolicySpec) bool {
+	if current == nil {
+		return true
+	}
+
+	if boolDrifted(spec.Exportable, current.Exportable) || boolDrifted(spec.ReuseKey, current.ReuseKey) {
+		return true
+	}
+
+	if len(spec.EmailNotifications) == 0 {
+		return false
+	}
+	if len(spec.EmailNotifications) != len(current.EmailNotifications) {
+		return true
+	}
+	for i, notification := range spec.EmailNotifications {
+		if int32Drifted(notification.DaysBeforeExpiry, current.EmailNotifications[i].DaysBeforeExpiry) ||
+			int32Drifted(notification.LifetimePercentage, current.EmailNotifications[i].LifetimePercentage) {
+			return true
+		}
+	}
+	return false
+}
+
+// certificateContentTypeDrifted reports whether the certificate was imported with a different content type than configured
+func certificateContentTypeDrifted(spec *apiv1alpha1.CertificatePolicySpec, current *apiv1alpha1.CertificatePolicySpec) bool {
+	if spec.ContentType == "" {
+		return false
+	}
+	if current == nil || current.ContentType == "" {
+		return true
+	}
+	return current.ContentType != spec.ContentType
+}
+
+// certificateAttributesDrifted reports whether the enabled state differs from the configured one
+func certificateAttributesDrifted(spec *apiv1alpha1.CertificatePolicySpec, current *apiv1alpha1.CertificatePolicySpec) bool {
+	if spec.Enabled == nil {
+		return false
+	}
+	if current == nil {
+		return true
+	}
+	return boolDrifted(spec.Enabled, current.Enabled)
+}
+
+func boolDrifted(desired *bool, current *bool) bool {
+	return desired != nil && (current == nil || *desired != *current)
+}
+
+func int32Drifted(desired *int32, current *int32) bool {
+	if desired == nil {
+		return current != nil
+	}
+	return current == nil || *desired != *current
+}
+
+// CertificateRepairResult describes what RepairCertificatePolicy found and corrected
+type CertificateRepairResult struct {
+	// Reimport is true when the certificate has to be imported again, either because it no longer exists
+	// in the vault or because its content type drifted
+	Reimport          bool
+	PolicyUpdated     bool
+	AttributesUpdated bool
+	// DryRun is true when drift was found but not corrected because the Config is in dry run
+	DryRun bool
+}
+
+// RepairCertificatePolicy compares the existing certificate with the Config certificate policy and corrects drift
+// in its policy and attributes. Stores without policies are only checked for the existence of the certificate.
+// synced tells whether the SyncSecretAKV of the Secret shows an earlier sync, see HasSyncedCertificate.
+// In dry run drift is only reported.
+func RepairCertificatePolicy(ctx context.Context, store certstore.Store, config *apiv1alpha1.Config, azKeyVaultCertificateName string, secretName types.NamespacedName, synced bool) (CertificateRepairResult, error) {
+
+	result := CertificateRepairResult{}
+
+	callCtx, cancel := keyVaultContext(ctx, OperationGetCertificate)
+	start := time.Now()
+	existing, err := store.Get(callCtx, azKeyVaultCertificateName)
+	cancel()
+	observeKeyVaultOperation(config, OperationGetCertificate, start, err)
+	if err != nil {
+		if certstore.IsNotFound(err) {
+			log.Log.Info("SyncSecretAKVController - Azure Key Vault Certificate not found, it will be imported again: " + azKeyVaultCertificateName)
+			result.Reimport = true
+			return result, nil
+		}
+		return result, err
+	}
+
+	ownership := GetCertificateOwnership(existing.Tags, config, secretName.Namespace, secretName.Name)
+	if IsLegacyCertificate(ownership, azKeyVaultCertificateName, secretName, synced) {
+		if err := TagLegacyCertificate(ctx, store, config, azKeyVaultCertificateName, secretName, existing.Tags); err != nil {
+			return result, err
+		}
+		ownership = CertificateOwned
+	}
+
+	spec := config.Spec.CertificatePolicy
+	policyStore, ok := store.(certstore.PolicyStore)
+	if spec == nil || !ok {
+		return result, nil
+	}
+
+	if !IsCertificateManageable(ownership, config.Spec.AdoptionPolicy) {
+		log.Log.Info("SyncSecretAKVController - Refusing to repair Azure Key Vault Certificate not owned by this controller: " + azKeyVaultCertificateName + ", Ownership: " + string(ownership))
+		return result, ErrCertificateNotOwned
+	}
+
+	if certificateContentTypeDrifted(spec, existing.Policy) {
+		log.Log.Info("SyncSecretAKVController - Azure Key Vault Certificate content type drifted, it will be imported again: " + azKeyVaultCertificateName)
+		result.Reimport = true
+		return result, nil
+	}
+
+	if IsDryRun(config) {
+		result.DryRun = certificatePolicyDrifted(spec, existing.Policy) || certificateAttributesDrifted(spec, existing.Policy)
+		if result.DryRun {
+			log.Log.Info("SyncSecretAKVController - " + dryRunMessage("repair the drifted policy or attributes of Azure Key Vault Certificate: "+azKeyVaultCertificateName))
+		}
+		return result, nil
+	}
+
+	if certificatePolicyDrifted(spec, existing.Policy) {
+		log.Log.Info("SyncSecretAKVController - Azure Key Vault Certificate policy drifted, updating policy: " + azKeyVaultCertificateName)
+		callCtx, cancel := keyVaultContext(ctx, OperationUpdateCertificatePolicy)
+		start := time.Now()
+		err := policyStore.UpdatePolicy(callCtx, azKeyVaultCertificateName, spec)
+		cancel()
+		observeKeyVaultOperation(config, OperationUpdateCertificatePolicy, start, err)
+		if err != nil {
+			log.Log.Error(err, "SyncSecretAKVController - Failed to update Azure Key Vault Certificate policy")
+			return result, err
+		}
+		result.PolicyUpdated = true
+	}
+
+	if certificateAttributesDrifted(spec, existing.Policy) {
+		log.Log.Info("SyncSecretAKVController - Azure Key Vault Certificate attributes drifted, updating attributes: " + azKeyVaultCertificateName)
+		callCtx, cancel := keyVaultContext(ctx, OperationUpdateCertificate)
+		start := time.Now()
+		err := policyStore.UpdateAttributes(callCtx, azKeyVaultCertificateName, spec)
+		cancel()
+		observeKeyVaultOperation(config, OperationUpdateCertificate, start, err)
+		if err != nil {
+			log.Log.Error(err, "SyncSecretAKVController - Failed to update Azure Key Vault Certificate attributes")
+			return result, err
+		}
+		result.AttributesUpdated = true
+	}
+
+	return result, nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+var _ = Describe("Certificate policy", func() {
+	spec := &apiv1alpha1.CertificatePolicySpec{
+		Exportable: ptr.To(true),
+		ReuseKey:   ptr.To(false),
+		Enabled:    ptr.To(true),
+		EmailNotifications: []apiv1alpha1.CertificateEmailNotification{
+			{DaysBeforeExpiry: ptr.To(int32(30))},
+		},
+	}
+	current := func() *apiv1alpha1.CertificatePolicySpec {
+		current := spec.DeepCopy()
+		current.ContentType = apiv1alpha1.CertificateContentTypePEM
+		return current
+	}
+
+	It("should not report drift when the store matches the Config", func() {
+		Expect(certificatePolicyDrifted(spec, current())).To(BeFalse())
+		Expect(certificateContentTypeDrifted(spec, current())).To(BeFalse())
+		Expect(certificateAttributesDrifted(spec, current())).To(BeFalse())
+	})
+
+	It("should report drift in key properties, lifetime actions and attributes", func() {
+		drifted := current()
+		drifted.Exportable = ptr.To(false)
+		Expect(certificatePolicyDrifted(spec, drifted)).To(BeTrue())
+
+		drifted = current()
+		drifted.EmailNotifications[0].DaysBeforeExpiry = ptr.To(int32(10))
+		Expect(certificatePolicyDrifted(spec, drifted)).To(BeTrue())
+
+		drifted = current()
+		drifted.Enabled = ptr.To(false)
+		Expect(certificateAttributesDrifted(spec, drifted)).To(BeTrue())
+
+		pkcs12Spec := &apiv1alpha1.CertificatePolicySpec{ContentType: apiv1alpha1.CertificateContentTypePKCS12}
+		Expect(certificateContentTypeDrifted(pkcs12Spec, current())).To(BeTrue())
+		Expect(certificatePolicyDrifted(spec, nil)).To(BeTrue())
+	})
+})
@@ -0,0 +1,83 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+)
+
+// RecordSyncAttempt updates the attempt bookkeeping of the status. A successful attempt sets LastSyncTime
+// and resets AttemptCount, a failed one increments AttemptCount.
+func RecordSyncAttempt(status *apiv1alpha1.SyncSecretAKVStatus, generation int64, success bool, now time.Time) {
+	attemptTime := metav1.NewTime(now)
+	status.LastAttemptTime = &attemptTime
+	status.ObservedGeneration = generation
+	if success {
+		status.LastSyncTime = &attemptTime
+		status.AttemptCount = 0
+	} else {
+		status.AttemptCount++
+	}
+}
+
+// RecordCertificateStatus copies the store identifiers of the imported certificate and the metadata of the leaf
+// certificate into the status
+func RecordCertificateStatus(status *apiv1alpha1.SyncSecretAKVStatus, vaultURL string, certificate *certstore.Certificate, leaf *x509.Certificate) {
+	status.VaultURL = vaultURL
+	status.CertificateID = ""
+	status.CertificateVersion = ""
+	if certificate != nil {
+		status.CertificateID = certificate.ID
+		status.CertificateVersion = certificate.Version
+	}
+
+	// Key Vault reports the x5t thumbprint, compute it from the certificate when the response lacks it
+	if certificate != nil && len(certificate.Thumbprint) > 0 {
+		status.Thumbprint = base64.RawURLEncoding.EncodeToString(certificate.Thumbprint)
+	} else {
+		thumbprint := sha1.Sum(leaf.Raw)
+		status.Thumbprint = base64.RawURLEncoding.EncodeToString(thumbprint[:])
+	}
+
+	notBefore := metav1.NewTime(leaf.NotBefore)
+	notAfter := metav1.NewTime(leaf.NotAfter)
+	status.Subject = leaf.Subject.String()
+	status.DNSNames = leaf.DNSNames
+	status.NotBefore = &notBefore
+	status.NotAfter = &notAfter
+}
+
+// VaultURLChanged reports whether the certificate was last synced to another Azure Key Vault than the one
+// of the Config, in which case it has to be imported into the new vault
+func VaultURLChanged(status *apiv1alpha1.SyncSecretAKVStatus, vaultURL string) bool {
+	if status.VaultURL == "" {
+		return false
+	}
+	normalize := func(url string) string {
+		return strings.TrimSuffix(strings.ToLower(url), "/")
+	}
+	return normalize(status.VaultURL) != normalize(vaultURL)
+}
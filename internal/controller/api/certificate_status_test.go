@@ -0,0 +1,77 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+)
+
+var _ = Describe("Certificate status", func() {
+	It("should count failed attempts until a successful sync", func() {
+		status := &apiv1alpha1.SyncSecretAKVStatus{}
+		now := time.Now()
+
+		RecordSyncAttempt(status, 2, false, now)
+		RecordSyncAttempt(status, 2, false, now)
+		Expect(status.AttemptCount).To(Equal(int32(2)))
+		Expect(status.LastSyncTime).To(BeNil())
+		Expect(status.ObservedGeneration).To(Equal(int64(2)))
+
+		RecordSyncAttempt(status, 3, true, now)
+		Expect(status.AttemptCount).To(BeZero())
+		Expect(status.LastSyncTime).NotTo(BeNil())
+		Expect(status.LastAttemptTime).To(Equal(status.LastSyncTime))
+		Expect(status.ObservedGeneration).To(Equal(int64(3)))
+	})
+
+	It("should record the Key Vault identifiers and certificate metadata", func() {
+		leaf := newTestCertificate([]string{"app.example.com"}, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour), nil)
+		certificate := &certstore.Certificate{
+			Name:    "default-app",
+			ID:      "https://vault.vault.azure.net/certificates/default-app/0123456789abcdef",
+			Version: "0123456789abcdef",
+		}
+		status := &apiv1alpha1.SyncSecretAKVStatus{}
+
+		RecordCertificateStatus(status, "https://vault.vault.azure.net/", certificate, leaf.Certificate)
+		thumbprint := sha1.Sum(leaf.Certificate.Raw)
+		Expect(status.VaultURL).To(Equal("https://vault.vault.azure.net/"))
+		Expect(status.CertificateID).To(Equal(certificate.ID))
+		Expect(status.CertificateVersion).To(Equal("0123456789abcdef"))
+		Expect(status.Thumbprint).To(Equal(base64.RawURLEncoding.EncodeToString(thumbprint[:])))
+		Expect(status.Subject).To(Equal("CN=app.example.com"))
+		Expect(status.DNSNames).To(ConsistOf("app.example.com"))
+		Expect(status.NotAfter.Time.Unix()).To(Equal(leaf.Certificate.NotAfter.Unix()))
+	})
+
+	It("should detect a change of the Azure Key Vault URL", func() {
+		status := &apiv1alpha1.SyncSecretAKVStatus{}
+		Expect(VaultURLChanged(status, "https://new.vault.azure.net/")).To(BeFalse())
+
+		status.VaultURL = "https://old.vault.azure.net/"
+		Expect(VaultURLChanged(status, "https://OLD.vault.azure.net")).To(BeFalse())
+		Expect(VaultURLChanged(status, "https://new.vault.azure.net/")).To(BeTrue())
+	})
+})
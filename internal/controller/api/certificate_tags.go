@@ -0,0 +1,154 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+const (
+	// MaxCertificateTags is the maximum number of tags Azure Key Vault accepts on a certificate
+	MaxCertificateTags = 15
+
+	// MaxCertificateTagNameLength is the maximum length of a tag name accepted by Azure Key Vault
+	MaxCertificateTagNameLength = 512
+
+	// MaxCertificateTagValueLength is the maximum length of a tag value accepted by Azure Key Vault
+	MaxCertificateTagValueLength = 256
+
+	// invalidCertificateTagNameCharacters are rejected by Azure in tag names, they are replaced with an underscore
+	invalidCertificateTagNameCharacters = `<>%&\?/`
+)
+
+// certificateTagTemplateData is the data available to Config.Spec.CertificateTagTemplates
+type certificateTagTemplateData struct {
+	Namespace   string
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// BuildCertificateTags returns the tags to set on the Azure Key Vault certificate for the Secret.
+// Tags are added by precedence: ownership tags, static tags, rendered templates, propagated labels
+// and propagated annotations. A key set by a higher precedence source is never overridden, and tags
+// beyond the Azure Key Vault limit of 15 are dropped. Keys and values are made valid for Azure Key Vault first,
+// see SanitizeCertificateTagName and TruncateCertificateTagValue.
+func BuildCertificateTags(config *apiv1alpha1.Config, secret *corev1.Secret) (map[string]string, error) {
+
+	tags := OwnershipTags(config, secret.Namespace, secret.Name)
+
+	addTag := func(key string, value string, source string) {
+		key, ok := SanitizeCertificateTagName(key)
+		if !ok {
+			log.Log.Info("SyncSecretAKVController - Invalid Azure Key Vault tag name, dropping tag from " + source + ": " + key)
+			return
+		}
+		if _, exists := tags[key]; exists {
+			return
+		}
+		if len(tags) >= MaxCertificateTags {
+			log.Log.Info("SyncSecretAKVController - Azure Key Vault tag limit reached, dropping tag from " + source + ": " + key)
+			return
+		}
+		tags[key] = TruncateCertificateTagValue(value)
+	}
+
+	for _, key := range sortedKeys(config.Spec.CertificateTags) {
+		addTag(key, config.Spec.CertificateTags[key], "certificateTags")
+	}
+
+	data := certificateTagTemplateData{
+		Namespace:   secret.Namespace,
+		Name:        secret.Name,
+		Labels:      secret.Labels,
+		Annotations: secret.Annotations,
+	}
+	for _, key := range sortedKeys(config.Spec.CertificateTagTemplates) {
+		tmpl, err := template.New(key).Option("missingkey=zero").Parse(config.Spec.CertificateTagTemplates[key])
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificateTagTemplates entry %q: %w", key, err)
+		}
+		var value bytes.Buffer
+		if err := tmpl.Execute(&value, data); err != nil {
+			return nil, fmt.Errorf("unable to render certificateTagTemplates entry %q: %w", key, err)
+		}
+		addTag(key, value.String(), "certificateTagTemplates")
+	}
+
+	for _, key := range config.Spec.PropagateLabels {
+		if value, ok := secret.Labels[key]; ok {
+			addTag(key, value, "propagateLabels")
+		}
+	}
+
+	for _, key := range config.Spec.PropagateAnnotations {
+		if value, ok := secret.Annotations[key]; ok {
+			addTag(key, value, "propagateAnnotations")
+		}
+	}
+
+	return tags, nil
+}
+
+// SanitizeCertificateTagName replaces the characters Azure rejects in tag names, such as the slash of prefixed
+// label keys, with an underscore. It reports false for names that cannot be made valid: empty names and names
+// longer than MaxCertificateTagNameLength.
+func SanitizeCertificateTagName(key string) (string, bool) {
+	key = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(invalidCertificateTagNameCharacters, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.ToValidUTF8(key, "_"))
+	if strings.TrimSpace(key) == "" || len(key) > MaxCertificateTagNameLength {
+		return key, false
+	}
+	return key, true
+}
+
+// TruncateCertificateTagValue truncates the value to MaxCertificateTagValueLength bytes without splitting a
+// multi-byte character, which Azure Key Vault would reject
+func TruncateCertificateTagValue(value string) string {
+	value = strings.ToValidUTF8(value, "")
+	if len(value) <= MaxCertificateTagValueLength {
+		return value
+	}
+	end := MaxCertificateTagValueLength
+	for end > 0 && !utf8.RuneStart(value[end]) {
+		end--
+	}
+	return value[:end]
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+var _ = Describe("Certificate tags", func() {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "my-tls",
+			Namespace:   "payments",
+			Labels:      map[string]string{"team": "checkout", "ignored": "x"},
+			Annotations: map[string]string{"cost-center": "cc-42"},
+		},
+	}
+
+	tagValue := func(tags map[string]string, key string) string {
+		Expect(tags).To(HaveKey(key))
+		return tags[key]
+	}
+
+	It("should combine ownership, static, template, label and annotation tags", func() {
+		config := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{
+			CertificateTags:         map[string]string{"env": "prod"},
+			CertificateTagTemplates: map[string]string{"source": "{{ .Namespace }}/{{ .Name }}", "owner": `{{ index .Labels "team" }}`},
+			PropagateLabels:         []string{"team", "missing"},
+			PropagateAnnotations:    []string{"cost-center"},
+		}}
+
+		tags, err := BuildCertificateTags(config, secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tagValue(tags, CertificateTagManagedBy)).To(Equal(CertificateManagedByValue))
+		Expect(tagValue(tags, "env")).To(Equal("prod"))
+		Expect(tagValue(tags, "source")).To(Equal("payments/my-tls"))
+		Expect(tagValue(tags, "owner")).To(Equal("checkout"))
+		Expect(tagValue(tags, "team")).To(Equal("checkout"))
+		Expect(tagValue(tags, "cost-center")).To(Equal("cc-42"))
+		Expect(tags).NotTo(HaveKey("ignored"))
+		Expect(tags).NotTo(HaveKey("missing"))
+	})
+
+	It("should never let configured tags override the ownership tags", func() {
+		config := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{
+			CertificateTags: map[string]string{CertificateTagManagedBy: "someone-else"},
+		}}
+
+		tags, err := BuildCertificateTags(config, secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tagValue(tags, CertificateTagManagedBy)).To(Equal(CertificateManagedByValue))
+	})
+
+	It("should respect the Azure Key Vault tag limit", func() {
+		static := map[string]string{}
+		for i := 0; i < 20; i++ {
+			static[fmt.Sprintf("tag-%02d", i)] = "value"
+		}
+		config := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{CertificateTags: static}}
+
+		tags, err := BuildCertificateTags(config, secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tags).To(HaveLen(MaxCertificateTags))
+		Expect(tags).To(HaveKey("tag-00"))
+		Expect(tags).NotTo(HaveKey("tag-19"))
+	})
+
+	It("should truncate long values without splitting a character", func() {
+		config := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{
+			CertificateTags: map[string]string{
+				"ascii":     strings.Repeat("a", 300),
+				"multibyte": "a" + strings.Repeat("é", 200),
+			},
+		}}
+
+		tags, err := BuildCertificateTags(config, secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tagValue(tags, "ascii")).To(HaveLen(MaxCertificateTagValueLength))
+		value := tagValue(tags, "multibyte")
+		Expect(len(value)).To(Equal(MaxCertificateTagValueLength - 1))
+		Expect(utf8.ValidString(value)).To(BeTrue())
+		Expect(TruncateCertificateTagValue("short")).To(Equal("short"))
+	})
+
+	It("should sanitize or drop tag names Azure Key Vault rejects", func() {
+		labelled := secret.DeepCopy()
+		labelled.Labels = map[string]string{"app.kubernetes.io/name": "checkout"}
+		config := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{
+			CertificateTags: map[string]string{
+				"":                       "empty",
+				"cost&center":            "cc-42",
+				strings.Repeat("k", 513): "too-long",
+			},
+			PropagateLabels: []string{"app.kubernetes.io/name"},
+		}}
+
+		tags, err := BuildCertificateTags(config, labelled)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tagValue(tags, "app.kubernetes.io_name")).To(Equal("checkout"))
+		Expect(tagValue(tags, "cost_center")).To(Equal("cc-42"))
+		Expect(tags).NotTo(HaveKey(""))
+		Expect(tags).To(HaveLen(len(OwnershipTags(config, labelled.Namespace, labelled.Name)) + 2))
+	})
+
+	It("should fail on an invalid template", func() {
+		config := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{
+			CertificateTagTemplates: map[string]string{"broken": "{{ .Namespace "},
+		}}
+
+		_, err := BuildCertificateTags(config, secret)
+		Expect(err).To(HaveOccurred())
+	})
+})
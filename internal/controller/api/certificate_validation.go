@@ -0,0 +1,160 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+)
+
+const (
+	// DefaultMinimumRSAKeySize is used when the Config does not set MinimumRSAKeySize
+	DefaultMinimumRSAKeySize = 2048
+
+	// minimumECDSAKeySize rejects curves weaker than P-256
+	minimumECDSAKeySize = 256
+
+	// TLSCAKey is the optional key of a kubernetes.io/tls Secret holding the issuing certificate authority
+	TLSCAKey = "ca.crt"
+)
+
+// CertificateValidationError describes why a certificate was rejected before upload.
+// Reason is one of the CertificateValid condition reasons defined in the API package.
+type CertificateValidationError struct {
+	Reason  string
+	Message string
+}
+
+func (e *CertificateValidationError) Error() string {
+	return e.Reason + ": " + e.Message
+}
+
+func newValidationError(reason string, format string, args ...interface{}) *CertificateValidationError {
+	return &CertificateValidationError{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+// ParsedCertificate is the certificate chain and private key read from a kubernetes.io/tls Secret
+type ParsedCertificate struct {
+	// Chain holds the certificates of tls.crt, leaf first
+	Chain []*x509.Certificate
+	// CA holds the certificates of ca.crt when present
+	CA         []*x509.Certificate
+	PrivateKey crypto.PrivateKey
+}
+
+// Leaf returns the first certificate of tls.crt
+func (p *ParsedCertificate) Leaf() *x509.Certificate {
+	return p.Chain[0]
+}
+
+// ParseSecretCertificate parses tls.crt, tls.key and ca.crt from the Secret
+func ParseSecretCertificate(secret *corev1.Secret) (*ParsedCertificate, *CertificateValidationError) {
+
+	chain, err := certstore.ParseCertificates(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return nil, newValidationError(apiv1alpha1.ReasonMalformedCertificate, "unable to parse %s: %v", corev1.TLSCertKey, err)
+	}
+	if len(chain) == 0 {
+		return nil, newValidationError(apiv1alpha1.ReasonMalformedCertificate, "no certificate found in %s", corev1.TLSCertKey)
+	}
+
+	privateKey, err := certstore.ParsePrivateKey(secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, newValidationError(apiv1alpha1.ReasonMalformedPrivateKey, "unable to parse %s: %v", corev1.TLSPrivateKeyKey, err)
+	}
+
+	ca, err := certstore.ParseCertificates(secret.Data[TLSCAKey])
+	if err != nil {
+		return nil, newValidationError(apiv1alpha1.ReasonMalformedCertificate, "unable to parse %s: %v", TLSCAKey, err)
+	}
+
+	return &ParsedCertificate{Chain: chain, CA: ca, PrivateKey: privateKey}, nil
+}
+
+// ValidateCertificate parses the Secret and checks the certificate can safely be uploaded: the key matches
+// the certificate, the certificate is currently valid, the chain in tls.crt builds and the key is large enough.
+func ValidateCertificate(secret *corev1.Secret, config *apiv1alpha1.Config, now time.Time) (*ParsedCertificate, *CertificateValidationError) {
+
+	parsed, validationErr := ParseSecretCertificate(secret)
+	if validationErr != nil {
+		return nil, validationErr
+	}
+	leaf := parsed.Leaf()
+
+	signer, ok := parsed.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, newValidationError(apiv1alpha1.ReasonMalformedPrivateKey, "unsupported private key type %T", parsed.PrivateKey)
+	}
+	publicKey, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !publicKey.Equal(leaf.PublicKey) {
+		return nil, newValidationError(apiv1alpha1.ReasonKeyMismatch, "the private key does not match the certificate public key")
+	}
+
+	if now.Before(leaf.NotBefore) {
+		return nil, newValidationError(apiv1alpha1.ReasonCertificateNotYetValid, "the certificate is not valid before %s", leaf.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if now.After(leaf.NotAfter) {
+		return nil, newValidationError(apiv1alpha1.ReasonCertificateExpired, "the certificate expired at %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	for i := 0; i < len(parsed.Chain)-1; i++ {
+		if err := parsed.Chain[i].CheckSignatureFrom(parsed.Chain[i+1]); err != nil {
+			return nil, newValidationError(apiv1alpha1.ReasonIncompleteChain, "certificate %d in %s is not signed by the next certificate: %v", i, corev1.TLSCertKey, err)
+		}
+	}
+	if len(parsed.CA) > 0 {
+		last := parsed.Chain[len(parsed.Chain)-1]
+		if !signedByAny(last, parsed.CA) {
+			return nil, newValidationError(apiv1alpha1.ReasonIncompleteChain, "the chain in %s does not build to the certificate authority in %s", corev1.TLSCertKey, TLSCAKey)
+		}
+	}
+
+	minimumRSAKeySize := int(config.Spec.MinimumRSAKeySize)
+	if minimumRSAKeySize == 0 {
+		minimumRSAKeySize = DefaultMinimumRSAKeySize
+	}
+	switch key := leaf.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minimumRSAKeySize {
+			return nil, newValidationError(apiv1alpha1.ReasonKeyTooSmall, "RSA key size %d is smaller than the minimum %d", key.N.BitLen(), minimumRSAKeySize)
+		}
+	case *ecdsa.PublicKey:
+		if key.Curve.Params().BitSize < minimumECDSAKeySize {
+			return nil, newValidationError(apiv1alpha1.ReasonKeyTooSmall, "ECDSA key size %d is smaller than the minimum %d", key.Curve.Params().BitSize, minimumECDSAKeySize)
+		}
+	}
+
+	return parsed, nil
+}
+
+func signedByAny(certificate *x509.Certificate, authorities []*x509.Certificate) bool {
+	for _, authority := range authorities {
+		if certificate.Equal(authority) || certificate.CheckSignatureFrom(authority) == nil {
+			return true
+		}
+	}
+	return false
+}
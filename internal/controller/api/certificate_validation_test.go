@@ -0,0 +1,102 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+var _ = Describe("Certificate validation", func() {
+	now := time.Now()
+	config := &apiv1alpha1.Config{}
+
+	tlsSecret := func(certPEM string, keyPEM string) *corev1.Secret {
+		return &corev1.Secret{
+			Type: corev1.SecretTypeTLS,
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       []byte(certPEM),
+				corev1.TLSPrivateKeyKey: []byte(keyPEM),
+			},
+		}
+	}
+
+	expectReason := func(secret *corev1.Secret, reason string) {
+		_, validationErr := ValidateCertificate(secret, config, now)
+		Expect(validationErr).NotTo(BeNil())
+		Expect(validationErr.Reason).To(Equal(reason))
+	}
+
+	It("should accept a valid certificate chain", func() {
+		ca := newTestCertificate(nil, now.Add(-time.Hour), now.Add(48*time.Hour), nil)
+		leaf := newTestCertificate([]string{"app.example.com"}, now.Add(-time.Hour), now.Add(24*time.Hour), ca)
+
+		secret := tlsSecret(leaf.CertPEM+ca.CertPEM, leaf.KeyPEM)
+		secret.Data[TLSCAKey] = []byte(ca.CertPEM)
+
+		parsed, validationErr := ValidateCertificate(secret, config, now)
+		Expect(validationErr).To(BeNil())
+		Expect(parsed.Leaf().DNSNames).To(ConsistOf("app.example.com"))
+		Expect(parsed.Chain).To(HaveLen(2))
+	})
+
+	It("should reject malformed PEM", func() {
+		leaf := newTestCertificate([]string{"app.example.com"}, now.Add(-time.Hour), now.Add(24*time.Hour), nil)
+		expectReason(tlsSecret("not a certificate", leaf.KeyPEM), apiv1alpha1.ReasonMalformedCertificate)
+		expectReason(tlsSecret(leaf.CertPEM, "not a key"), apiv1alpha1.ReasonMalformedPrivateKey)
+	})
+
+	It("should reject a key that does not match the certificate", func() {
+		leaf := newTestCertificate([]string{"app.example.com"}, now.Add(-time.Hour), now.Add(24*time.Hour), nil)
+		other := newTestCertificate([]string{"app.example.com"}, now.Add(-time.Hour), now.Add(24*time.Hour), nil)
+		expectReason(tlsSecret(leaf.CertPEM, other.KeyPEM), apiv1alpha1.ReasonKeyMismatch)
+	})
+
+	It("should reject expired and not yet valid certificates", func() {
+		expired := newTestCertificate([]string{"app.example.com"}, now.Add(-48*time.Hour), now.Add(-time.Hour), nil)
+		expectReason(tlsSecret(expired.CertPEM, expired.KeyPEM), apiv1alpha1.ReasonCertificateExpired)
+
+		future := newTestCertificate([]string{"app.example.com"}, now.Add(time.Hour), now.Add(48*time.Hour), nil)
+		expectReason(tlsSecret(future.CertPEM, future.KeyPEM), apiv1alpha1.ReasonCertificateNotYetValid)
+	})
+
+	It("should reject a chain that does not build", func() {
+		ca := newTestCertificate(nil, now.Add(-time.Hour), now.Add(48*time.Hour), nil)
+		otherCA := newTestCertificate(nil, now.Add(-time.Hour), now.Add(48*time.Hour), nil)
+		leaf := newTestCertificate([]string{"app.example.com"}, now.Add(-time.Hour), now.Add(24*time.Hour), ca)
+
+		expectReason(tlsSecret(leaf.CertPEM+otherCA.CertPEM, leaf.KeyPEM), apiv1alpha1.ReasonIncompleteChain)
+
+		secret := tlsSecret(leaf.CertPEM, leaf.KeyPEM)
+		secret.Data[TLSCAKey] = []byte(otherCA.CertPEM)
+		expectReason(secret, apiv1alpha1.ReasonIncompleteChain)
+	})
+
+	It("should reject keys smaller than the configured minimum", func() {
+		leaf := newTestCertificate([]string{"app.example.com"}, now.Add(-time.Hour), now.Add(24*time.Hour), nil)
+		strict := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{MinimumRSAKeySize: 4096}}
+
+		_, validationErr := ValidateCertificate(tlsSecret(leaf.CertPEM, leaf.KeyPEM), strict, now)
+		Expect(validationErr).NotTo(BeNil())
+		Expect(validationErr.Reason).To(Equal(apiv1alpha1.ReasonKeyTooSmall))
+	})
+})
@@ -18,24 +18,37 @@ package api
 
 import (
 	"context"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+	"github.com/welasco/syncsecretakv/internal/events"
 )
 
 // ClusterConfigReconciler reconciles a ClusterConfig object
 type ClusterConfigReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// MaxConcurrentReconciles is the number of ClusterConfigs reconciled in parallel, 1 when unset
+	MaxConcurrentReconciles int
+	// NewStore opens the certificate store of the Config, DefaultStoreFactory when nil
+	NewStore StoreFactory
 }
 
 // +kubebuilder:rbac:groups=api.syncsecretakv.io,resources=clusterconfigs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=api.syncsecretakv.io,resources=clusterconfigs/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=api.syncsecretakv.io,resources=clusterconfigs/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -63,31 +76,52 @@ func (r *ClusterConfigReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 
 	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 	// Test if the config is valid by accessing the Azure Key Vault
-	// NewAzKeyVaultClient function is defined in the api package at internal/controller/api/syncsecretakv_controller.go
-	clientCertificate := NewAzKeyVaultClientClusterConfig(clusterConfig)
-
-	// List all certificates in the Azure Key Vault to test Config
-	pager := clientCertificate.NewListCertificatesPager(nil)
+	metricsConfig := ConvertToConfig(clusterConfig)
+	store, err := r.NewStore.open(metricsConfig)
 
 	log.Log.Info("ClusterConfigController - Testing Config by listing certificates in the Azure Key Vault: ")
-	for pager.More() {
-		page, err := pager.NextPage(context.Background())
-		if err != nil {
-			log.Log.Error(err, "ClusterConfigController - Unable to list certificates in the Azure Key Vault, invalid Config settings")
-			clusterConfig.Status.ConfigStatus = "Failed"
-			clusterConfig.Status.ConfigStatusMessage = "Unable to list certificates in the Azure Key Vault, invalid Config settings. Error: " + err.Error()
-			if err := r.Status().Update(ctx, clusterConfig); err != nil {
-				log.Log.Error(err, "ClusterConfigController - Failed to update Config status")
-			}
-			return ctrl.Result{}, err
+	var certificates []*certstore.Certificate
+	if err == nil {
+		callCtx, cancel := keyVaultContext(ctx, OperationListCertificates)
+		start := time.Now()
+		certificates, err = store.List(callCtx)
+		cancel()
+		observeKeyVaultOperation(metricsConfig, OperationListCertificates, start, err)
+	}
+	if err != nil {
+		log.Log.Error(err, "ClusterConfigController - Unable to list certificates in the Azure Key Vault, invalid Config settings")
+		reason, message := SummarizeError(err)
+		clusterConfig.Status.ConfigStatus = "Failed"
+		clusterConfig.Status.ConfigStatusMessage = "Unable to list certificates in the Azure Key Vault, invalid Config settings: " + message
+		clusterConfig.Status.ObservedGeneration = clusterConfig.Generation
+		if IsCredentialsReason(reason) {
+			SetFailedConditions(&clusterConfig.Status.Conditions, clusterConfig.Generation, reason, clusterConfig.Status.ConfigStatusMessage, apiv1alpha1.ConditionCredentialsValid)
+		} else {
+			SetFailedConditions(&clusterConfig.Status.Conditions, clusterConfig.Generation, reason, clusterConfig.Status.ConfigStatusMessage)
+			SetCondition(&clusterConfig.Status.Conditions, clusterConfig.Generation, apiv1alpha1.ConditionCredentialsValid, metav1.ConditionUnknown, reason, "The credentials could not be verified: "+message)
 		}
-		for _, cert := range page.Value {
-			log.Log.Info("ClusterConfigController - Certificate Found in Azure Key Vault: " + cert.ID.Name())
+		events.Emit(r.Recorder, clusterConfig, corev1.EventTypeWarning, events.ReasonVerifyFailed, clusterConfig.Status.ConfigStatusMessage)
+		if err := r.Status().Update(ctx, clusterConfig); err != nil {
+			log.Log.Error(err, "ClusterConfigController - Failed to update Config status")
 		}
+		return ctrl.Result{}, err
+	}
+	for _, cert := range certificates {
+		log.Log.Info("ClusterConfigController - Certificate Found in Azure Key Vault: " + cert.Name)
 	}
 
 	clusterConfig.Status.ConfigStatus = "Success"
 	clusterConfig.Status.ConfigStatusMessage = "Successfully listed certificates in the Azure Key Vault"
+	clusterConfig.Status.ObservedGeneration = clusterConfig.Generation
+	SetSucceededConditions(&clusterConfig.Status.Conditions, clusterConfig.Generation, clusterConfig.Status.ConfigStatusMessage, apiv1alpha1.ConditionCredentialsValid)
+	deletionBrake.Restore(metricsConfig, clusterConfig.Status.DeletionBrake)
+	if deletionBrake.Engaged(metricsConfig) {
+		SetCondition(&clusterConfig.Status.Conditions, clusterConfig.Generation, apiv1alpha1.ConditionDegraded, metav1.ConditionTrue, apiv1alpha1.ReasonDeletionBrakeEngaged, deletionBrakeMessage(metricsConfig))
+	}
+	if message := clusterIDRequiredMessage(metricsConfig); message != "" {
+		SetCondition(&clusterConfig.Status.Conditions, clusterConfig.Generation, apiv1alpha1.ConditionDegraded, metav1.ConditionTrue, apiv1alpha1.ReasonClusterIDRequired, message)
+	}
+	events.Emit(r.Recorder, clusterConfig, corev1.EventTypeNormal, events.ReasonVerified, clusterConfig.Status.ConfigStatusMessage)
 	if err := r.Status().Update(ctx, clusterConfig); err != nil {
 		log.Log.Error(err, "ClusterConfigController - Failed to update Config status")
 	}
@@ -99,5 +133,6 @@ func (r *ClusterConfigReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 func (r *ClusterConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&apiv1alpha1.ClusterConfig{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
@@ -0,0 +1,178 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore/hashicorpvault"
+	"github.com/welasco/syncsecretakv/internal/ratelimit"
+)
+
+// SetCondition sets a condition on the list. The transition time only changes when the status changes.
+func SetCondition(conditions *[]metav1.Condition, generation int64, conditionType string, status metav1.ConditionStatus, reason string, message string) bool {
+	return meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: generation,
+	})
+}
+
+// SetSucceededConditions marks the resource Ready and not Degraded, together with the given condition types
+func SetSucceededConditions(conditions *[]metav1.Condition, generation int64, message string, conditionTypes ...string) bool {
+	changed := false
+	for _, conditionType := range append([]string{apiv1alpha1.ConditionReady}, conditionTypes...) {
+		changed = SetCondition(conditions, generation, conditionType, metav1.ConditionTrue, apiv1alpha1.ReasonSucceeded, message) || changed
+	}
+	changed = SetCondition(conditions, generation, apiv1alpha1.ConditionDegraded, metav1.ConditionFalse, apiv1alpha1.ReasonSucceeded, message) || changed
+	return changed
+}
+
+// SetFailedConditions marks the resource not Ready and Degraded, and the given condition types False
+func SetFailedConditions(conditions *[]metav1.Condition, generation int64, reason string, message string, conditionTypes ...string) bool {
+	changed := false
+	for _, conditionType := range append([]string{apiv1alpha1.ConditionReady}, conditionTypes...) {
+		changed = SetCondition(conditions, generation, conditionType, metav1.ConditionFalse, reason, message) || changed
+	}
+	changed = SetCondition(conditions, generation, apiv1alpha1.ConditionDegraded, metav1.ConditionTrue, reason, message) || changed
+	return changed
+}
+
+// SetNotSyncingConditions marks a resource that is intentionally not synced: not Ready and not Synced, but not
+// Degraded either since nothing failed
+func SetNotSyncingConditions(conditions *[]metav1.Condition, generation int64, reason string, message string) bool {
+	changed := SetCondition(conditions, generation, apiv1alpha1.ConditionReady, metav1.ConditionFalse, reason, message)
+	changed = SetCondition(conditions, generation, apiv1alpha1.ConditionSynced, metav1.ConditionFalse, reason, message) || changed
+	changed = SetCondition(conditions, generation, apiv1alpha1.ConditionDegraded, metav1.ConditionFalse, reason, message) || changed
+	return changed
+}
+
+// IsCredentialsReason reports whether the condition reason points at the Azure Key Vault credentials
+func IsCredentialsReason(reason string) bool {
+	return reason == apiv1alpha1.ReasonAuthenticationFailed || reason == apiv1alpha1.ReasonAccessDenied
+}
+
+// SummarizeError maps an error returned while talking to Azure Key Vault to a condition reason and a short
+// message carrying the Azure error code and HTTP status instead of the full response dump
+func SummarizeError(err error) (string, string) {
+	var responseErr *azcore.ResponseError
+	var vaultErr *hashicorpvault.ResponseError
+	var authenticationErr *azidentity.AuthenticationFailedError
+	var validationErr *CertificateValidationError
+	var netErr net.Error
+	var nonRetriable interface{ NonRetriable() }
+
+	switch {
+	case errors.Is(err, ErrDeletionBrakeEngaged):
+		return apiv1alpha1.ReasonDeletionBrakeEngaged, "Too many certificates were deleted from the Azure Key Vault, the deletion waits for approval"
+	case errors.Is(err, ErrCertificateNotOwned):
+		return apiv1alpha1.ReasonCertificateNotOwned, "The Azure Key Vault certificate is owned by another cluster or Secret"
+	case errors.As(err, &validationErr):
+		return apiv1alpha1.ReasonCertificateRejected, validationErr.Message
+	case errors.Is(err, hashicorpvault.ErrLoginFailed):
+		return apiv1alpha1.ReasonAuthenticationFailed, "Unable to log in to HashiCorp Vault"
+	case errors.As(err, &responseErr):
+		return summarizeStatusCode(responseErr.StatusCode, apiv1alpha1.ReasonAzureRequestFailed),
+			fmt.Sprintf("Azure Key Vault returned %d %s", responseErr.StatusCode, responseErr.ErrorCode)
+	case errors.As(err, &vaultErr):
+		return summarizeStatusCode(vaultErr.StatusCode, apiv1alpha1.ReasonRequestFailed),
+			fmt.Sprintf("HashiCorp Vault returned %d", vaultErr.StatusCode)
+	case errors.As(err, &authenticationErr):
+		if authenticationErr.RawResponse != nil {
+			return apiv1alpha1.ReasonAuthenticationFailed, fmt.Sprintf("Unable to obtain an Azure access token, Microsoft Entra ID returned %d", authenticationErr.RawResponse.StatusCode)
+		}
+		return apiv1alpha1.ReasonAuthenticationFailed, "Unable to obtain an Azure access token"
+	case errors.As(err, &nonRetriable):
+		// Credentials such as the managed identity report a non retriable error when they are not available
+		return apiv1alpha1.ReasonAuthenticationFailed, "No Azure credential is available"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return apiv1alpha1.ReasonVaultUnavailable, "Unable to reach Azure Key Vault"
+	default:
+		return apiv1alpha1.ReasonSyncFailed, err.Error()
+	}
+}
+
+// summarizeStatusCode returns the reason of an error response of a vault, defaultReason for the 4xx
+// responses without a reason of their own
+func summarizeStatusCode(statusCode int, defaultReason string) string {
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		return apiv1alpha1.ReasonAuthenticationFailed
+	case statusCode == http.StatusForbidden:
+		return apiv1alpha1.ReasonAccessDenied
+	case statusCode == http.StatusTooManyRequests:
+		return apiv1alpha1.ReasonThrottled
+	case statusCode == http.StatusRequestTimeout, statusCode >= http.StatusInternalServerError:
+		return apiv1alpha1.ReasonVaultUnavailable
+	default:
+		return defaultReason
+	}
+}
+
+// ClassifyFailure reports whether a failure with the given reason is worth retrying. Throttling, unavailable
+// vaults and unexpected errors are transient, rejected certificates, missing permissions and other 4xx
+// responses are terminal.
+func ClassifyFailure(reason string) apiv1alpha1.FailureClass {
+	switch reason {
+	case apiv1alpha1.ReasonThrottled, apiv1alpha1.ReasonVaultUnavailable, apiv1alpha1.ReasonSyncFailed, apiv1alpha1.ReasonDeletionBrakeEngaged:
+		return apiv1alpha1.FailureClassTransient
+	default:
+		return apiv1alpha1.FailureClassTerminal
+	}
+}
+
+// RequeueError returns err so the workqueue retries transient failures with exponential backoff,
+// and wraps terminal failures so they are logged without being requeued
+func RequeueError(err error, reason string) error {
+	if ClassifyFailure(reason) == apiv1alpha1.FailureClassTransient {
+		return err
+	}
+	return reconcile.TerminalError(err)
+}
+
+// deletionBrakeRequeueInterval is how often a deletion held by the deletion brake is retried
+const deletionBrakeRequeueInterval = time.Minute
+
+// RequeueResult is RequeueError for throttled requests that carry a Retry-After, which are requeued after
+// the delay asked by Azure Key Vault instead of the workqueue backoff, and for deletions held by the brake
+func RequeueResult(err error, reason string) (ctrl.Result, error) {
+	if reason == apiv1alpha1.ReasonThrottled {
+		if delay, ok := ratelimit.RetryAfterFromError(err); ok {
+			return ctrl.Result{RequeueAfter: delay}, nil
+		}
+	}
+	// Deletions held by the deletion brake are checked again until the Config approves them
+	if reason == apiv1alpha1.ReasonDeletionBrakeEngaged {
+		return ctrl.Result{RequeueAfter: deletionBrakeRequeueInterval}, nil
+	}
+	return ctrl.Result{}, RequeueError(err, reason)
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore/hashicorpvault"
+)
+
+var _ = Describe("Conditions", func() {
+	It("should set Ready, Degraded and the extra conditions together", func() {
+		var conditions []metav1.Condition
+
+		Expect(SetFailedConditions(&conditions, 1, apiv1alpha1.ReasonThrottled, "throttled", apiv1alpha1.ConditionSynced)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(conditions, apiv1alpha1.ConditionReady)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(conditions, apiv1alpha1.ConditionSynced)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(conditions, apiv1alpha1.ConditionDegraded)).To(BeTrue())
+		Expect(meta.FindStatusCondition(conditions, apiv1alpha1.ConditionReady).Reason).To(Equal(apiv1alpha1.ReasonThrottled))
+
+		Expect(SetSucceededConditions(&conditions, 2, "synced", apiv1alpha1.ConditionSynced)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(conditions, apiv1alpha1.ConditionReady)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(conditions, apiv1alpha1.ConditionSynced)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(conditions, apiv1alpha1.ConditionDegraded)).To(BeTrue())
+		Expect(meta.FindStatusCondition(conditions, apiv1alpha1.ConditionReady).ObservedGeneration).To(Equal(int64(2)))
+
+		Expect(SetSucceededConditions(&conditions, 2, "synced", apiv1alpha1.ConditionSynced)).To(BeFalse())
+	})
+
+	It("should summarize Azure errors by status code", func() {
+		responseError := func(statusCode int, errorCode string) error {
+			return fmt.Errorf("import failed: %w", &azcore.ResponseError{StatusCode: statusCode, ErrorCode: errorCode})
+		}
+
+		reason, message := SummarizeError(responseError(http.StatusForbidden, "Forbidden"))
+		Expect(reason).To(Equal(apiv1alpha1.ReasonAccessDenied))
+		Expect(message).To(Equal("Azure Key Vault returned 403 Forbidden"))
+
+		reason, _ = SummarizeError(responseError(http.StatusUnauthorized, "Unauthorized"))
+		Expect(reason).To(Equal(apiv1alpha1.ReasonAuthenticationFailed))
+		reason, _ = SummarizeError(responseError(http.StatusTooManyRequests, "Throttled"))
+		Expect(reason).To(Equal(apiv1alpha1.ReasonThrottled))
+		reason, _ = SummarizeError(responseError(http.StatusServiceUnavailable, "ServiceUnavailable"))
+		Expect(reason).To(Equal(apiv1alpha1.ReasonVaultUnavailable))
+		reason, _ = SummarizeError(responseError(http.StatusBadRequest, "BadParameter"))
+		Expect(reason).To(Equal(apiv1alpha1.ReasonAzureRequestFailed))
+	})
+
+	It("should summarize HashiCorp Vault errors by status code", func() {
+		responseError := func(statusCode int) error {
+			return fmt.Errorf("import failed: %w", &hashicorpvault.ResponseError{StatusCode: statusCode})
+		}
+
+		reason, message := SummarizeError(responseError(http.StatusForbidden))
+		Expect(reason).To(Equal(apiv1alpha1.ReasonAccessDenied))
+		Expect(message).To(Equal("HashiCorp Vault returned 403"))
+
+		reason, _ = SummarizeError(responseError(http.StatusTooManyRequests))
+		Expect(reason).To(Equal(apiv1alpha1.ReasonThrottled))
+		reason, _ = SummarizeError(responseError(http.StatusBadRequest))
+		Expect(reason).To(Equal(apiv1alpha1.ReasonRequestFailed))
+
+		reason, _ = SummarizeError(fmt.Errorf("%w: %w", hashicorpvault.ErrLoginFailed, responseError(http.StatusForbidden)))
+		Expect(reason).To(Equal(apiv1alpha1.ReasonAuthenticationFailed))
+	})
+
+	It("should summarize ownership, network and other errors", func() {
+		reason, _ := SummarizeError(ErrCertificateNotOwned)
+		Expect(reason).To(Equal(apiv1alpha1.ReasonCertificateNotOwned))
+
+		reason, _ = SummarizeError(context.DeadlineExceeded)
+		Expect(reason).To(Equal(apiv1alpha1.ReasonVaultUnavailable))
+
+		reason, message := SummarizeError(errors.New("no certificate found in tls.crt"))
+		Expect(reason).To(Equal(apiv1alpha1.ReasonSyncFailed))
+		Expect(message).To(Equal("no certificate found in tls.crt"))
+	})
+
+	It("should retry transient failures and stop on terminal ones", func() {
+		Expect(ClassifyFailure(apiv1alpha1.ReasonThrottled)).To(Equal(apiv1alpha1.FailureClassTransient))
+		Expect(ClassifyFailure(apiv1alpha1.ReasonVaultUnavailable)).To(Equal(apiv1alpha1.FailureClassTransient))
+		Expect(ClassifyFailure(apiv1alpha1.ReasonAccessDenied)).To(Equal(apiv1alpha1.FailureClassTerminal))
+		Expect(ClassifyFailure(apiv1alpha1.ReasonCertificateRejected)).To(Equal(apiv1alpha1.FailureClassTerminal))
+
+		err := errors.New("failed")
+		Expect(RequeueError(err, apiv1alpha1.ReasonThrottled)).To(BeIdenticalTo(err))
+		Expect(errors.Is(RequeueError(err, apiv1alpha1.ReasonAccessDenied), reconcile.TerminalError(nil))).To(BeTrue())
+	})
+
+	It("should requeue throttled requests after the Retry-After delay", func() {
+		throttled := &azcore.ResponseError{StatusCode: http.StatusTooManyRequests, RawResponse: &http.Response{Header: http.Header{"Retry-After": []string{"30"}}}}
+
+		result, err := RequeueResult(throttled, apiv1alpha1.ReasonThrottled)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(30 * time.Second))
+
+		result, err = RequeueResult(errors.New("failed"), apiv1alpha1.ReasonThrottled)
+		Expect(err).To(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+	})
+})
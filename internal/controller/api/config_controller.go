@@ -19,24 +19,37 @@ package api
 import (
 	"context"
 	"errors"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+	"github.com/welasco/syncsecretakv/internal/events"
 )
 
 // ConfigReconciler reconciles a Config object
 type ConfigReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// MaxConcurrentReconciles is the number of Configs reconciled in parallel, 1 when unset
+	MaxConcurrentReconciles int
+	// NewStore opens the certificate store of the Config, DefaultStoreFactory when nil
+	NewStore StoreFactory
 }
 
 // +kubebuilder:rbac:groups=api.syncsecretakv.io,resources=configs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=api.syncsecretakv.io,resources=configs/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=api.syncsecretakv.io,resources=configs/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -62,31 +75,51 @@ func (r *ConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	}
 
 	// Test if the config is valid by accessing the Azure Key Vault
-	// NewAzKeyVaultClient function is defined in the api package at internal/controller/api/syncsecretakv_controller.go
-	clientCertificate := NewAzKeyVaultClientConfig(config)
-
-	// List all certificates in the Azure Key Vault to test Config
-	pager := clientCertificate.NewListCertificatesPager(nil)
+	store, err := r.NewStore.open(config)
 
 	log.Log.Info("ConfigController - Testing Config by listing certificates in the Azure Key Vault: ")
-	for pager.More() {
-		page, err := pager.NextPage(context.Background())
-		if err != nil {
-			log.Log.Error(err, "ConfigController - Unable to list certificates in the Azure Key Vault, invalid Config settings")
-			config.Status.ConfigStatus = "Failed"
-			config.Status.ConfigStatusMessage = "Unable to list certificates in the Azure Key Vault, invalid Config settings. Error: " + err.Error()
-			if err := r.Status().Update(ctx, config); err != nil {
-				log.Log.Error(err, "ConfigController - Failed to update Config status")
-			}
-			return ctrl.Result{}, err
+	var certificates []*certstore.Certificate
+	if err == nil {
+		callCtx, cancel := keyVaultContext(ctx, OperationListCertificates)
+		start := time.Now()
+		certificates, err = store.List(callCtx)
+		cancel()
+		observeKeyVaultOperation(config, OperationListCertificates, start, err)
+	}
+	if err != nil {
+		log.Log.Error(err, "ConfigController - Unable to list certificates in the Azure Key Vault, invalid Config settings")
+		reason, message := SummarizeError(err)
+		config.Status.ConfigStatus = "Failed"
+		config.Status.ConfigStatusMessage = "Unable to list certificates in the Azure Key Vault, invalid Config settings: " + message
+		config.Status.ObservedGeneration = config.Generation
+		if IsCredentialsReason(reason) {
+			SetFailedConditions(&config.Status.Conditions, config.Generation, reason, config.Status.ConfigStatusMessage, apiv1alpha1.ConditionCredentialsValid)
+		} else {
+			SetFailedConditions(&config.Status.Conditions, config.Generation, reason, config.Status.ConfigStatusMessage)
+			SetCondition(&config.Status.Conditions, config.Generation, apiv1alpha1.ConditionCredentialsValid, metav1.ConditionUnknown, reason, "The credentials could not be verified: "+message)
 		}
-		for _, cert := range page.Value {
-			log.Log.Info("ConfigController - Certificate Found in Azure Key Vault: " + cert.ID.Name())
+		events.Emit(r.Recorder, config, corev1.EventTypeWarning, events.ReasonVerifyFailed, config.Status.ConfigStatusMessage)
+		if err := r.Status().Update(ctx, config); err != nil {
+			log.Log.Error(err, "ConfigController - Failed to update Config status")
 		}
+		return ctrl.Result{}, err
+	}
+	for _, cert := range certificates {
+		log.Log.Info("ConfigController - Certificate Found in Azure Key Vault: " + cert.Name)
 	}
 
 	config.Status.ConfigStatus = "Success"
 	config.Status.ConfigStatusMessage = "Successfully listed certificates in the Azure Key Vault"
+	config.Status.ObservedGeneration = config.Generation
+	SetSucceededConditions(&config.Status.Conditions, config.Generation, config.Status.ConfigStatusMessage, apiv1alpha1.ConditionCredentialsValid)
+	deletionBrake.Restore(config, config.Status.DeletionBrake)
+	if deletionBrake.Engaged(config) {
+		SetCondition(&config.Status.Conditions, config.Generation, apiv1alpha1.ConditionDegraded, metav1.ConditionTrue, apiv1alpha1.ReasonDeletionBrakeEngaged, deletionBrakeMessage(config))
+	}
+	if message := clusterIDRequiredMessage(config); message != "" {
+		SetCondition(&config.Status.Conditions, config.Generation, apiv1alpha1.ConditionDegraded, metav1.ConditionTrue, apiv1alpha1.ReasonClusterIDRequired, message)
+	}
+	events.Emit(r.Recorder, config, corev1.EventTypeNormal, events.ReasonVerified, config.Status.ConfigStatusMessage)
 	if err := r.Status().Update(ctx, config); err != nil {
 		log.Log.Error(err, "ConfigController - Failed to update Config status")
 	}
@@ -149,5 +182,6 @@ func LoadConfig(ctx context.Context, client client.Client) (*apiv1alpha1.Config,
 func (r *ConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&apiv1alpha1.Config{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
@@ -0,0 +1,44 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+// syncSecretAKVsForConfig maps a change of a Config or ClusterConfig to every SyncSecretAKV, so policy, tag
+// and vault URL changes are applied to the synced certificates right away
+func (r *SyncSecretAKVReconciler) syncSecretAKVsForConfig(ctx context.Context, _ client.Object) []reconcile.Request {
+	syncSecretAKVs := &apiv1alpha1.SyncSecretAKVList{}
+	if err := r.List(ctx, syncSecretAKVs); err != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Unable to list SyncSecretAKVs after a Config change")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(syncSecretAKVs.Items))
+	for _, syncSecretAKV := range syncSecretAKVs.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: syncSecretAKV.Namespace, Name: syncSecretAKV.Name}})
+	}
+	return requests
+}
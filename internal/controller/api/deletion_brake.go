@@ -0,0 +1,259 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/events"
+)
+
+// Defaults of the deletion brake when the Config leaves them unset
+const (
+	DefaultMaxDeletionsPerWindow = 10
+	DefaultDeletionWindow        = time.Hour
+)
+
+// ErrDeletionBrakeEngaged is returned instead of deleting a certificate once the vault reached the
+// MaxDeletionsPerWindow of the Config
+var ErrDeletionBrakeEngaged = errors.New("too many certificates deleted from the Azure Key Vault, deletions wait for the " + apiv1alpha1.AnnotationApproveDeletions + " annotation")
+
+// DeletionBrake counts the certificate deletions of each vault in a sliding window. Once the limit is reached
+// the brake stays engaged, even after the window passed, until the Config carries a new approval. The state is
+// kept in the Config status, see Restore and Status, so a restart does not reset the window.
+type DeletionBrake struct {
+	mu     sync.Mutex
+	now    func() time.Time
+	vaults map[string]*vaultDeletions
+}
+
+type vaultDeletions struct {
+	deletions []time.Time
+	// pending is the number of deletions allowed but not completed yet, they hold a slot of the window
+	pending  int
+	approval string
+	engaged  bool
+	restored bool
+}
+
+// NewDeletionBrake returns a DeletionBrake without any recorded deletion
+func NewDeletionBrake() *DeletionBrake {
+	return &DeletionBrake{now: time.Now, vaults: map[string]*vaultDeletions{}}
+}
+
+// deletionBrake is shared by the SyncSecretAKV reconciler and the garbage collector
+var deletionBrake = NewDeletionBrake()
+
+// Allow reserves a deletion from the vault of the Config and reports whether it may proceed. Every allowed
+// deletion must be completed with Done, which only counts it when the certificate was deleted.
+func (b *DeletionBrake) Allow(config *apiv1alpha1.Config) bool {
+	limit, window := deletionLimits(config)
+	if limit <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vault := b.vault(StoreURL(config))
+
+	if approval := config.Annotations[apiv1alpha1.AnnotationApproveDeletions]; approval != "" && approval != vault.approval {
+		vault.approval = approval
+		vault.deletions = nil
+		vault.engaged = false
+	}
+	if vault.engaged {
+		return false
+	}
+
+	vault.deletions = recentDeletions(vault.deletions, b.now(), window)
+	if len(vault.deletions) >= int(limit) {
+		vault.engaged = true
+		return false
+	}
+	if len(vault.deletions)+vault.pending >= int(limit) {
+		// The deletions in flight may still fail and free their slot
+		return false
+	}
+	vault.pending++
+	return true
+}
+
+// Done completes a deletion allowed by Allow, counting it towards the window only when the certificate was deleted
+func (b *DeletionBrake) Done(config *apiv1alpha1.Config, deleted bool) {
+	if limit, _ := deletionLimits(config); limit <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vault := b.vault(StoreURL(config))
+	if vault.pending > 0 {
+		vault.pending--
+	}
+	if deleted {
+		vault.deletions = append(vault.deletions, b.now())
+	}
+}
+
+// Engaged reports whether deletions from the vault of the Config wait for an approval. A new approval on the
+// Config releases the brake.
+func (b *DeletionBrake) Engaged(config *apiv1alpha1.Config) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vault := b.vault(StoreURL(config))
+	if approval := config.Annotations[apiv1alpha1.AnnotationApproveDeletions]; approval != "" && approval != vault.approval {
+		return false
+	}
+	return vault.engaged
+}
+
+// Restored reports whether the state of the vault of the Config was already restored from a Config status
+func (b *DeletionBrake) Restored(config *apiv1alpha1.Config) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.vault(StoreURL(config)).restored
+}
+
+// Restore loads the state recorded in the Config status the first time the vault of the Config is seen, the
+// deletions counted since the controller started are kept
+func (b *DeletionBrake) Restore(config *apiv1alpha1.Config, status *apiv1alpha1.DeletionBrakeStatus) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vault := b.vault(StoreURL(config))
+	if vault.restored {
+		return
+	}
+	vault.restored = true
+	if status == nil {
+		return
+	}
+	for _, deletion := range status.Deletions {
+		vault.deletions = append(vault.deletions, deletion.Time)
+	}
+	sort.Slice(vault.deletions, func(i, j int) bool { return vault.deletions[i].Before(vault.deletions[j]) })
+	if vault.approval == "" {
+		vault.approval = status.Approval
+	}
+	vault.engaged = vault.engaged || status.Engaged
+}
+
+// Status returns the state of the vault of the Config to record in its status
+func (b *DeletionBrake) Status(config *apiv1alpha1.Config) *apiv1alpha1.DeletionBrakeStatus {
+	_, window := deletionLimits(config)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vault := b.vault(StoreURL(config))
+	vault.deletions = recentDeletions(vault.deletions, b.now(), window)
+	if len(vault.deletions) == 0 && vault.approval == "" && !vault.engaged {
+		return nil
+	}
+	status := &apiv1alpha1.DeletionBrakeStatus{Approval: vault.approval, Engaged: vault.engaged}
+	for _, deletion := range vault.deletions {
+		status.Deletions = append(status.Deletions, metav1.NewTime(deletion))
+	}
+	return status
+}
+
+func (b *DeletionBrake) vault(vaultURL string) *vaultDeletions {
+	key := strings.TrimSuffix(strings.ToLower(vaultURL), "/")
+	vault, ok := b.vaults[key]
+	if !ok {
+		vault = &vaultDeletions{}
+		b.vaults[key] = vault
+	}
+	return vault
+}
+
+func recentDeletions(deletions []time.Time, now time.Time, window time.Duration) []time.Time {
+	recent := deletions[:0]
+	for _, deletion := range deletions {
+		if now.Sub(deletion) < window {
+			recent = append(recent, deletion)
+		}
+	}
+	return recent
+}
+
+func deletionLimits(config *apiv1alpha1.Config) (int32, time.Duration) {
+	limit := int32(DefaultMaxDeletionsPerWindow)
+	if config.Spec.MaxDeletionsPerWindow != nil {
+		limit = *config.Spec.MaxDeletionsPerWindow
+	}
+	window := DefaultDeletionWindow
+	if config.Spec.DeletionWindow != nil && config.Spec.DeletionWindow.Duration > 0 {
+		window = config.Spec.DeletionWindow.Duration
+	}
+	return limit, window
+}
+
+// deletionBrakeMessage describes the engaged brake in the Config status and events
+func deletionBrakeMessage(config *apiv1alpha1.Config) string {
+	limit, window := deletionLimits(config)
+	return fmt.Sprintf("%d certificates were deleted from %s within %s, further deletions wait for the %s annotation",
+		limit, StoreURL(config), window, apiv1alpha1.AnnotationApproveDeletions)
+}
+
+// reportDeletionBrake marks the Config in effect Degraded and records an event when the brake blocked a deletion
+func reportDeletionBrake(ctx context.Context, c client.Client, recorder record.EventRecorder, config *apiv1alpha1.Config) {
+	message := deletionBrakeMessage(config)
+	events.Emit(recorder, configObject(config), corev1.EventTypeWarning, events.ReasonDeletionBlocked, message)
+	err := updateConfigStatus(ctx, c, config, func(status *apiv1alpha1.ConfigStatus, generation int64) {
+		SetCondition(&status.Conditions, generation, apiv1alpha1.ConditionDegraded, metav1.ConditionTrue, apiv1alpha1.ReasonDeletionBrakeEngaged, message)
+		status.DeletionBrake = deletionBrake.Status(config)
+	})
+	if err != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Failed to mark the Config Degraded after the deletion brake engaged")
+	}
+}
+
+// restoreDeletionBrake loads the deletion brake state of the vault from the status of the Config in effect,
+// once after the controller started
+func restoreDeletionBrake(ctx context.Context, c client.Client, config *apiv1alpha1.Config) error {
+	if deletionBrake.Restored(config) {
+		return nil
+	}
+	status, err := readConfigStatus(ctx, c, config)
+	if err != nil {
+		return err
+	}
+	deletionBrake.Restore(config, status.DeletionBrake)
+	return nil
+}
+
+// persistDeletionBrake records the deletion brake state of the vault in the status of the Config in effect
+func persistDeletionBrake(ctx context.Context, c client.Client, config *apiv1alpha1.Config) {
+	err := updateConfigStatus(ctx, c, config, func(status *apiv1alpha1.ConfigStatus, _ int64) {
+		status.DeletionBrake = deletionBrake.Status(config)
+	})
+	if err != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Failed to record the deletion brake in the Config status")
+	}
+}
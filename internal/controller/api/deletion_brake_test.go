@@ -0,0 +1,138 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+var _ = Describe("Deletion brake", func() {
+	var (
+		brake  *DeletionBrake
+		now    time.Time
+		config *apiv1alpha1.Config
+	)
+
+	BeforeEach(func() {
+		brake = NewDeletionBrake()
+		now = time.Now()
+		brake.now = func() time.Time { return now }
+		limit := int32(2)
+		config = &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{
+			AzKeyVaultURL:         "https://vault.vault.azure.net/",
+			MaxDeletionsPerWindow: &limit,
+			DeletionWindow:        &metav1.Duration{Duration: time.Hour},
+		}}
+	})
+
+	// deleted runs a deletion through the brake and reports whether it was allowed
+	deleted := func() bool {
+		if !brake.Allow(config) {
+			return false
+		}
+		brake.Done(config, true)
+		return true
+	}
+
+	It("should allow deletions within the window limit", func() {
+		Expect(deleted()).To(BeTrue())
+		now = now.Add(time.Hour)
+		Expect(deleted()).To(BeTrue())
+		Expect(deleted()).To(BeTrue())
+		Expect(brake.Engaged(config)).To(BeFalse())
+	})
+
+	It("should stay engaged until a new approval", func() {
+		Expect(deleted()).To(BeTrue())
+		Expect(deleted()).To(BeTrue())
+		Expect(deleted()).To(BeFalse())
+		Expect(brake.Engaged(config)).To(BeTrue())
+
+		now = now.Add(2 * time.Hour)
+		Expect(deleted()).To(BeFalse())
+
+		config.Annotations = map[string]string{apiv1alpha1.AnnotationApproveDeletions: "ticket-1234"}
+		Expect(brake.Engaged(config)).To(BeFalse())
+		Expect(deleted()).To(BeTrue())
+		Expect(deleted()).To(BeTrue())
+		Expect(deleted()).To(BeFalse())
+	})
+
+	It("should only count the deletions that succeeded", func() {
+		for i := 0; i < 5; i++ {
+			Expect(brake.Allow(config)).To(BeTrue())
+			brake.Done(config, false)
+		}
+		Expect(deleted()).To(BeTrue())
+
+		// A deletion in flight holds the last slot until it completes
+		Expect(brake.Allow(config)).To(BeTrue())
+		Expect(brake.Allow(config)).To(BeFalse())
+		Expect(brake.Engaged(config)).To(BeFalse())
+		brake.Done(config, false)
+		Expect(deleted()).To(BeTrue())
+		Expect(deleted()).To(BeFalse())
+	})
+
+	It("should restore the window and the engaged brake from the Config status", func() {
+		Expect(deleted()).To(BeTrue())
+		Expect(brake.Status(config).Deletions).To(HaveLen(1))
+
+		restarted := NewDeletionBrake()
+		restarted.now = brake.now
+		restarted.Restore(config, brake.Status(config))
+		Expect(restarted.Restored(config)).To(BeTrue())
+		Expect(restarted.Allow(config)).To(BeTrue())
+		restarted.Done(config, true)
+		Expect(restarted.Allow(config)).To(BeFalse())
+		Expect(restarted.Engaged(config)).To(BeTrue())
+
+		engaged := NewDeletionBrake()
+		engaged.now = brake.now
+		engaged.Restore(config, restarted.Status(config))
+		Expect(engaged.Engaged(config)).To(BeTrue())
+		// The status is only restored once, later Config updates do not reset the deletions counted since
+		engaged.Restore(config, nil)
+		Expect(engaged.Engaged(config)).To(BeTrue())
+
+		now = now.Add(2 * time.Hour)
+		Expect(engaged.Status(config).Deletions).To(BeEmpty())
+	})
+
+	It("should not limit deletions when MaxDeletionsPerWindow is 0", func() {
+		limit := int32(0)
+		config.Spec.MaxDeletionsPerWindow = &limit
+		for i := 0; i < 20; i++ {
+			Expect(deleted()).To(BeTrue())
+		}
+	})
+
+	It("should retry held deletions until they are approved", func() {
+		reason, _ := SummarizeError(ErrDeletionBrakeEngaged)
+		Expect(reason).To(Equal(apiv1alpha1.ReasonDeletionBrakeEngaged))
+
+		result, err := RequeueResult(ErrDeletionBrakeEngaged, reason)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(deletionBrakeRequeueInterval))
+	})
+})
@@ -0,0 +1,40 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"time"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+// DryRun puts every Config in dry run, it is set by the --dry-run flag of the manager
+var DryRun bool
+
+// IsDryRun reports whether changes to the Azure Key Vault of the Config are only recorded, not made
+func IsDryRun(config *apiv1alpha1.Config) bool {
+	return DryRun || config.Spec.DryRun
+}
+
+// dryRunRequeueInterval is how often the deletion of a SyncSecretAKV skipped in dry run is retried, so the
+// certificate is deleted once dry run is turned off
+const dryRunRequeueInterval = 5 * time.Minute
+
+// dryRunMessage prefixes the description of a change skipped in dry run
+func dryRunMessage(message string) string {
+	return "Dry run: would " + message
+}
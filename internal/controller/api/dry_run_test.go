@@ -0,0 +1,79 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+var _ = Describe("Dry run", func() {
+	AfterEach(func() {
+		DryRun = false
+	})
+
+	It("should apply the manager flag to every Config", func() {
+		config := &apiv1alpha1.Config{}
+		Expect(IsDryRun(config)).To(BeFalse())
+
+		config.Spec.DryRun = true
+		Expect(IsDryRun(config)).To(BeTrue())
+
+		DryRun = true
+		Expect(IsDryRun(&apiv1alpha1.Config{})).To(BeTrue())
+	})
+
+	It("should record the skipped change once in status and events", func() {
+		scheme := runtime.NewScheme()
+		Expect(apiv1alpha1.AddToScheme(scheme)).To(Succeed())
+		syncSecretAKV := &apiv1alpha1.SyncSecretAKV{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-tls", Namespace: "default"},
+			Spec:       apiv1alpha1.SyncSecretAKVSpec{SecretName: "app-tls", SecretResourceVersion: "2", SyncSecretAKVResourceVersion: "1"},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(syncSecretAKV).WithStatusSubresource(syncSecretAKV).Build()
+		recorder := record.NewFakeRecorder(10)
+		r := &SyncSecretAKVReconciler{Client: c, Scheme: scheme, Recorder: recorder}
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "app-tls", Namespace: "default"}}
+		message := dryRunMessage("import or update Azure Key Vault Certificate default-app-tls")
+
+		_, err := r.recordDryRun(context.Background(), syncSecretAKV, secret, message)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.recordDryRun(context.Background(), syncSecretAKV, secret, message)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(HaveLen(2))
+
+		stored := &apiv1alpha1.SyncSecretAKV{}
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(syncSecretAKV), stored)).To(Succeed())
+		Expect(stored.Status.SyncStatus).To(Equal("DryRun"))
+		Expect(stored.Spec.SyncSecretAKVResourceVersion).To(Equal("1"))
+		synced := meta.FindStatusCondition(stored.Status.Conditions, apiv1alpha1.ConditionSynced)
+		Expect(synced).NotTo(BeNil())
+		Expect(synced.Reason).To(Equal(apiv1alpha1.ReasonDryRun))
+		Expect(synced.Message).To(Equal(message))
+	})
+})
@@ -0,0 +1,352 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azcertificates"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+	"github.com/welasco/syncsecretakv/internal/certstore/azurekeyvault"
+	"github.com/welasco/syncsecretakv/internal/fakekeyvault"
+)
+
+// fakeKeyVaultStoreFactory opens the Azure Key Vault store of the fake Key Vault whatever the Config says, so the
+// reconcilers exercise the Azure calls without network access. The envtest suites can use it the same way.
+func fakeKeyVaultStoreFactory(server *fakekeyvault.Server) StoreFactory {
+	return func(*apiv1alpha1.Config) (certstore.Store, error) {
+		return azurekeyvault.NewWithClientOptions(server.URL(), fakekeyvault.Credential{}, server.ClientOptions())
+	}
+}
+
+var _ = Describe("Sync against the fake Key Vault", func() {
+	var (
+		ctx     context.Context
+		server  *fakekeyvault.Server
+		c       client.Client
+		r       *SyncSecretAKVReconciler
+		leaf    *testCertificate
+		secret  *corev1.Secret
+		request reconcile.Request
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		server = fakekeyvault.NewServer()
+		DeferCleanup(server.Close)
+
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(apiv1alpha1.AddToScheme(scheme)).To(Succeed())
+		leaf = newTestCertificate([]string{"app.example.com"}, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour), nil)
+		config := &apiv1alpha1.Config{
+			ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"},
+			Spec:       apiv1alpha1.ConfigSpec{AzKeyVaultURL: server.URL(), AllowAzKeyVaultCertificateDeletion: true},
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-tls", Namespace: "default"},
+			Type:       corev1.SecretTypeTLS,
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       []byte(leaf.CertPEM),
+				corev1.TLSPrivateKeyKey: []byte(leaf.KeyPEM),
+			},
+		}
+		syncSecretAKV := &apiv1alpha1.SyncSecretAKV{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-tls", Namespace: "default"},
+			Spec:       apiv1alpha1.SyncSecretAKVSpec{SecretName: "app-tls", SecretResourceVersion: "1"},
+		}
+		c = fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(config, secret, syncSecretAKV).
+			WithStatusSubresource(config, syncSecretAKV).
+			Build()
+		r = &SyncSecretAKVReconciler{Client: c, Scheme: scheme, Recorder: record.NewFakeRecorder(100), NewStore: fakeKeyVaultStoreFactory(server)}
+		request = reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "app-tls"}}
+	})
+
+	It("should import the Secret and delete the certificate with the SyncSecretAKV", func() {
+		_, err := r.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+
+		bundle, ok := server.Certificate("default-app-tls")
+		Expect(ok).To(BeTrue())
+		Expect(bundle.CER).To(Equal(leaf.Certificate.Raw))
+		stored := &apiv1alpha1.SyncSecretAKV{}
+		Expect(c.Get(ctx, request.NamespacedName, stored)).To(Succeed())
+		Expect(stored.Status.SyncStatus).To(Equal("Success"))
+		Expect(stored.Status.VaultURL).To(Equal(server.URL()))
+		Expect(stored.Status.CertificateID).To(Equal(string(*bundle.ID)))
+		Expect(meta.IsStatusConditionTrue(stored.Status.Conditions, apiv1alpha1.ConditionSynced)).To(BeTrue())
+
+		// The Secret did not change, the certificate is only read again
+		before := len(server.Requests())
+		_, err = r.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		for _, sent := range server.Requests()[before:] {
+			Expect(strings.HasPrefix(sent, "GET ")).To(BeTrue(), sent)
+		}
+
+		Expect(c.Delete(ctx, stored)).To(Succeed())
+		Expect(c.Delete(ctx, secret)).To(Succeed())
+		_, err = r.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		_, ok = server.Certificate("default-app-tls")
+		Expect(ok).To(BeFalse())
+		Expect(server.IsDeleted("default-app-tls")).To(BeFalse())
+	})
+
+	It("should tag the untagged certificate synced before the ownership tags", func() {
+		keyDER, err := x509.MarshalPKCS8PrivateKey(leaf.Key)
+		Expect(err).NotTo(HaveOccurred())
+		value := leaf.CertPEM + string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+		keyVault, err := server.NewClient()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = keyVault.ImportCertificate(ctx, "default-app-tls", azcertificates.ImportCertificateParameters{
+			Base64EncodedCertificate: &value,
+			Tags:                     map[string]*string{"team": to.Ptr("payments")},
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		stored := &apiv1alpha1.SyncSecretAKV{}
+		Expect(c.Get(ctx, request.NamespacedName, stored)).To(Succeed())
+		stored.Spec.SyncSecretAKVResourceVersion = stored.Spec.SecretResourceVersion
+		Expect(c.Update(ctx, stored)).To(Succeed())
+
+		_, err = r.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		bundle, ok := server.Certificate("default-app-tls")
+		Expect(ok).To(BeTrue())
+		Expect(bundle.Tags).To(HaveKeyWithValue("team", to.Ptr("payments")))
+		tags := map[string]string{}
+		for key, value := range bundle.Tags {
+			tags[key] = *value
+		}
+		Expect(GetCertificateOwnership(tags, &apiv1alpha1.Config{}, "default", "app-tls")).To(Equal(CertificateOwned))
+	})
+
+	It("should refuse an untagged certificate uploaded by hand under the name of a Secret never synced", func() {
+		keyDER, err := x509.MarshalPKCS8PrivateKey(leaf.Key)
+		Expect(err).NotTo(HaveOccurred())
+		value := leaf.CertPEM + string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+		keyVault, err := server.NewClient()
+		Expect(err).NotTo(HaveOccurred())
+		uploaded, err := keyVault.ImportCertificate(ctx, "default-app-tls", azcertificates.ImportCertificateParameters{
+			Base64EncodedCertificate: &value,
+			Tags:                     map[string]*string{"team": to.Ptr("payments")},
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = r.Reconcile(ctx, request)
+		Expect(err).To(MatchError(ErrCertificateNotOwned))
+		bundle, ok := server.Certificate("default-app-tls")
+		Expect(ok).To(BeTrue())
+		Expect(*bundle.ID).To(Equal(*uploaded.ID))
+		Expect(bundle.Tags).To(Equal(map[string]*string{"team": to.Ptr("payments")}))
+		stored := &apiv1alpha1.SyncSecretAKV{}
+		Expect(c.Get(ctx, request.NamespacedName, stored)).To(Succeed())
+		Expect(meta.FindStatusCondition(stored.Status.Conditions, apiv1alpha1.ConditionSynced).Reason).To(Equal(apiv1alpha1.ReasonCertificateNotOwned))
+	})
+
+	It("should delete the adopted certificate recorded in the status", func() {
+		keyDER, err := x509.MarshalPKCS8PrivateKey(leaf.Key)
+		Expect(err).NotTo(HaveOccurred())
+		value := leaf.CertPEM + string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+		keyVault, err := server.NewClient()
+		Expect(err).NotTo(HaveOccurred())
+		owned := map[string]*string{}
+		for key, tag := range OwnershipTags(&apiv1alpha1.Config{}, "default", "app-tls") {
+			owned[key] = to.Ptr(tag)
+		}
+		_, err = keyVault.ImportCertificate(ctx, "legacy-app", azcertificates.ImportCertificateParameters{Base64EncodedCertificate: &value, Tags: owned}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = keyVault.ImportCertificate(ctx, "default-app-tls", azcertificates.ImportCertificateParameters{Base64EncodedCertificate: &value}, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		stored := &apiv1alpha1.SyncSecretAKV{}
+		Expect(c.Get(ctx, request.NamespacedName, stored)).To(Succeed())
+		stored.Spec.SyncSecretAKVResourceVersion = stored.Spec.SecretResourceVersion
+		Expect(c.Update(ctx, stored)).To(Succeed())
+		stored.Status.CertificateName = "legacy-app"
+		Expect(c.Status().Update(ctx, stored)).To(Succeed())
+
+		_, err = r.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(ctx, request.NamespacedName, stored)).To(Succeed())
+		Expect(stored.Finalizers).To(ContainElement(apiv1alpha1.FinalizerCertificate))
+
+		Expect(c.Delete(ctx, stored)).To(Succeed())
+		_, err = r.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		_, ok := server.Certificate("legacy-app")
+		Expect(ok).To(BeFalse())
+		Expect(server.IsDeleted("legacy-app")).To(BeFalse())
+		_, ok = server.Certificate("default-app-tls")
+		Expect(ok).To(BeTrue())
+		Expect(apierrors.IsNotFound(c.Get(ctx, request.NamespacedName, stored))).To(BeTrue())
+	})
+
+	It("should keep the finalizer while the deletion is skipped in dry run", func() {
+		_, err := r.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		config := &apiv1alpha1.Config{}
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "config"}, config)).To(Succeed())
+		config.Spec.DryRun = true
+		Expect(c.Update(ctx, config)).To(Succeed())
+
+		stored := &apiv1alpha1.SyncSecretAKV{}
+		Expect(c.Get(ctx, request.NamespacedName, stored)).To(Succeed())
+		Expect(c.Delete(ctx, stored)).To(Succeed())
+		result, err := r.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(dryRunRequeueInterval))
+		_, ok := server.Certificate("default-app-tls")
+		Expect(ok).To(BeTrue())
+		Expect(c.Get(ctx, request.NamespacedName, stored)).To(Succeed())
+		Expect(stored.Finalizers).To(ContainElement(apiv1alpha1.FinalizerCertificate))
+		Expect(stored.Status.SyncStatus).To(Equal("DryRun"))
+		Expect(stored.Status.SyncStatusMessage).To(Equal("Dry run: would delete and purge Azure Key Vault Certificate default-app-tls"))
+
+		config.Spec.DryRun = false
+		Expect(c.Update(ctx, config)).To(Succeed())
+		_, err = r.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		_, ok = server.Certificate("default-app-tls")
+		Expect(ok).To(BeFalse())
+		Expect(apierrors.IsNotFound(c.Get(ctx, request.NamespacedName, stored))).To(BeTrue())
+	})
+
+	It("should finish purging a certificate deleted by a failed attempt", func() {
+		_, err := r.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		stored := &apiv1alpha1.SyncSecretAKV{}
+		Expect(c.Get(ctx, request.NamespacedName, stored)).To(Succeed())
+		Expect(c.Delete(ctx, stored)).To(Succeed())
+		Expect(c.Delete(ctx, secret)).To(Succeed())
+
+		server.FailNext(1, fakekeyvault.Fault{StatusCode: http.StatusServiceUnavailable, Code: "ServiceUnavailable", Method: http.MethodDelete, PathPrefix: "/deletedcertificates/"})
+		_, err = r.Reconcile(ctx, request)
+		Expect(err).To(HaveOccurred())
+		Expect(server.IsDeleted("default-app-tls")).To(BeTrue())
+
+		// The certificate is no longer found, the retry purges the deleted certificate
+		_, err = r.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.IsDeleted("default-app-tls")).To(BeFalse())
+		_, ok := server.Certificate("default-app-tls")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should record only the successful deletions in the deletion brake of the Config status", func() {
+		_, err := r.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		stored := &apiv1alpha1.SyncSecretAKV{}
+		Expect(c.Get(ctx, request.NamespacedName, stored)).To(Succeed())
+		Expect(c.Delete(ctx, stored)).To(Succeed())
+		Expect(c.Delete(ctx, secret)).To(Succeed())
+
+		server.FailNext(1, fakekeyvault.Fault{StatusCode: http.StatusServiceUnavailable, Code: "ServiceUnavailable", Method: http.MethodDelete, PathPrefix: "/certificates/"})
+		_, err = r.Reconcile(ctx, request)
+		Expect(err).To(HaveOccurred())
+		config := &apiv1alpha1.Config{}
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "config"}, config)).To(Succeed())
+		Expect(config.Status.DeletionBrake).To(BeNil())
+
+		_, err = r.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "config"}, config)).To(Succeed())
+		Expect(config.Status.DeletionBrake).NotTo(BeNil())
+		Expect(config.Status.DeletionBrake.Deletions).To(HaveLen(1))
+	})
+
+	It("should not restart the grace period of a tampered deletion timestamp", func() {
+		config := &apiv1alpha1.Config{}
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "config"}, config)).To(Succeed())
+		config.Spec.DeletionGracePeriod = &metav1.Duration{Duration: 10 * time.Minute}
+		Expect(c.Update(ctx, config)).To(Succeed())
+		stored := &apiv1alpha1.SyncSecretAKV{}
+		Expect(c.Get(ctx, request.NamespacedName, stored)).To(Succeed())
+		stored.Annotations = map[string]string{apiv1alpha1.AnnotationSecretDeletedAt: "not a timestamp"}
+		Expect(c.Update(ctx, stored)).To(Succeed())
+		Expect(c.Delete(ctx, secret)).To(Succeed())
+
+		first, err := r.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(c.Get(ctx, request.NamespacedName, stored)).To(Succeed())
+		deletedAt := stored.Annotations[apiv1alpha1.AnnotationSecretDeletedAt]
+		_, err = time.Parse(time.RFC3339, deletedAt)
+		Expect(err).NotTo(HaveOccurred())
+
+		second, err := r.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second.RequeueAfter).To(BeNumerically("<=", first.RequeueAfter))
+		Expect(c.Get(ctx, request.NamespacedName, stored)).To(Succeed())
+		Expect(stored.Annotations).To(HaveKeyWithValue(apiv1alpha1.AnnotationSecretDeletedAt, deletedAt))
+	})
+
+	It("should requeue after the Retry-After delay of a throttled Key Vault", func() {
+		server.Throttle(1, 30*time.Second)
+
+		result, err := r.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(30 * time.Second))
+		stored := &apiv1alpha1.SyncSecretAKV{}
+		Expect(c.Get(ctx, request.NamespacedName, stored)).To(Succeed())
+		Expect(meta.FindStatusCondition(stored.Status.Conditions, apiv1alpha1.ConditionSynced).Reason).To(Equal(apiv1alpha1.ReasonThrottled))
+		Expect(stored.Status.FailureClass).To(Equal(apiv1alpha1.FailureClassTransient))
+	})
+
+	It("should stop retrying when the name is held by a deleted certificate", func() {
+		keyDER, err := x509.MarshalPKCS8PrivateKey(leaf.Key)
+		Expect(err).NotTo(HaveOccurred())
+		value := leaf.CertPEM + string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+		keyVault, err := server.NewClient()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = keyVault.ImportCertificate(ctx, "default-app-tls", azcertificates.ImportCertificateParameters{Base64EncodedCertificate: &value}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = keyVault.DeleteCertificate(ctx, "default-app-tls", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = r.Reconcile(ctx, request)
+		Expect(errors.Is(err, reconcile.TerminalError(nil))).To(BeTrue())
+		stored := &apiv1alpha1.SyncSecretAKV{}
+		Expect(c.Get(ctx, request.NamespacedName, stored)).To(Succeed())
+		Expect(stored.Status.SyncStatus).To(Equal("Failed"))
+		Expect(stored.Status.SyncStatusMessage).To(ContainSubstring("409 Conflict"))
+		Expect(stored.Status.FailureClass).To(Equal(apiv1alpha1.FailureClassTerminal))
+	})
+})
@@ -0,0 +1,267 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+	"github.com/welasco/syncsecretakv/internal/events"
+	"github.com/welasco/syncsecretakv/internal/metrics"
+)
+
+// DefaultGarbageCollectionInterval is how often the garbage collector looks for orphaned certificates
+const DefaultGarbageCollectionInterval = time.Hour
+
+// OrphanedCertificate is a certificate owned by this cluster whose SyncSecretAKV no longer exists
+type OrphanedCertificate struct {
+	// Name is the certificate name in the store
+	Name string
+	// Secret is the Secret the certificate was imported from, read from the ownership tags
+	Secret types.NamespacedName
+}
+
+// GarbageCollector periodically lists the certificate store of the Config in effect and reports or deletes the
+// certificates owned by this cluster whose SyncSecretAKV no longer exists, for instance because the Secret was
+// deleted while the controller was down. It runs on the leader only.
+type GarbageCollector struct {
+	client.Client
+	Recorder record.EventRecorder
+	Interval time.Duration
+	// NewStore opens the certificate store of the Config, DefaultStoreFactory when nil
+	NewStore StoreFactory
+}
+
+// Start implements manager.Runnable
+func (gc *GarbageCollector) Start(ctx context.Context) error {
+	interval := gc.Interval
+	if interval <= 0 {
+		interval = DefaultGarbageCollectionInterval
+	}
+	log.Log.Info("GarbageCollector - Starting with interval " + interval.String())
+	wait.UntilWithContext(ctx, gc.Collect, interval)
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (gc *GarbageCollector) NeedLeaderElection() bool {
+	return true
+}
+
+// Collect runs a single garbage collection
+func (gc *GarbageCollector) Collect(ctx context.Context) {
+	config, err := LoadConfig(ctx, gc.Client)
+	if err != nil {
+		log.Log.Info("GarbageCollector - No Config found, skipping garbage collection")
+		return
+	}
+	if config.Spec.GarbageCollection == apiv1alpha1.GarbageCollectionDisabled {
+		return
+	}
+
+	store, err := gc.NewStore.open(config)
+	if err != nil {
+		log.Log.Error(err, "GarbageCollector - Unable to open the certificate store")
+		return
+	}
+	callCtx, cancel := keyVaultContext(ctx, OperationListCertificates)
+	start := time.Now()
+	certificates, err := store.List(callCtx)
+	cancel()
+	observeKeyVaultOperation(config, OperationListCertificates, start, err)
+	if err != nil {
+		log.Log.Error(err, "GarbageCollector - Unable to list certificates in the certificate store")
+		return
+	}
+
+	orphans, err := FindOrphanedCertificates(ctx, gc.Client, config, certificates)
+	if err != nil {
+		log.Log.Error(err, "GarbageCollector - Unable to check the SyncSecretAKVs of the certificates")
+		return
+	}
+
+	remaining := len(orphans)
+	deleteOrphans := config.Spec.GarbageCollection == apiv1alpha1.GarbageCollectionDelete && config.Spec.AllowAzKeyVaultCertificateDeletion
+	if message := clusterIDRequiredMessage(config); message != "" {
+		log.Log.Info("GarbageCollector - " + message)
+		events.Emit(gc.Recorder, configObject(config), corev1.EventTypeWarning, events.ReasonDeletionBlocked, message)
+		err := updateConfigStatus(ctx, gc.Client, config, func(status *apiv1alpha1.ConfigStatus, generation int64) {
+			SetCondition(&status.Conditions, generation, apiv1alpha1.ConditionDegraded, metav1.ConditionTrue, apiv1alpha1.ReasonClusterIDRequired, message)
+		})
+		if err != nil {
+			log.Log.Error(err, "GarbageCollector - Failed to mark the Config Degraded")
+		}
+		deleteOrphans = false
+	}
+	if deleteOrphans {
+		if err := restoreDeletionBrake(ctx, gc.Client, config); err != nil {
+			log.Log.Error(err, "GarbageCollector - Unable to read the deletion brake from the Config status")
+			return
+		}
+		for _, orphan := range orphans {
+			log.Log.Info("GarbageCollector - Deleting orphaned Azure Key Vault Certificate: " + orphan.Name)
+			result, err := DeleteCertificate(ctx, store, config, orphan.Name, orphan.Secret, false)
+			if result.Deleted {
+				persistDeletionBrake(ctx, gc.Client, config)
+			}
+			if errors.Is(err, ErrDeletionBrakeEngaged) {
+				reportDeletionBrake(ctx, gc.Client, gc.Recorder, config)
+				break
+			}
+			if err != nil {
+				_, message := SummarizeError(err)
+				events.Emit(gc.Recorder, configObject(config), corev1.EventTypeWarning, events.ReasonDeleteFailed, "Failed to delete orphaned Azure Key Vault Certificate "+orphan.Name+": "+message)
+				continue
+			}
+			if result.DryRun {
+				events.Emit(gc.Recorder, configObject(config), corev1.EventTypeNormal, events.ReasonDryRun, dryRunMessage("delete orphaned Azure Key Vault Certificate "+orphan.Name))
+			}
+			if result.Deleted {
+				remaining--
+				events.Emit(gc.Recorder, configObject(config), corev1.EventTypeNormal, events.ReasonDeleted, "Deleted orphaned Azure Key Vault Certificate "+orphan.Name)
+			}
+		}
+	} else if len(orphans) > 0 {
+		log.Log.Info("GarbageCollector - Found " + strconv.Itoa(len(orphans)) + " orphaned Azure Key Vault Certificates, not deleting them per GarbageCollection " + string(config.Spec.GarbageCollection))
+	}
+
+	metrics.OrphanedCertificates.WithLabelValues(StoreURL(config)).Set(float64(remaining))
+	if err := recordGarbageCollection(ctx, gc.Client, config, int32(remaining), time.Now()); err != nil {
+		log.Log.Error(err, "GarbageCollector - Failed to update Config status")
+	}
+}
+
+// FindOrphanedCertificates returns the certificates owned by this cluster whose SyncSecretAKV no longer exists
+func FindOrphanedCertificates(ctx context.Context, c client.Reader, config *apiv1alpha1.Config, certificates []*certstore.Certificate) ([]OrphanedCertificate, error) {
+	orphans := []OrphanedCertificate{}
+	for _, certificate := range certificates {
+		if certificate == nil {
+			continue
+		}
+		orphaned, err := isOrphanedCertificate(ctx, c, config, certificate.Tags)
+		if err != nil {
+			return nil, err
+		}
+		if orphaned {
+			orphans = append(orphans, OrphanedCertificate{
+				Name:   certificate.Name,
+				Secret: types.NamespacedName{Namespace: certificate.Tags[CertificateTagNamespace], Name: certificate.Tags[CertificateTagSecretName]},
+			})
+		}
+	}
+	return orphans, nil
+}
+
+// isOrphanedCertificate reports whether the certificate tags mark it as owned by this cluster while the
+// SyncSecretAKV of the Secret it was imported from no longer exists
+func isOrphanedCertificate(ctx context.Context, c client.Reader, config *apiv1alpha1.Config, tags map[string]string) (bool, error) {
+	if tags[CertificateTagManagedBy] != CertificateManagedByValue || tags[CertificateTagClusterID] != ClusterIDForConfig(config) {
+		return false, nil
+	}
+	namespace, name := tags[CertificateTagNamespace], tags[CertificateTagSecretName]
+	if namespace == "" || name == "" {
+		return false, nil
+	}
+
+	err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &apiv1alpha1.SyncSecretAKV{})
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	}
+	return false, err
+}
+
+// clusterIDRequiredMessage explains why the orphans of the Config are not deleted, empty when they may be. Without
+// an explicit ClusterID every cluster sharing the vault tags its certificates with DefaultClusterID, so the
+// certificates of the other clusters would look orphaned.
+func clusterIDRequiredMessage(config *apiv1alpha1.Config) string {
+	if config.Spec.GarbageCollection != apiv1alpha1.GarbageCollectionDelete || !config.Spec.AllowAzKeyVaultCertificateDeletion || HasExplicitClusterID(config) {
+		return ""
+	}
+	return "garbageCollection Delete requires a clusterId other than " + DefaultClusterID + ", orphaned certificates are only reported"
+}
+
+// configObject returns the Config or ClusterConfig the Config in effect was loaded from, to attach events to it.
+// LoadConfig converts a ClusterConfig into a Config without a namespace.
+func configObject(config *apiv1alpha1.Config) client.Object {
+	if config.Namespace == "" {
+		return &apiv1alpha1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: config.Name}}
+	}
+	return config
+}
+
+// recordGarbageCollection stores the orphan count in the status of the Config or ClusterConfig in effect
+func recordGarbageCollection(ctx context.Context, c client.Client, config *apiv1alpha1.Config, orphaned int32, now time.Time) error {
+	collected := metav1.NewTime(now)
+	return updateConfigStatus(ctx, c, config, func(status *apiv1alpha1.ConfigStatus, _ int64) {
+		status.OrphanedCertificates = orphaned
+		status.LastGarbageCollectionTime = &collected
+	})
+}
+
+// readConfigStatus returns the current status of the Config or, when it has no namespace, of the ClusterConfig
+// it was converted from. A deleted Config has an empty status.
+func readConfigStatus(ctx context.Context, c client.Client, config *apiv1alpha1.Config) (*apiv1alpha1.ConfigStatus, error) {
+	if config.Namespace == "" {
+		clusterConfig := &apiv1alpha1.ClusterConfig{}
+		if err := c.Get(ctx, types.NamespacedName{Name: config.Name}, clusterConfig); err != nil {
+			return &apiv1alpha1.ConfigStatus{}, client.IgnoreNotFound(err)
+		}
+		status := apiv1alpha1.ConfigStatus(clusterConfig.Status)
+		return &status, nil
+	}
+
+	current := &apiv1alpha1.Config{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(config), current); err != nil {
+		return &apiv1alpha1.ConfigStatus{}, client.IgnoreNotFound(err)
+	}
+	return &current.Status, nil
+}
+
+// updateConfigStatus applies mutate to the status of the Config or ClusterConfig the Config in effect was loaded
+// from. ConfigStatus and ClusterConfigStatus share the same fields, so the ClusterConfig status is converted.
+func updateConfigStatus(ctx context.Context, c client.Client, config *apiv1alpha1.Config, mutate func(status *apiv1alpha1.ConfigStatus, generation int64)) error {
+	if config.Namespace == "" {
+		clusterConfig := &apiv1alpha1.ClusterConfig{}
+		if err := c.Get(ctx, types.NamespacedName{Name: config.Name}, clusterConfig); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		status := apiv1alpha1.ConfigStatus(clusterConfig.Status)
+		mutate(&status, clusterConfig.Generation)
+		clusterConfig.Status = apiv1alpha1.ClusterConfigStatus(status)
+		return c.Status().Update(ctx, clusterConfig)
+	}
+
+	current := &apiv1alpha1.Config{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(config), current); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	mutate(&current.Status, current.Generation)
+	return c.Status().Update(ctx, current)
+}
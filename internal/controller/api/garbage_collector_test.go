@@ -0,0 +1,176 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+)
+
+var _ = Describe("Garbage collector", func() {
+	var scheme *runtime.Scheme
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(apiv1alpha1.AddToScheme(scheme)).To(Succeed())
+	})
+
+	It("should find the certificates of this cluster without a SyncSecretAKV", func() {
+		reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&apiv1alpha1.SyncSecretAKV{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-tls", Namespace: "default"},
+		}).Build()
+		config := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{ClusterID: "aks-prod"}}
+		otherCluster := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{ClusterID: "aks-dev"}}
+		item := func(name string, tags map[string]string) *certstore.Certificate {
+			return &certstore.Certificate{Name: name, Tags: tags}
+		}
+
+		orphans, err := FindOrphanedCertificates(context.Background(), reader, config, []*certstore.Certificate{
+			item("default-app-tls", OwnershipTags(config, "default", "app-tls")),
+			item("default-gone-tls", OwnershipTags(config, "default", "gone-tls")),
+			item("default-other-tls", OwnershipTags(otherCluster, "default", "other-tls")),
+			item("manual", nil),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphans).To(Equal([]OrphanedCertificate{
+			{Name: "default-gone-tls", Secret: types.NamespacedName{Namespace: "default", Name: "gone-tls"}},
+		}))
+	})
+
+	It("should only report certificates of this cluster without a SyncSecretAKV as orphaned", func() {
+		reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&apiv1alpha1.SyncSecretAKV{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-tls", Namespace: "default"},
+		}).Build()
+		config := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{ClusterID: "aks-prod"}}
+
+		orphaned, err := isOrphanedCertificate(context.Background(), reader, config, OwnershipTags(config, "default", "app-tls"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphaned).To(BeFalse())
+
+		orphaned, err = isOrphanedCertificate(context.Background(), reader, config, OwnershipTags(config, "default", "gone-tls"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphaned).To(BeTrue())
+
+		otherCluster := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{ClusterID: "aks-dev"}}
+		orphaned, err = isOrphanedCertificate(context.Background(), reader, config, OwnershipTags(otherCluster, "default", "gone-tls"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphaned).To(BeFalse())
+
+		orphaned, err = isOrphanedCertificate(context.Background(), reader, config, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphaned).To(BeFalse())
+	})
+
+	It("should record the orphan count on the Config or ClusterConfig in effect", func() {
+		config := &apiv1alpha1.Config{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "syncsecretakv-system"}}
+		clusterConfig := &apiv1alpha1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}}
+		c := fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(config, clusterConfig).
+			WithStatusSubresource(config, clusterConfig).
+			Build()
+		now := time.Now()
+
+		Expect(recordGarbageCollection(context.Background(), c, config, 3, now)).To(Succeed())
+		Expect(c.Get(context.Background(), types.NamespacedName{Name: "config", Namespace: "syncsecretakv-system"}, config)).To(Succeed())
+		Expect(config.Status.OrphanedCertificates).To(Equal(int32(3)))
+		Expect(config.Status.LastGarbageCollectionTime).NotTo(BeNil())
+
+		Expect(recordGarbageCollection(context.Background(), c, ConvertToConfig(clusterConfig), 2, now)).To(Succeed())
+		Expect(c.Get(context.Background(), types.NamespacedName{Name: "cluster"}, clusterConfig)).To(Succeed())
+		Expect(clusterConfig.Status.OrphanedCertificates).To(Equal(int32(2)))
+	})
+
+	Describe("two clusters sharing a vault", func() {
+		var store *memoryStore
+
+		BeforeEach(func() {
+			store = newMemoryStore()
+		})
+
+		// cluster returns a garbage collector with its own API server holding the Config and the SyncSecretAKV of
+		// the Secret synced by that cluster, and imports the certificates of that Secret and of a deleted Secret
+		cluster := func(clusterID string, secretName string) (*GarbageCollector, client.Client) {
+			config := &apiv1alpha1.Config{
+				ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "syncsecretakv-system"},
+				Spec: apiv1alpha1.ConfigSpec{
+					AzKeyVaultURL:                      "memory://shared-" + clusterID,
+					ClusterID:                          clusterID,
+					AllowAzKeyVaultCertificateDeletion: true,
+					GarbageCollection:                  apiv1alpha1.GarbageCollectionDelete,
+				},
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(config, &apiv1alpha1.SyncSecretAKV{ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: "default"}}).
+				WithStatusSubresource(config).
+				Build()
+			store.certificates["default-"+secretName] = &certstore.Certificate{Name: "default-" + secretName, Tags: OwnershipTags(config, "default", secretName)}
+			store.certificates["default-gone-"+secretName] = &certstore.Certificate{Name: "default-gone-" + secretName, Tags: OwnershipTags(config, "default", "gone-"+secretName)}
+			return &GarbageCollector{
+				Client:   c,
+				Recorder: record.NewFakeRecorder(10),
+				NewStore: func(*apiv1alpha1.Config) (certstore.Store, error) { return store, nil },
+			}, c
+		}
+
+		configStatus := func(c client.Client) apiv1alpha1.ConfigStatus {
+			config := &apiv1alpha1.Config{}
+			Expect(c.Get(context.Background(), types.NamespacedName{Name: "config", Namespace: "syncsecretakv-system"}, config)).To(Succeed())
+			return config.Status
+		}
+
+		It("should not delete the certificates of the other cluster with the default cluster ID", func() {
+			blue, blueClient := cluster("", "blue-tls")
+			green, _ := cluster(DefaultClusterID, "green-tls")
+
+			blue.Collect(context.Background())
+			green.Collect(context.Background())
+			Expect(store.certificates).To(HaveLen(4))
+			Expect(store.purged).To(BeEmpty())
+
+			status := configStatus(blueClient)
+			Expect(status.OrphanedCertificates).To(Equal(int32(3)))
+			degraded := meta.FindStatusCondition(status.Conditions, apiv1alpha1.ConditionDegraded)
+			Expect(degraded).NotTo(BeNil())
+			Expect(degraded.Reason).To(Equal(apiv1alpha1.ReasonClusterIDRequired))
+		})
+
+		It("should only delete the orphans of each cluster with explicit cluster IDs", func() {
+			blue, blueClient := cluster("aks-blue", "blue-tls")
+			green, _ := cluster("aks-green", "green-tls")
+
+			blue.Collect(context.Background())
+			green.Collect(context.Background())
+			Expect(store.certificates).To(HaveKey("default-blue-tls"))
+			Expect(store.certificates).To(HaveKey("default-green-tls"))
+			Expect(store.purged).To(ConsistOf("default-gone-blue-tls", "default-gone-green-tls"))
+			Expect(meta.FindStatusCondition(configStatus(blueClient).Conditions, apiv1alpha1.ConditionDegraded)).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,112 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Defaults for the Azure Key Vault call timeouts
+const (
+	// DefaultOperationTimeout bounds every Azure Key Vault call without a specific timeout
+	DefaultOperationTimeout = 30 * time.Second
+	// DefaultDrainTimeout is how long calls already in flight may keep running once the manager is stopping
+	DefaultDrainTimeout = 20 * time.Second
+)
+
+// OperationTimeouts bounds the Azure Key Vault calls made by the reconcilers
+type OperationTimeouts struct {
+	// Default applies to the operations missing from Operations
+	Default time.Duration
+	// Operations holds the timeout of individual operations, keyed by the Operation constants
+	Operations map[string]time.Duration
+	// Drain is how long a call in flight may continue after the reconcile context is cancelled
+	Drain time.Duration
+}
+
+// KeyVaultTimeouts is set from the manager flags before the reconcilers start
+var KeyVaultTimeouts = OperationTimeouts{
+	Default: DefaultOperationTimeout,
+	Drain:   DefaultDrainTimeout,
+}
+
+// For returns the timeout of the operation
+func (t OperationTimeouts) For(operation string) time.Duration {
+	if timeout, ok := t.Operations[operation]; ok && timeout > 0 {
+		return timeout
+	}
+	return t.Default
+}
+
+// ParseOperationTimeouts parses a comma separated list of Operation=duration pairs,
+// for example "ImportCertificate=1m,ListCertificates=2m"
+func ParseOperationTimeouts(value string) (map[string]time.Duration, error) {
+	known := map[string]bool{}
+	for _, operation := range []string{OperationGetCertificate, OperationImportCertificate, OperationDeleteCertificate,
+		OperationGetDeletedCertificate, OperationPurgeDeletedCertificate, OperationUpdateCertificatePolicy, OperationUpdateCertificate, OperationListCertificates} {
+		known[operation] = true
+	}
+
+	timeouts := map[string]time.Duration{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		operation, duration, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid operation timeout %q, expected Operation=duration", pair)
+		}
+		if !known[operation] {
+			return nil, fmt.Errorf("unknown Azure Key Vault operation %q", operation)
+		}
+		timeout, err := time.ParseDuration(duration)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q for operation %s", duration, operation)
+		}
+		timeouts[operation] = timeout
+	}
+	return timeouts, nil
+}
+
+// keyVaultContext returns the context of a single Azure Key Vault call. The call is bounded by the operation
+// timeout. When ctx is cancelled, because the manager is shutting down or lost the leader election, a call in
+// flight is given the drain timeout to complete instead of being aborted halfway, while no new call is started.
+func keyVaultContext(ctx context.Context, operation string) (context.Context, context.CancelFunc) {
+	if ctx.Err() != nil {
+		return ctx, func() {}
+	}
+
+	callCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), KeyVaultTimeouts.For(operation))
+	drain := KeyVaultTimeouts.Drain
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(drain)
+		defer timer.Stop()
+		select {
+		case <-callCtx.Done():
+		case <-timer.C:
+			cancel()
+		}
+	})
+	return callCtx, func() {
+		stop()
+		cancel()
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Azure Key Vault call context", func() {
+	var saved OperationTimeouts
+
+	BeforeEach(func() {
+		saved = KeyVaultTimeouts
+	})
+
+	AfterEach(func() {
+		KeyVaultTimeouts = saved
+	})
+
+	It("should parse per operation timeouts", func() {
+		timeouts, err := ParseOperationTimeouts("ImportCertificate=1m, ListCertificates=90s")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(timeouts).To(Equal(map[string]time.Duration{
+			OperationImportCertificate: time.Minute,
+			OperationListCertificates:  90 * time.Second,
+		}))
+
+		timeouts = map[string]time.Duration{OperationImportCertificate: time.Minute}
+		Expect(OperationTimeouts{Default: time.Second, Operations: timeouts}.For(OperationImportCertificate)).To(Equal(time.Minute))
+		Expect(OperationTimeouts{Default: time.Second, Operations: timeouts}.For(OperationGetCertificate)).To(Equal(time.Second))
+
+		_, err = ParseOperationTimeouts("ImportCertificate")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseOperationTimeouts("CreateCertificate=1m")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseOperationTimeouts("ImportCertificate=-1s")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should bound calls by the operation timeout", func() {
+		KeyVaultTimeouts = OperationTimeouts{Default: 20 * time.Millisecond, Drain: time.Hour}
+		callCtx, cancel := keyVaultContext(context.Background(), OperationGetCertificate)
+		defer cancel()
+		Eventually(callCtx.Done()).Should(BeClosed())
+	})
+
+	It("should let calls in flight drain after the reconcile context is cancelled", func() {
+		KeyVaultTimeouts = OperationTimeouts{Default: time.Hour, Drain: 100 * time.Millisecond}
+		ctx, cancelReconcile := context.WithCancel(context.Background())
+		callCtx, cancel := keyVaultContext(ctx, OperationImportCertificate)
+		defer cancel()
+
+		cancelReconcile()
+		Consistently(callCtx.Done(), 50*time.Millisecond).ShouldNot(BeClosed())
+		Eventually(callCtx.Done()).Should(BeClosed())
+
+		// No new call starts once the reconcile context is cancelled
+		nextCtx, nextCancel := keyVaultContext(ctx, OperationPurgeDeletedCertificate)
+		defer nextCancel()
+		Expect(nextCtx.Err()).To(MatchError(context.Canceled))
+	})
+})
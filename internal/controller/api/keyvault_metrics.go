@@ -0,0 +1,128 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+	"github.com/welasco/syncsecretakv/internal/metrics"
+)
+
+// Azure Key Vault operations reported in the metrics
+const (
+	OperationGetCertificate          = "GetCertificate"
+	OperationImportCertificate       = "ImportCertificate"
+	OperationDeleteCertificate       = "DeleteCertificate"
+	OperationGetDeletedCertificate   = "GetDeletedCertificate"
+	OperationPurgeDeletedCertificate = "PurgeDeletedCertificate"
+	OperationUpdateCertificatePolicy = "UpdateCertificatePolicy"
+	OperationUpdateCertificate       = "UpdateCertificate"
+	OperationListCertificates        = "ListCertificates"
+)
+
+// DefaultSyncStateMetricsInterval is how often the SyncSecretAKVs are recounted by sync state
+const DefaultSyncStateMetricsInterval = time.Minute
+
+// syncStatePending is reported for SyncSecretAKVs that have not been processed yet
+const syncStatePending = "Pending"
+
+// observeKeyVaultOperation records the result and latency of an Azure Key Vault call that started at start
+func observeKeyVaultOperation(config *apiv1alpha1.Config, operation string, start time.Time, err error) {
+	result := metrics.ResultSuccess
+	if certstore.IsNotFound(err) {
+		result = metrics.ResultNotFound
+	} else if err != nil {
+		result = metrics.ResultError
+	}
+	metrics.ObserveOperation(StoreURL(config), operation, result, start)
+}
+
+// SyncStateMetrics periodically recounts the SyncSecretAKVs by sync state for each Config. A SyncSecretAKV is
+// counted under the Config of its namespace, or under the ClusterConfig when its namespace has none. It runs on
+// the leader only, like the controllers that update the sync state.
+type SyncStateMetrics struct {
+	client.Reader
+	Interval time.Duration
+}
+
+// Start implements manager.Runnable
+func (m *SyncStateMetrics) Start(ctx context.Context) error {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = DefaultSyncStateMetricsInterval
+	}
+	wait.UntilWithContext(ctx, m.Update, interval)
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (m *SyncStateMetrics) NeedLeaderElection() bool {
+	return true
+}
+
+// Update recounts the SyncSecretAKVs by Config and sync state
+func (m *SyncStateMetrics) Update(ctx context.Context) {
+	syncSecretAKVs := &apiv1alpha1.SyncSecretAKVList{}
+	configs := &apiv1alpha1.ConfigList{}
+	clusterConfigs := &apiv1alpha1.ClusterConfigList{}
+	for _, list := range []client.ObjectList{syncSecretAKVs, configs, clusterConfigs} {
+		if err := m.List(ctx, list); err != nil {
+			log.Log.Error(err, "SyncStateMetrics - Unable to list objects to update metrics")
+			return
+		}
+	}
+
+	namespaceConfigs := map[string]string{}
+	for _, config := range configs.Items {
+		if _, found := namespaceConfigs[config.Namespace]; !found {
+			namespaceConfigs[config.Namespace] = config.Name
+		}
+	}
+	clusterConfig := ""
+	if len(clusterConfigs.Items) > 0 {
+		clusterConfig = clusterConfigs.Items[0].Name
+	}
+
+	type configState struct{ config, state string }
+	counts := map[configState]float64{}
+	for _, syncSecretAKV := range syncSecretAKVs.Items {
+		config, found := namespaceConfigs[syncSecretAKV.Namespace]
+		if !found {
+			config = clusterConfig
+		}
+		if config == "" {
+			continue
+		}
+		state := syncSecretAKV.Status.SyncStatus
+		if state == "" {
+			state = syncStatePending
+		}
+		counts[configState{config, state}]++
+	}
+
+	metrics.SecretsBySyncState.Reset()
+	for key, count := range counts {
+		metrics.SecretsBySyncState.WithLabelValues(key.config, key.state).Set(count)
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/metrics"
+)
+
+var _ = Describe("Sync state metrics", func() {
+	It("should count the SyncSecretAKVs under the Config of their namespace or the ClusterConfig", func() {
+		scheme := runtime.NewScheme()
+		Expect(apiv1alpha1.AddToScheme(scheme)).To(Succeed())
+		syncSecretAKV := func(namespace, name, state string) *apiv1alpha1.SyncSecretAKV {
+			return &apiv1alpha1.SyncSecretAKV{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				Status:     apiv1alpha1.SyncSecretAKVStatus{SyncStatus: state},
+			}
+		}
+		reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&apiv1alpha1.Config{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "team-a"}},
+			&apiv1alpha1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}},
+			syncSecretAKV("team-a", "app-tls", "Success"),
+			syncSecretAKV("team-a", "api-tls", "Failed"),
+			syncSecretAKV("default", "web-tls", "Success"),
+			syncSecretAKV("default", "new-tls", ""),
+		).Build()
+		metrics.SecretsBySyncState.WithLabelValues("removed", "Success").Set(3)
+
+		(&SyncStateMetrics{Reader: reader}).Update(context.Background())
+
+		Expect(testutil.CollectAndCount(metrics.SecretsBySyncState)).To(Equal(4))
+		Expect(testutil.ToFloat64(metrics.SecretsBySyncState.WithLabelValues("team-a", "Success"))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(metrics.SecretsBySyncState.WithLabelValues("team-a", "Failed"))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(metrics.SecretsBySyncState.WithLabelValues("cluster", "Success"))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(metrics.SecretsBySyncState.WithLabelValues("cluster", syncStatePending))).To(Equal(1.0))
+	})
+})
@@ -0,0 +1,72 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+// DeletionGracePeriod returns the time the certificate of a deleted Secret is kept, 0 when it is deleted right away
+func DeletionGracePeriod(config *apiv1alpha1.Config) time.Duration {
+	if config.Spec.DeletionGracePeriod == nil || config.Spec.DeletionGracePeriod.Duration < 0 {
+		return 0
+	}
+	return config.Spec.DeletionGracePeriod.Duration
+}
+
+// MarkSecretDeleted records on the SyncSecretAKV when its Secret was first seen deleted. It is a no-op when the
+// SyncSecretAKV is already marked with a valid timestamp. An unreadable or future timestamp is replaced with now,
+// otherwise the grace period would start again on every reconcile and never run out.
+func MarkSecretDeleted(ctx context.Context, c client.Client, syncSecretAKV *apiv1alpha1.SyncSecretAKV, now time.Time) error {
+	if _, ok := secretDeletedAt(syncSecretAKV, now); ok {
+		return nil
+	}
+	if syncSecretAKV.Annotations == nil {
+		syncSecretAKV.Annotations = map[string]string{}
+	}
+	syncSecretAKV.Annotations[apiv1alpha1.AnnotationSecretDeletedAt] = now.UTC().Format(time.RFC3339)
+	return c.Update(ctx, syncSecretAKV)
+}
+
+// TombstoneRemaining returns how long the certificate of the deleted Secret is still kept. An unreadable
+// timestamp counts from now, so a tampered annotation cannot shorten the grace period; MarkSecretDeleted
+// replaces it so the period still runs out.
+func TombstoneRemaining(syncSecretAKV *apiv1alpha1.SyncSecretAKV, config *apiv1alpha1.Config, now time.Time) time.Duration {
+	deletedAt, ok := secretDeletedAt(syncSecretAKV, now)
+	if !ok {
+		deletedAt = now
+	}
+	return deletedAt.Add(DeletionGracePeriod(config)).Sub(now)
+}
+
+// secretDeletedAt returns the time recorded by MarkSecretDeleted, false when it is missing, unreadable or in the future
+func secretDeletedAt(syncSecretAKV *apiv1alpha1.SyncSecretAKV, now time.Time) (time.Time, bool) {
+	value, marked := syncSecretAKV.Annotations[apiv1alpha1.AnnotationSecretDeletedAt]
+	if !marked {
+		return time.Time{}, false
+	}
+	deletedAt, err := time.Parse(time.RFC3339, value)
+	if err != nil || deletedAt.After(now) {
+		return time.Time{}, false
+	}
+	return deletedAt, true
+}
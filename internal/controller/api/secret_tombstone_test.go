@@ -0,0 +1,85 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+var _ = Describe("Secret tombstone", func() {
+	var config *apiv1alpha1.Config
+
+	BeforeEach(func() {
+		config = &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{DeletionGracePeriod: &metav1.Duration{Duration: 10 * time.Minute}}}
+	})
+
+	It("should keep the certificate for the grace period after the Secret was first seen deleted", func() {
+		scheme := runtime.NewScheme()
+		Expect(apiv1alpha1.AddToScheme(scheme)).To(Succeed())
+		syncSecretAKV := &apiv1alpha1.SyncSecretAKV{ObjectMeta: metav1.ObjectMeta{Name: "app-tls", Namespace: "default"}}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(syncSecretAKV).Build()
+		deletedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+		Expect(MarkSecretDeleted(context.Background(), c, syncSecretAKV, deletedAt)).To(Succeed())
+		Expect(MarkSecretDeleted(context.Background(), c, syncSecretAKV, deletedAt.Add(time.Minute))).To(Succeed())
+
+		stored := &apiv1alpha1.SyncSecretAKV{}
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(syncSecretAKV), stored)).To(Succeed())
+		Expect(stored.Annotations).To(HaveKeyWithValue(apiv1alpha1.AnnotationSecretDeletedAt, "2024-05-01T10:00:00Z"))
+
+		Expect(TombstoneRemaining(stored, config, deletedAt.Add(4*time.Minute))).To(Equal(6 * time.Minute))
+		Expect(TombstoneRemaining(stored, config, deletedAt.Add(11*time.Minute))).To(BeNumerically("<=", 0))
+	})
+
+	It("should replace an unreadable timestamp when marking the SyncSecretAKV", func() {
+		scheme := runtime.NewScheme()
+		Expect(apiv1alpha1.AddToScheme(scheme)).To(Succeed())
+		syncSecretAKV := &apiv1alpha1.SyncSecretAKV{ObjectMeta: metav1.ObjectMeta{
+			Name:        "app-tls",
+			Namespace:   "default",
+			Annotations: map[string]string{apiv1alpha1.AnnotationSecretDeletedAt: "yesterday"},
+		}}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(syncSecretAKV).Build()
+		now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+		Expect(MarkSecretDeleted(context.Background(), c, syncSecretAKV, now)).To(Succeed())
+		Expect(syncSecretAKV.Annotations).To(HaveKeyWithValue(apiv1alpha1.AnnotationSecretDeletedAt, "2024-05-01T10:00:00Z"))
+		Expect(TombstoneRemaining(syncSecretAKV, config, now.Add(11*time.Minute))).To(BeNumerically("<=", 0))
+	})
+
+	It("should count an unreadable timestamp from now", func() {
+		syncSecretAKV := &apiv1alpha1.SyncSecretAKV{ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{apiv1alpha1.AnnotationSecretDeletedAt: "yesterday"},
+		}}
+		Expect(TombstoneRemaining(syncSecretAKV, config, time.Now())).To(Equal(10 * time.Minute))
+	})
+
+	It("should delete right away without a grace period", func() {
+		Expect(DeletionGracePeriod(&apiv1alpha1.Config{})).To(BeZero())
+		Expect(DeletionGracePeriod(config)).To(Equal(10 * time.Minute))
+	})
+})
@@ -0,0 +1,65 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+	"github.com/welasco/syncsecretakv/internal/certstore/azurekeyvault"
+	"github.com/welasco/syncsecretakv/internal/certstore/filesystem"
+	"github.com/welasco/syncsecretakv/internal/certstore/hashicorpvault"
+)
+
+// StoreFactory returns the certificate store the Secrets of the Config are synced to
+type StoreFactory func(config *apiv1alpha1.Config) (certstore.Store, error)
+
+// DefaultStoreFactory opens the store selected by the Config Backend, Azure Key Vault when unset
+func DefaultStoreFactory(config *apiv1alpha1.Config) (certstore.Store, error) {
+	switch config.Spec.Backend {
+	case "", apiv1alpha1.CertificateStoreAzureKeyVault:
+		return azurekeyvault.New(config)
+	case apiv1alpha1.CertificateStoreHashiCorpVault:
+		return hashicorpvault.New(config)
+	case apiv1alpha1.CertificateStoreFilesystem:
+		return filesystem.New(config)
+	default:
+		return nil, fmt.Errorf("unsupported certificate store backend %q", config.Spec.Backend)
+	}
+}
+
+// StoreURL returns the URL identifying the store of the Config in status, metrics and deletion limits: the
+// Key Vault URL, the URL of the KV v2 mount for HashiCorp Vault or the file URL of the directory
+func StoreURL(config *apiv1alpha1.Config) string {
+	switch {
+	case config.Spec.Backend == apiv1alpha1.CertificateStoreHashiCorpVault && config.Spec.HashiCorpVault != nil:
+		return hashicorpvault.MountURL(config.Spec.HashiCorpVault)
+	case config.Spec.Backend == apiv1alpha1.CertificateStoreFilesystem && config.Spec.Filesystem != nil:
+		return filesystem.URL(config.Spec.Filesystem)
+	default:
+		return config.Spec.AzKeyVaultURL
+	}
+}
+
+// open returns the store of the Config, using DefaultStoreFactory when the factory is nil
+func (f StoreFactory) open(config *apiv1alpha1.Config) (certstore.Store, error) {
+	if f == nil {
+		f = DefaultStoreFactory
+	}
+	return f(config)
+}
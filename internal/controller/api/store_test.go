@@ -0,0 +1,168 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+	"github.com/welasco/syncsecretakv/internal/certstore/filesystem"
+	"github.com/welasco/syncsecretakv/internal/certstore/hashicorpvault"
+)
+
+// memoryStore is a certstore.Store keeping the certificates in a map
+type memoryStore struct {
+	certificates map[string]*certstore.Certificate
+	purged       []string
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{certificates: map[string]*certstore.Certificate{}}
+}
+
+func (s *memoryStore) Import(_ context.Context, name string, request certstore.ImportRequest) (*certstore.Certificate, error) {
+	thumbprint, err := certstore.Thumbprint(request.CertificatePEM)
+	if err != nil {
+		return nil, err
+	}
+	s.certificates[name] = &certstore.Certificate{Name: name, ID: "memory://" + name, Thumbprint: thumbprint, Tags: request.Tags}
+	return s.certificates[name], nil
+}
+
+func (s *memoryStore) Get(_ context.Context, name string) (*certstore.Certificate, error) {
+	if certificate, ok := s.certificates[name]; ok {
+		return certificate, nil
+	}
+	return nil, certstore.ErrNotFound
+}
+
+func (s *memoryStore) Delete(_ context.Context, name string) error {
+	if _, ok := s.certificates[name]; !ok {
+		return certstore.ErrNotFound
+	}
+	delete(s.certificates, name)
+	return nil
+}
+
+func (s *memoryStore) Purge(_ context.Context, name string) error {
+	s.purged = append(s.purged, name)
+	return nil
+}
+
+func (s *memoryStore) List(_ context.Context) ([]*certstore.Certificate, error) {
+	certificates := []*certstore.Certificate{}
+	for _, certificate := range s.certificates {
+		certificates = append(certificates, certificate)
+	}
+	return certificates, nil
+}
+
+func (s *memoryStore) SetTags(_ context.Context, name string, tags map[string]string) (*certstore.Certificate, error) {
+	certificate, ok := s.certificates[name]
+	if !ok {
+		return nil, certstore.ErrNotFound
+	}
+	certificate.Tags = tags
+	return certificate, nil
+}
+
+var _ = Describe("Certificate store", func() {
+	leaf := newTestCertificate([]string{"app.example.com"}, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour), nil)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-tls", Namespace: "default"},
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte(leaf.CertPEM),
+			corev1.TLSPrivateKeyKey: []byte(leaf.KeyPEM),
+		},
+	}
+	secretName := types.NamespacedName{Namespace: "default", Name: "app-tls"}
+
+	It("should open the store selected by the factory", func() {
+		store := newMemoryStore()
+		factory := StoreFactory(func(*apiv1alpha1.Config) (certstore.Store, error) { return store, nil })
+		Expect(factory.open(&apiv1alpha1.Config{})).To(BeIdenticalTo(store))
+
+		_, err := DefaultStoreFactory(&apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{Backend: "Unknown"}})
+		Expect(err).To(MatchError(ContainSubstring("unsupported certificate store backend")))
+	})
+
+	It("should identify the store by the Key Vault URL, the HashiCorp Vault mount or the directory", func() {
+		Expect(StoreURL(&apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{AzKeyVaultURL: "https://vault.vault.azure.net/"}})).
+			To(Equal("https://vault.vault.azure.net/"))
+
+		config := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{
+			Backend:        apiv1alpha1.CertificateStoreHashiCorpVault,
+			HashiCorpVault: &apiv1alpha1.HashiCorpVaultSpec{Address: "https://vault.example.com:8200/", Mount: "kv"},
+		}}
+		Expect(StoreURL(config)).To(Equal("https://vault.example.com:8200/v1/kv"))
+		store, err := DefaultStoreFactory(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store).To(BeAssignableToTypeOf(&hashicorpvault.Store{}))
+
+		config = &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{
+			Backend:    apiv1alpha1.CertificateStoreFilesystem,
+			Filesystem: &apiv1alpha1.FilesystemSpec{Path: "/var/lib/syncsecretakv/"},
+		}}
+		Expect(StoreURL(config)).To(Equal("file:///var/lib/syncsecretakv"))
+		store, err = DefaultStoreFactory(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store).To(BeAssignableToTypeOf(&filesystem.Store{}))
+	})
+
+	It("should import the Secret with the ownership tags and refuse certificates owned by someone else", func() {
+		store := newMemoryStore()
+		config := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{AzKeyVaultURL: "memory://import"}}
+
+		certificate, err := ImportOrUpdateCertificate(context.Background(), store, config, "default-app-tls", secret, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(GetCertificateOwnership(certificate.Tags, config, "default", "app-tls")).To(Equal(CertificateOwned))
+
+		store.certificates["default-app-tls"].Tags = map[string]string{CertificateTagManagedBy: "someone-else"}
+		_, err = ImportOrUpdateCertificate(context.Background(), store, config, "default-app-tls", secret, true)
+		Expect(err).To(MatchError(ErrCertificateNotOwned))
+	})
+
+	It("should delete and purge owned certificates only when the Config allows it", func() {
+		store := newMemoryStore()
+		config := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{AzKeyVaultURL: "memory://delete"}}
+		_, err := ImportOrUpdateCertificate(context.Background(), store, config, "default-app-tls", secret, true)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := DeleteCertificate(context.Background(), store, config, "default-app-tls", secretName, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Deleted).To(BeFalse())
+
+		config.Spec.AllowAzKeyVaultCertificateDeletion = true
+		result, err = DeleteCertificate(context.Background(), store, config, "default-app-tls", secretName, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(CertificateDeletionResult{Deleted: true, Purged: true}))
+		Expect(store.certificates).To(BeEmpty())
+		Expect(store.purged).To(ConsistOf("default-app-tls"))
+
+		result, err = DeleteCertificate(context.Background(), store, config, "default-app-tls", secretName, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Deleted).To(BeFalse())
+	})
+})
@@ -19,6 +19,7 @@ package api
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
@@ -34,6 +35,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+	"github.com/welasco/syncsecretakv/internal/certstore/filesystem"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -46,6 +49,18 @@ var testEnv *envtest.Environment
 var ctx context.Context
 var cancel context.CancelFunc
 
+// testStoreRoot is the directory of the filesystem store the controller tests sync to
+var testStoreRoot string
+
+// testStoreFactory opens the filesystem store at testStoreRoot whatever the backend of the Config, so the
+// controller tests run without a vault
+func testStoreFactory(config *apiv1alpha1.Config) (certstore.Store, error) {
+	testConfig := config.DeepCopy()
+	testConfig.Spec.Backend = apiv1alpha1.CertificateStoreFilesystem
+	testConfig.Spec.Filesystem = &apiv1alpha1.FilesystemSpec{Path: testStoreRoot}
+	return filesystem.New(testConfig)
+}
+
 func TestControllers(t *testing.T) {
 	RegisterFailHandler(Fail)
 
@@ -57,6 +72,10 @@ var _ = BeforeSuite(func() {
 
 	ctx, cancel = context.WithCancel(context.TODO())
 
+	var err error
+	testStoreRoot, err = os.MkdirTemp("", "syncsecretakv-store-")
+	Expect(err).NotTo(HaveOccurred())
+
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
 		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "..", "config", "crd", "bases")},
@@ -71,7 +90,6 @@ var _ = BeforeSuite(func() {
 			fmt.Sprintf("1.31.0-%s-%s", runtime.GOOS, runtime.GOARCH)),
 	}
 
-	var err error
 	// cfg is defined in this file globally.
 	cfg, err = testEnv.Start()
 	Expect(err).NotTo(HaveOccurred())
@@ -93,4 +111,5 @@ var _ = AfterSuite(func() {
 	cancel()
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
+	Expect(os.RemoveAll(testStoreRoot)).To(Succeed())
 })
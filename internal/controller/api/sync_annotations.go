@@ -0,0 +1,49 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+// IsPaused reports whether the Secret or its SyncSecretAKV carries the paused annotation. Either may be nil.
+func IsPaused(syncSecretAKV *apiv1alpha1.SyncSecretAKV, secret *corev1.Secret) bool {
+	if syncSecretAKV != nil && syncSecretAKV.Annotations[apiv1alpha1.AnnotationPaused] == "true" {
+		return true
+	}
+	return secret != nil && secret.Annotations[apiv1alpha1.AnnotationPaused] == "true"
+}
+
+// ForceSyncRequest returns the value of the force-sync annotation, the one on the SyncSecretAKV taking
+// precedence over the one on the Secret
+func ForceSyncRequest(syncSecretAKV *apiv1alpha1.SyncSecretAKV, secret *corev1.Secret) string {
+	if value := syncSecretAKV.Annotations[apiv1alpha1.AnnotationForceSync]; value != "" {
+		return value
+	}
+	if secret == nil {
+		return ""
+	}
+	return secret.Annotations[apiv1alpha1.AnnotationForceSync]
+}
+
+// ForceSyncPending reports whether the force-sync annotation holds a value not handled yet
+func ForceSyncPending(syncSecretAKV *apiv1alpha1.SyncSecretAKV, secret *corev1.Secret) bool {
+	request := ForceSyncRequest(syncSecretAKV, secret)
+	return request != "" && request != syncSecretAKV.Status.LastForceSync
+}
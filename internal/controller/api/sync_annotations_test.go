@@ -0,0 +1,66 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+var _ = Describe("Sync annotations", func() {
+	var (
+		syncSecretAKV *apiv1alpha1.SyncSecretAKV
+		secret        *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		syncSecretAKV = &apiv1alpha1.SyncSecretAKV{ObjectMeta: metav1.ObjectMeta{Name: "app-tls", Namespace: "default"}}
+		secret = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "app-tls", Namespace: "default"}}
+	})
+
+	It("should pause on either the Secret or the SyncSecretAKV", func() {
+		Expect(IsPaused(syncSecretAKV, secret)).To(BeFalse())
+		Expect(IsPaused(nil, nil)).To(BeFalse())
+
+		secret.Annotations = map[string]string{apiv1alpha1.AnnotationPaused: "true"}
+		Expect(IsPaused(syncSecretAKV, secret)).To(BeTrue())
+		Expect(IsPaused(syncSecretAKV, nil)).To(BeFalse())
+
+		syncSecretAKV.Annotations = map[string]string{apiv1alpha1.AnnotationPaused: "false"}
+		Expect(IsPaused(syncSecretAKV, nil)).To(BeFalse())
+		syncSecretAKV.Annotations[apiv1alpha1.AnnotationPaused] = "true"
+		Expect(IsPaused(syncSecretAKV, nil)).To(BeTrue())
+	})
+
+	It("should force one sync per annotation value", func() {
+		Expect(ForceSyncPending(syncSecretAKV, secret)).To(BeFalse())
+
+		secret.Annotations = map[string]string{apiv1alpha1.AnnotationForceSync: "2024-05-01T10:00:00Z"}
+		Expect(ForceSyncPending(syncSecretAKV, secret)).To(BeTrue())
+
+		syncSecretAKV.Status.LastForceSync = "2024-05-01T10:00:00Z"
+		Expect(ForceSyncPending(syncSecretAKV, secret)).To(BeFalse())
+
+		syncSecretAKV.Annotations = map[string]string{apiv1alpha1.AnnotationForceSync: "2024-05-02T08:00:00Z"}
+		Expect(ForceSyncRequest(syncSecretAKV, secret)).To(Equal("2024-05-02T08:00:00Z"))
+		Expect(ForceSyncPending(syncSecretAKV, secret)).To(BeTrue())
+	})
+})
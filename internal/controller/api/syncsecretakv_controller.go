@@ -18,35 +18,51 @@ package api
 
 import (
 	"context"
+	goerrors "errors"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
-	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azcertificates"
 	"github.com/welasco/syncsecretakv/api/api/v1alpha1"
 	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/certstore"
+	"github.com/welasco/syncsecretakv/internal/events"
+	"github.com/welasco/syncsecretakv/internal/metrics"
 
 	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
 )
 
 // SyncSecretAKVReconciler reconciles a SyncSecretAKV object
 type SyncSecretAKVReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// MaxConcurrentReconciles is the number of SyncSecretAKVs reconciled in parallel, 1 when unset
+	MaxConcurrentReconciles int
+	// NewStore opens the certificate store of the Config, DefaultStoreFactory when nil
+	NewStore StoreFactory
 }
 
 // +kubebuilder:rbac:groups=api.syncsecretakv.io,resources=syncsecretakvs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=api.syncsecretakv.io,resources=syncsecretakvs/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=api.syncsecretakv.io,resources=syncsecretakvs/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -73,49 +89,254 @@ func (r *SyncSecretAKVReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, err
 	}
 
+	store, err := r.NewStore.open(config)
+	if err != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Unable to open the certificate store of the Config")
+		return ctrl.Result{}, err
+	}
+
 	syncSecretAKV := &apiv1alpha1.SyncSecretAKV{}
-	if err := r.Get(ctx, req.NamespacedName, syncSecretAKV); err != nil && errors.IsNotFound(err) {
+	if err := r.Get(ctx, req.NamespacedName, syncSecretAKV); err != nil && !errors.IsNotFound(err) {
+		log.Log.Error(err, "SyncSecretAKVController - Unable to fetch SyncSecretAKV")
+		return ctrl.Result{}, err
+	} else if err != nil {
 		//log.Log.Error(err, "SyncSecretAKVController - Unable to fetch SyncSecretAKV, resource was probably deleted")
 		log.Log.Info("SyncSecretAKVController - Unable to fetch SyncSecretAKV, resource was probably deleted. SyncSecretAKV: " + req.NamespacedName.Name + ", Namespace: " + req.NamespacedName.Namespace)
-		DeleteAzKeyVaultCertificate(config, azKeyVaultCertificateName)
-
+		// Without the finalizer the status is gone, the certificate can only be found under the default name
+		deleted := &apiv1alpha1.SyncSecretAKV{ObjectMeta: metav1.ObjectMeta{Name: req.NamespacedName.Name, Namespace: req.NamespacedName.Namespace}}
+		if _, deleteErr := r.deleteCertificate(ctx, store, config, deleted, azKeyVaultCertificateName); deleteErr != nil {
+			reason, _ := SummarizeError(deleteErr)
+			return RequeueResult(deleteErr, reason)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	azKeyVaultCertificateName = AzKeyVaultCertificateName(syncSecretAKV)
+
+	if !syncSecretAKV.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, store, config, syncSecretAKV, azKeyVaultCertificateName)
+	}
+	if config.Spec.AllowAzKeyVaultCertificateDeletion && controllerutil.AddFinalizer(syncSecretAKV, apiv1alpha1.FinalizerCertificate) {
+		if err := r.Update(ctx, syncSecretAKV); err != nil {
+			log.Log.Error(err, "SyncSecretAKVController - Failed to add finalizer to SyncSecretAKV")
+			return ctrl.Result{}, err
+		}
+	}
 
 	secret := &corev1.Secret{}
-	if err := r.Get(ctx, req.NamespacedName, secret); err != nil && errors.IsNotFound(err) {
+	if err := r.Get(ctx, req.NamespacedName, secret); err != nil && !errors.IsNotFound(err) {
+		log.Log.Error(err, "SyncSecretAKVController - Unable to fetch Secret")
+		return ctrl.Result{}, err
+	} else if err != nil {
 		log.Log.Info("SyncSecretAKVController - Unable to fetch Secret, resource was probably deleted. Secret: " + req.NamespacedName.Name + ", Namespace: " + req.NamespacedName.Namespace)
+
+		// Keep the certificate of a paused SyncSecretAKV, it is deleted once the annotation is removed
+		if IsPaused(syncSecretAKV, nil) {
+			return r.recordPaused(ctx, syncSecretAKV)
+		}
+
+		// Keep the certificate during the grace period in case the Secret is re-created
+		if DeletionGracePeriod(config) > 0 {
+			now := time.Now()
+			if err := MarkSecretDeleted(ctx, r.Client, syncSecretAKV, now); err != nil {
+				log.Log.Error(err, "SyncSecretAKVController - Unable to mark the Secret of SyncSecretAKV as deleted")
+				return ctrl.Result{}, err
+			}
+			if remaining := TombstoneRemaining(syncSecretAKV, config, now); remaining > 0 {
+				log.Log.Info("SyncSecretAKVController - Keeping Azure Key Vault Certificate of the deleted Secret for " + remaining.Round(time.Second).String() + ": " + azKeyVaultCertificateName)
+				message := "The Secret was deleted, the Azure Key Vault Certificate is kept until " + now.Add(remaining).UTC().Format(time.RFC3339)
+				if SetNotSyncingConditions(&syncSecretAKV.Status.Conditions, syncSecretAKV.Generation, apiv1alpha1.ReasonSecretDeleted, message) {
+					if err := r.Status().Update(ctx, syncSecretAKV); err != nil {
+						log.Log.Error(err, "SyncSecretAKVController - Failed to update SyncSecretAKV status")
+						return ctrl.Result{}, err
+					}
+				}
+				return ctrl.Result{RequeueAfter: remaining}, nil
+			}
+		}
+
 		log.Log.Info("SyncSecretAKVController - Deleting corresponding SyncSecretAKV: " + syncSecretAKV.Name)
-		if err := r.Delete(ctx, syncSecretAKV); err != nil {
+		if err := r.Delete(ctx, syncSecretAKV); client.IgnoreNotFound(err) != nil {
 			log.Log.Error(err, "SyncSecretAKVController - Unable to delete SyncSecretAKV")
+			return ctrl.Result{}, err
 		}
 		log.Log.Info("SyncSecretAKVController - Successfully Deleted SyncSecretAKV: " + syncSecretAKV.Name)
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+		return ctrl.Result{}, nil
+	}
+
+	if IsPaused(syncSecretAKV, secret) {
+		return r.recordPaused(ctx, syncSecretAKV)
+	}
+
+	// The Secret no longer matches the Config filters and the UnmatchPolicy is StopSyncing
+	if _, unmatched := syncSecretAKV.Annotations[apiv1alpha1.AnnotationUnmatched]; unmatched {
+		log.Log.Info("SyncSecretAKVController - Secret no longer matches the Config filters, not syncing: " + syncSecretAKV.Name)
+		message := "The Secret no longer matches the Config filters, the Azure Key Vault Certificate is not updated"
+		if SetNotSyncingConditions(&syncSecretAKV.Status.Conditions, syncSecretAKV.Generation, apiv1alpha1.ReasonSecretUnmatched, message) {
+			if err := r.Status().Update(ctx, syncSecretAKV); err != nil {
+				log.Log.Error(err, "SyncSecretAKVController - Failed to update SyncSecretAKV status")
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
 	}
 
 	// Import or Update Azure Key Vault Certificate
 
 	// Need to check the revision of the secret to determine if the certificate needs to be updated
-	if syncSecretAKV.Spec.SecretResourceVersion != syncSecretAKV.Spec.SyncSecretAKVResourceVersion {
+	needsImport := syncSecretAKV.Spec.SecretResourceVersion != syncSecretAKV.Spec.SyncSecretAKVResourceVersion
+	// Migrate the certificate when the Config now points at another Azure Key Vault
+	if VaultURLChanged(&syncSecretAKV.Status, StoreURL(config)) {
+		log.Log.Info("SyncSecretAKVController - Vault URL changed from " + syncSecretAKV.Status.VaultURL + " to " + StoreURL(config) + ", importing the certificate into the new vault: " + azKeyVaultCertificateName)
+		needsImport = true
+	}
+	// Re-import on a new value of the force-sync annotation, e.g. after the vault was restored from a backup
+	if ForceSyncPending(syncSecretAKV, secret) {
+		log.Log.Info("SyncSecretAKVController - Force sync requested, importing the certificate again: " + azKeyVaultCertificateName + ", Request: " + ForceSyncRequest(syncSecretAKV, secret))
+		needsImport = true
+	}
+	if !needsImport {
+		// Correct drift of the certificate policy and attributes, or re-import if the certificate is gone
+		repair, err := RepairCertificatePolicy(ctx, store, config, azKeyVaultCertificateName, req.NamespacedName, HasSyncedCertificate(syncSecretAKV, config))
+		if err != nil {
+			log.Log.Error(err, "SyncSecretAKVController - Failed to repair Azure Key Vault Certificate policy")
+			reason, message := SummarizeError(err)
+			SetFailedConditions(&syncSecretAKV.Status.Conditions, syncSecretAKV.Generation, reason, "Failed to repair Azure Key Vault Certificate policy: "+message)
+			syncSecretAKV.Status.FailureClass = ClassifyFailure(reason)
+			events.Emit(r.Recorder, syncSecretAKV, corev1.EventTypeWarning, events.ReasonRepairFailed, "Failed to repair Azure Key Vault Certificate policy: "+message)
+			if err := r.Status().Update(ctx, syncSecretAKV); err != nil {
+				log.Log.Error(err, "SyncSecretAKVController - Failed to update SyncSecretAKV status")
+				return ctrl.Result{}, err
+			}
+			return RequeueResult(err, reason)
+		}
+		if repair.DryRun {
+			return r.recordDryRun(ctx, syncSecretAKV, secret, dryRunMessage("repair the drifted policy or attributes of Azure Key Vault Certificate "+azKeyVaultCertificateName))
+		}
+		if !repair.Reimport {
+			if syncSecretAKV.Status.NotAfter != nil {
+				metrics.CertificateExpiry.Set(syncSecretAKV.Namespace, syncSecretAKV.Name, StoreURL(config), syncSecretAKV.Status.NotAfter.Time)
+			}
+			conditionsChanged := SetSucceededConditions(&syncSecretAKV.Status.Conditions, syncSecretAKV.Generation, "Azure Key Vault Certificate is up to date", apiv1alpha1.ConditionSynced)
+			if conditionsChanged || syncSecretAKV.Status.FailureClass != "" {
+				syncSecretAKV.Status.FailureClass = ""
+				if err := r.Status().Update(ctx, syncSecretAKV); err != nil {
+					log.Log.Error(err, "SyncSecretAKVController - Failed to update SyncSecretAKV status")
+					return ctrl.Result{}, err
+				}
+			}
+		}
+		if repair.PolicyUpdated {
+			events.Emit(r.Recorder, syncSecretAKV, corev1.EventTypeNormal, events.ReasonDriftRepaired, "Repaired drifted policy of Azure Key Vault Certificate "+azKeyVaultCertificateName)
+		}
+		if repair.AttributesUpdated {
+			events.Emit(r.Recorder, syncSecretAKV, corev1.EventTypeNormal, events.ReasonDriftRepaired, "Repaired drifted attributes of Azure Key Vault Certificate "+azKeyVaultCertificateName)
+		}
+		needsImport = repair.Reimport
+	}
+
+	if needsImport {
+
+		// Validate the certificate before uploading it to Azure Key Vault
+		parsed, validationErr := ValidateCertificate(secret, config, time.Now())
+		if validationErr != nil {
+			log.Log.Info("SyncSecretAKVController - Certificate validation failed, not uploading to Azure Key Vault: " + azKeyVaultCertificateName + ", Reason: " + validationErr.Reason + ", Message: " + validationErr.Message)
+			return ctrl.Result{}, r.rejectCertificate(ctx, syncSecretAKV, secret, apiv1alpha1.ConditionCertificateValid, "Certificate validation failed: ", validationErr)
+		}
+
+		certificateValid := metav1.Condition{
+			Type:               apiv1alpha1.ConditionCertificateValid,
+			Status:             metav1.ConditionTrue,
+			Reason:             apiv1alpha1.ReasonCertificateValid,
+			Message:            "The certificate passed validation",
+			ObservedGeneration: syncSecretAKV.Generation,
+		}
+
+		// Make sure the namespace is allowed to sync certificates for these DNS names
+		if len(config.Spec.AllowedDNSNames) > 0 {
+			namespace := &corev1.Namespace{}
+			if err := r.Get(ctx, types.NamespacedName{Name: req.NamespacedName.Namespace}, namespace); err != nil {
+				log.Log.Error(err, "SyncSecretAKVController - Unable to fetch Namespace: "+req.NamespacedName.Namespace)
+				return ctrl.Result{}, err
+			}
+			if dnsErr := CheckAllowedCertificateNames(config, namespace, parsed.Leaf()); dnsErr != nil {
+				log.Log.Info("SyncSecretAKVController - Certificate DNS names not allowed, not uploading to Azure Key Vault: " + azKeyVaultCertificateName + ", Reason: " + dnsErr.Reason + ", Message: " + dnsErr.Message)
+				meta.SetStatusCondition(&syncSecretAKV.Status.Conditions, certificateValid)
+				return ctrl.Result{}, r.rejectCertificate(ctx, syncSecretAKV, secret, apiv1alpha1.ConditionDNSNamesAllowed, "Certificate DNS names not allowed: ", dnsErr)
+			}
+		}
+
+		dnsNamesAllowed := metav1.Condition{
+			Type:               apiv1alpha1.ConditionDNSNamesAllowed,
+			Status:             metav1.ConditionTrue,
+			Reason:             apiv1alpha1.ReasonDNSNamesAllowed,
+			Message:            "The certificate DNS names are allowed for the namespace",
+			ObservedGeneration: syncSecretAKV.Generation,
+		}
+
+		// Match the first sync to a certificate uploaded before the controller managed the Secret
+		if DiscoveryEnabled(config) && syncSecretAKV.Status.CertificateID == "" {
+			discovered, err := DiscoverCertificate(ctx, store, config, secret, parsed.Leaf())
+			if err != nil {
+				log.Log.Error(err, "SyncSecretAKVController - Failed to discover existing Azure Key Vault Certificate")
+				reason, message := SummarizeError(err)
+				syncSecretAKV.Status.SyncStatus = "Failed"
+				syncSecretAKV.Status.SyncStatusMessage = "Failed to discover existing Azure Key Vault Certificate: " + message
+				SetFailedConditions(&syncSecretAKV.Status.Conditions, syncSecretAKV.Generation, reason, syncSecretAKV.Status.SyncStatusMessage, apiv1alpha1.ConditionSynced)
+				RecordSyncAttempt(&syncSecretAKV.Status, syncSecretAKV.Generation, false, time.Now())
+				syncSecretAKV.Status.FailureClass = ClassifyFailure(reason)
+				if err := r.Status().Update(ctx, syncSecretAKV); err != nil {
+					log.Log.Error(err, "SyncSecretAKVController - Failed to update SyncSecretAKV status")
+					return ctrl.Result{}, err
+				}
+				return RequeueResult(err, reason)
+			}
+			if discovered != nil && IsDryRun(config) {
+				message := "adopt existing Azure Key Vault Certificate " + discovered.Name
+				if !discovered.Identical {
+					message += " and import a new version"
+				}
+				return r.recordDryRun(ctx, syncSecretAKV, secret, dryRunMessage(message), certificateValid, dnsNamesAllowed)
+			}
+			if discovered != nil {
+				azKeyVaultCertificateName = discovered.Name
+				syncSecretAKV.Status.CertificateName = discovered.Name
+				if discovered.Identical {
+					return r.adoptCertificate(ctx, config, syncSecretAKV, secret, discovered, parsed.Leaf(), certificateValid, dnsNamesAllowed)
+				}
+				log.Log.Info("SyncSecretAKVController - Adopted Azure Key Vault Certificate differs from the Secret, importing a new version: " + azKeyVaultCertificateName)
+			}
+		}
 
 		log.Log.Info("SyncSecretAKVController - Importing or Updating Azure Key Vault Certificate: " + azKeyVaultCertificateName)
-		err = ImportOrUpdateAzKeyVaultCertificate(config, azKeyVaultCertificateName, secret)
+		certificate, err := ImportOrUpdateCertificate(ctx, store, config, azKeyVaultCertificateName, secret, HasSyncedCertificate(syncSecretAKV, config))
 		if err != nil {
 			log.Log.Error(err, "SyncSecretAKVController - Failed to import or update certificate into Azure Key Vault")
 
 			// Update SyncSecretAKV Status
 			syncSecretAKV.Status.SyncStatus = "Failed"
-			syncSecretAKV.Status.SyncStatusMessage = "Failed to import or update certificate into Azure Key Vault. Error: " + err.Error()
+			reason, message := SummarizeError(err)
+			syncSecretAKV.Status.SyncStatusMessage = "Failed to import or update certificate into Azure Key Vault: " + message
+			meta.SetStatusCondition(&syncSecretAKV.Status.Conditions, certificateValid)
+			meta.SetStatusCondition(&syncSecretAKV.Status.Conditions, dnsNamesAllowed)
+			SetFailedConditions(&syncSecretAKV.Status.Conditions, syncSecretAKV.Generation, reason, syncSecretAKV.Status.SyncStatusMessage, apiv1alpha1.ConditionSynced)
+			events.Emit(r.Recorder, syncSecretAKV, corev1.EventTypeWarning, events.ReasonImportFailed, syncSecretAKV.Status.SyncStatusMessage)
+			events.Emit(r.Recorder, secret, corev1.EventTypeWarning, events.ReasonImportFailed, syncSecretAKV.Status.SyncStatusMessage)
+			RecordSyncAttempt(&syncSecretAKV.Status, syncSecretAKV.Generation, false, time.Now())
+			syncSecretAKV.Status.FailureClass = ClassifyFailure(reason)
 			if err := r.Status().Update(ctx, syncSecretAKV); err != nil {
 				log.Log.Error(err, "SyncSecretAKVController - Failed to update SyncSecretAKV status")
+				return ctrl.Result{}, err
 			}
-			return ctrl.Result{}, nil
+			return RequeueResult(err, reason)
+		}
+		if IsDryRun(config) {
+			return r.recordDryRun(ctx, syncSecretAKV, secret, dryRunMessage("import or update Azure Key Vault Certificate "+azKeyVaultCertificateName), certificateValid, dnsNamesAllowed)
 		}
 
 		syncSecretAKV.Spec.SyncSecretAKVResourceVersion = syncSecretAKV.Spec.SecretResourceVersion
 		if err := r.Update(ctx, syncSecretAKV); err != nil {
 			log.Log.Error(err, "SyncSecretAKVController - Failed to update SyncSecretAKV")
-			return ctrl.Result{}, nil
+			return ctrl.Result{}, err
 		}
 
 		log.Log.Info("SyncSecretAKVController - Successfuly imported or updated Azure Key Vault Certificate: " + azKeyVaultCertificateName)
@@ -123,8 +344,20 @@ func (r *SyncSecretAKVReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		// Update SyncSecretAKV Status
 		syncSecretAKV.Status.SyncStatus = "Success"
 		syncSecretAKV.Status.SyncStatusMessage = "Successfully imported or updated Azure Key Vault Certificate: " + azKeyVaultCertificateName
+		meta.SetStatusCondition(&syncSecretAKV.Status.Conditions, certificateValid)
+		meta.SetStatusCondition(&syncSecretAKV.Status.Conditions, dnsNamesAllowed)
+		SetSucceededConditions(&syncSecretAKV.Status.Conditions, syncSecretAKV.Generation, syncSecretAKV.Status.SyncStatusMessage, apiv1alpha1.ConditionSynced)
+		events.Emit(r.Recorder, syncSecretAKV, corev1.EventTypeNormal, events.ReasonImported, syncSecretAKV.Status.SyncStatusMessage)
+		events.Emit(r.Recorder, secret, corev1.EventTypeNormal, events.ReasonImported, syncSecretAKV.Status.SyncStatusMessage)
+		RecordSyncAttempt(&syncSecretAKV.Status, syncSecretAKV.Generation, true, time.Now())
+		RecordCertificateStatus(&syncSecretAKV.Status, StoreURL(config), certificate, parsed.Leaf())
+		syncSecretAKV.Status.CertificateName = azKeyVaultCertificateName
+		syncSecretAKV.Status.LastForceSync = ForceSyncRequest(syncSecretAKV, secret)
+		metrics.CertificateExpiry.Set(syncSecretAKV.Namespace, syncSecretAKV.Name, StoreURL(config), parsed.Leaf().NotAfter)
+		syncSecretAKV.Status.FailureClass = ""
 		if err := r.Status().Update(ctx, syncSecretAKV); err != nil {
 			log.Log.Error(err, "SyncSecretAKVController - Failed to update SyncSecretAKV status")
+			return ctrl.Result{}, err
 		}
 
 	} else {
@@ -134,128 +367,320 @@ func (r *SyncSecretAKVReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	return ctrl.Result{}, nil
 }
 
-func ConvertToPkcs8PEM(privKey *string) string {
-
-	bytePrivKey := []byte(*privKey)
-
-	// Decode the PEM block
-	block, _ := pem.Decode(bytePrivKey)
-	if block == nil || block.Type != "RSA PRIVATE KEY" {
-		log.Log.Info("SyncSecretAKVController - Failed to decode PEM block containing RSA private key")
+// finalize deletes the certificate of a SyncSecretAKV being deleted under the name recorded in its status, which
+// differs from the default name for adopted certificates, and then releases the finalizer. In dry run the
+// finalizer is kept, so the certificate is deleted once dry run is turned off instead of being orphaned.
+func (r *SyncSecretAKVReconciler) finalize(ctx context.Context, store certstore.Store, config *apiv1alpha1.Config, syncSecretAKV *apiv1alpha1.SyncSecretAKV, azKeyVaultCertificateName string) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(syncSecretAKV, apiv1alpha1.FinalizerCertificate) {
+		return ctrl.Result{}, nil
 	}
-	// Parse the RSA private key
-	rsaPrivateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-	if err != nil {
-		log.Log.Error(err, "SyncSecretAKVController - Error parsing RSA private key")
+
+	log.Log.Info("SyncSecretAKVController - SyncSecretAKV is being deleted, deleting its Azure Key Vault Certificate: " + azKeyVaultCertificateName)
+	// A certificate owned by someone else is not ours to delete, it must not hold the SyncSecretAKV forever
+	result, err := r.deleteCertificate(ctx, store, config, syncSecretAKV, azKeyVaultCertificateName)
+	if err != nil && !goerrors.Is(err, ErrCertificateNotOwned) {
+		reason, _ := SummarizeError(err)
+		return RequeueResult(err, reason)
 	}
-	// Convert the RSA private key to PKCS#8 format
-	pkcs8PrivateKey, err := x509.MarshalPKCS8PrivateKey(rsaPrivateKey)
-	if err != nil {
-		log.Log.Error(err, "SyncSecretAKVController - Error converting to PKCS#8")
+	if result.DryRun {
+		log.Log.Info("SyncSecretAKVController - Dry run, keeping the finalizer of SyncSecretAKV: " + syncSecretAKV.Name)
+		message := dryRunMessage("delete and purge Azure Key Vault Certificate " + azKeyVaultCertificateName)
+		changed := syncSecretAKV.Status.SyncStatus != "DryRun" || syncSecretAKV.Status.SyncStatusMessage != message
+		syncSecretAKV.Status.SyncStatus = "DryRun"
+		syncSecretAKV.Status.SyncStatusMessage = message
+		if SetNotSyncingConditions(&syncSecretAKV.Status.Conditions, syncSecretAKV.Generation, apiv1alpha1.ReasonDryRun, message) || changed {
+			if err := r.Status().Update(ctx, syncSecretAKV); err != nil {
+				log.Log.Error(err, "SyncSecretAKVController - Failed to update SyncSecretAKV status")
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{RequeueAfter: dryRunRequeueInterval}, nil
 	}
 
-	// Create a PEM block with the PKCS#8 private key
-	pkcs8PemBlock := &pem.Block{
-		Type:  "PRIVATE KEY",
-		Bytes: pkcs8PrivateKey,
+	controllerutil.RemoveFinalizer(syncSecretAKV, apiv1alpha1.FinalizerCertificate)
+	if err := r.Update(ctx, syncSecretAKV); client.IgnoreNotFound(err) != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Failed to remove finalizer from SyncSecretAKV")
+		return ctrl.Result{}, err
 	}
-	// Encode the PKCS#8 private key to PEM format
-	pkcs8PemData := pem.EncodeToMemory(pkcs8PemBlock)
-	log.Log.Info("SyncSecretAKVController - RSA private key successfully converted to PKCS#8 format")
+	return ctrl.Result{}, nil
+}
 
-	return string(pkcs8PemData)
+// deleteCertificate deletes the certificate of a deleted SyncSecretAKV and reports the outcome as events on it
+func (r *SyncSecretAKVReconciler) deleteCertificate(ctx context.Context, store certstore.Store, config *apiv1alpha1.Config, syncSecretAKV *apiv1alpha1.SyncSecretAKV, azKeyVaultCertificateName string) (CertificateDeletionResult, error) {
 
+	metrics.CertificateExpiry.Delete(syncSecretAKV.Namespace, syncSecretAKV.Name)
+	secretName := types.NamespacedName{Namespace: syncSecretAKV.Namespace, Name: syncSecretAKV.Name}
+	if err := restoreDeletionBrake(ctx, r.Client, config); err != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Failed to read the deletion brake from the Config status")
+		return CertificateDeletionResult{}, err
+	}
+	result, err := DeleteCertificate(ctx, store, config, azKeyVaultCertificateName, secretName, HasSyncedCertificate(syncSecretAKV, config))
+	if result.Deleted {
+		persistDeletionBrake(ctx, r.Client, config)
+	}
+	if err != nil {
+		if goerrors.Is(err, ErrDeletionBrakeEngaged) {
+			reportDeletionBrake(ctx, r.Client, r.Recorder, config)
+		}
+		_, message := SummarizeError(err)
+		events.Emit(r.Recorder, syncSecretAKV, corev1.EventTypeWarning, events.ReasonDeleteFailed, "Failed to delete Azure Key Vault Certificate "+azKeyVaultCertificateName+": "+message)
+		return result, err
+	}
+	if result.Deleted {
+		events.Emit(r.Recorder, syncSecretAKV, corev1.EventTypeNormal, events.ReasonDeleted, "Deleted Azure Key Vault Certificate "+azKeyVaultCertificateName)
+	}
+	if result.Purged {
+		events.Emit(r.Recorder, syncSecretAKV, corev1.EventTypeNormal, events.ReasonPurged, "Purged Azure Key Vault Certificate "+azKeyVaultCertificateName)
+	}
+	if result.DryRun {
+		events.Emit(r.Recorder, syncSecretAKV, corev1.EventTypeNormal, events.ReasonDryRun, dryRunMessage("delete and purge Azure Key Vault Certificate "+azKeyVaultCertificateName))
+	}
+	return result, nil
 }
 
-func DeleteAzKeyVaultCertificate(config *apiv1alpha1.Config, azKeyVaultCertificateName string) error {
-
-	log.Log.Info("SyncSecretAKVController - Deleting Azure Key Vault Certificate")
+// recordPaused reports on the SyncSecretAKV status that syncing is paused by the paused annotation
+func (r *SyncSecretAKVReconciler) recordPaused(ctx context.Context, syncSecretAKV *apiv1alpha1.SyncSecretAKV) (ctrl.Result, error) {
+	log.Log.Info("SyncSecretAKVController - Syncing is paused, not syncing: " + syncSecretAKV.Name)
+	message := "Syncing is paused by the " + apiv1alpha1.AnnotationPaused + " annotation"
+	if SetNotSyncingConditions(&syncSecretAKV.Status.Conditions, syncSecretAKV.Generation, apiv1alpha1.ReasonPaused, message) {
+		if err := r.Status().Update(ctx, syncSecretAKV); err != nil {
+			log.Log.Error(err, "SyncSecretAKVController - Failed to update SyncSecretAKV status")
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
 
-	err := error(nil)
-	// Create Azure Credential
-	clientCertificate := NewAzKeyVaultClientConfig(config)
+// recordDryRun records in the SyncSecretAKV status and as events the change skipped because the Config is in dry run.
+// The Secret resource version is not recorded as synced, so the change is made once dry run is turned off.
+func (r *SyncSecretAKVReconciler) recordDryRun(ctx context.Context, syncSecretAKV *apiv1alpha1.SyncSecretAKV, secret *corev1.Secret, message string, conditions ...metav1.Condition) (ctrl.Result, error) {
 
-	if config.Spec.AllowAzKeyVaultCertificateDeletion {
+	log.Log.Info("SyncSecretAKVController - " + message)
 
-		//Delete Certificate
-		_, err := clientCertificate.DeleteCertificate(context.TODO(), azKeyVaultCertificateName, nil)
-		if err != nil {
-			log.Log.Error(err, "SyncSecretAKVController - Failed to delete certificate from Azure Key Vault")
+	changed := syncSecretAKV.Status.SyncStatus != "DryRun" || syncSecretAKV.Status.SyncStatusMessage != message
+	syncSecretAKV.Status.SyncStatus = "DryRun"
+	syncSecretAKV.Status.SyncStatusMessage = message
+	for _, condition := range conditions {
+		if meta.SetStatusCondition(&syncSecretAKV.Status.Conditions, condition) {
+			changed = true
 		}
-		log.Log.Info("SyncSecretAKVController - Successfuly deleted Azure Key Vault Certificate: " + azKeyVaultCertificateName)
+	}
+	if SetNotSyncingConditions(&syncSecretAKV.Status.Conditions, syncSecretAKV.Generation, apiv1alpha1.ReasonDryRun, message) {
+		changed = true
+	}
+	if !changed {
+		return ctrl.Result{}, nil
+	}
 
-		// Sleep for 20 seconds to allow the certificate to be purged
-		log.Log.Info("SyncSecretAKVController - Sleeping for 20 seconds to allow the certificate to be purged")
-		time.Sleep(20 * time.Second)
+	events.Emit(r.Recorder, syncSecretAKV, corev1.EventTypeNormal, events.ReasonDryRun, message)
+	events.Emit(r.Recorder, secret, corev1.EventTypeNormal, events.ReasonDryRun, message)
+	if err := r.Status().Update(ctx, syncSecretAKV); err != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Failed to update SyncSecretAKV status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
 
-		//Purge Certificate
-		_, err = clientCertificate.PurgeDeletedCertificate(context.TODO(), azKeyVaultCertificateName, nil)
-		if err != nil {
-			log.Log.Error(err, "SyncSecretAKVController - Failed to purge certificate from Azure Key Vault")
-		}
-		log.Log.Info("SyncSecretAKVController - Successfuly purged Azure Key Vault Certificate: " + azKeyVaultCertificateName)
+// adoptCertificate seeds the SyncSecretAKV status from a discovered certificate identical to the Secret certificate,
+// without importing a new version
+func (r *SyncSecretAKVReconciler) adoptCertificate(ctx context.Context, config *apiv1alpha1.Config, syncSecretAKV *apiv1alpha1.SyncSecretAKV, secret *corev1.Secret, discovered *DiscoveredCertificate, leaf *x509.Certificate, conditions ...metav1.Condition) (ctrl.Result, error) {
+
+	syncSecretAKV.Spec.SyncSecretAKVResourceVersion = syncSecretAKV.Spec.SecretResourceVersion
+	if err := r.Update(ctx, syncSecretAKV); err != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Failed to update SyncSecretAKV")
+		return ctrl.Result{}, err
 	}
 
-	return err
+	log.Log.Info("SyncSecretAKVController - Adopted existing Azure Key Vault Certificate without importing: " + discovered.Name)
+
+	// Update SyncSecretAKV Status
+	syncSecretAKV.Status.SyncStatus = "Success"
+	syncSecretAKV.Status.SyncStatusMessage = "Adopted existing Azure Key Vault Certificate: " + discovered.Name
+	for _, condition := range conditions {
+		meta.SetStatusCondition(&syncSecretAKV.Status.Conditions, condition)
+	}
+	SetSucceededConditions(&syncSecretAKV.Status.Conditions, syncSecretAKV.Generation, syncSecretAKV.Status.SyncStatusMessage, apiv1alpha1.ConditionSynced)
+	events.Emit(r.Recorder, syncSecretAKV, corev1.EventTypeNormal, events.ReasonAdopted, syncSecretAKV.Status.SyncStatusMessage)
+	events.Emit(r.Recorder, secret, corev1.EventTypeNormal, events.ReasonAdopted, syncSecretAKV.Status.SyncStatusMessage)
+	RecordSyncAttempt(&syncSecretAKV.Status, syncSecretAKV.Generation, true, time.Now())
+	RecordCertificateStatus(&syncSecretAKV.Status, StoreURL(config), discovered.Certificate, leaf)
+	syncSecretAKV.Status.CertificateName = discovered.Name
+	syncSecretAKV.Status.LastForceSync = ForceSyncRequest(syncSecretAKV, secret)
+	metrics.CertificateExpiry.Set(syncSecretAKV.Namespace, syncSecretAKV.Name, StoreURL(config), leaf.NotAfter)
+	syncSecretAKV.Status.FailureClass = ""
+	if err := r.Status().Update(ctx, syncSecretAKV); err != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Failed to update SyncSecretAKV status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
 }
 
-func NewAzKeyVaultClientClusterConfig(clusterConfig *v1alpha1.ClusterConfig) *azcertificates.Client {
-	return newAzKeyVaultClient(clusterConfig, nil)
+// rejectCertificate records on the SyncSecretAKV status and as a Warning event why the certificate was not uploaded.
+// A rejected certificate is a terminal failure, it is not retried until the Secret changes.
+func (r *SyncSecretAKVReconciler) rejectCertificate(ctx context.Context, syncSecretAKV *apiv1alpha1.SyncSecretAKV, secret *corev1.Secret, conditionType string, messagePrefix string, validationErr *CertificateValidationError) error {
+
+	events.Emit(r.Recorder, syncSecretAKV, corev1.EventTypeWarning, validationErr.Reason, validationErr.Message)
+	events.Emit(r.Recorder, secret, corev1.EventTypeWarning, validationErr.Reason, validationErr.Message)
+
+	// Update SyncSecretAKV Status
+	syncSecretAKV.Status.SyncStatus = "Failed"
+	syncSecretAKV.Status.SyncStatusMessage = messagePrefix + validationErr.Reason
+	meta.SetStatusCondition(&syncSecretAKV.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             metav1.ConditionFalse,
+		Reason:             validationErr.Reason,
+		Message:            validationErr.Message,
+		ObservedGeneration: syncSecretAKV.Generation,
+	})
+	SetFailedConditions(&syncSecretAKV.Status.Conditions, syncSecretAKV.Generation, apiv1alpha1.ReasonCertificateRejected, validationErr.Message, apiv1alpha1.ConditionSynced)
+	RecordSyncAttempt(&syncSecretAKV.Status, syncSecretAKV.Generation, false, time.Now())
+	syncSecretAKV.Status.FailureClass = apiv1alpha1.FailureClassTerminal
+	if err := r.Status().Update(ctx, syncSecretAKV); err != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Failed to update SyncSecretAKV status")
+		return err
+	}
+	return nil
 }
 
-func NewAzKeyVaultClientConfig(config *v1alpha1.Config) *azcertificates.Client {
-	return newAzKeyVaultClient(nil, config)
+// CertificateDeletionResult describes what DeleteCertificate removed from the certificate store
+type CertificateDeletionResult struct {
+	Deleted bool
+	Purged  bool
+	// DryRun is true when the certificate would have been deleted and purged but the Config is in dry run
+	DryRun bool
 }
 
-func newAzKeyVaultClient(clusterConfig *v1alpha1.ClusterConfig, config *v1alpha1.Config) *azcertificates.Client {
+// DeleteCertificate deletes and purges the certificate of the Secret from the store when the Config allows deletion
+// and the certificate is owned by this controller. synced tells whether the SyncSecretAKV of the Secret shows an
+// earlier sync, see HasSyncedCertificate.
+func DeleteCertificate(ctx context.Context, store certstore.Store, config *apiv1alpha1.Config, azKeyVaultCertificateName string, secretName types.NamespacedName, synced bool) (CertificateDeletionResult, error) {
 
-	var newConfig *v1alpha1.Config
-	var cred azcore.TokenCredential
+	log.Log.Info("SyncSecretAKVController - Deleting Azure Key Vault Certificate")
 
-	if clusterConfig != nil {
-		newConfig = ConvertToConfig(clusterConfig)
-	} else {
-		newConfig = config
+	result := CertificateDeletionResult{}
+	if !config.Spec.AllowAzKeyVaultCertificateDeletion {
+		return result, nil
+	}
+
+	// Make sure the certificate belongs to this Secret before deleting it
+	callCtx, cancel := keyVaultContext(ctx, OperationGetCertificate)
+	start := time.Now()
+	existing, err := store.Get(callCtx, azKeyVaultCertificateName)
+	cancel()
+	observeKeyVaultOperation(config, OperationGetCertificate, start, err)
+	if certstore.IsNotFound(err) {
+		// An earlier attempt may have deleted the certificate and failed to purge it, which blocks the name
+		return purgeDeletedCertificate(ctx, store, config, azKeyVaultCertificateName, secretName, synced)
+	}
+	if err != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Failed to get certificate from Azure Key Vault")
+		return result, err
+	}
+	ownership := GetCertificateOwnership(existing.Tags, config, secretName.Namespace, secretName.Name)
+	if !IsCertificateManageable(ownership, config.Spec.AdoptionPolicy) && !IsLegacyCertificate(ownership, azKeyVaultCertificateName, secretName, synced) {
+		log.Log.Info("SyncSecretAKVController - Refusing to delete Azure Key Vault Certificate not owned by this controller: " + azKeyVaultCertificateName + ", Ownership: " + string(ownership))
+		return result, ErrCertificateNotOwned
 	}
 
-	keyVaultUrl := newConfig.Spec.AzKeyVaultURL
+	if IsDryRun(config) {
+		log.Log.Info("SyncSecretAKVController - " + dryRunMessage("delete and purge Azure Key Vault Certificate: "+azKeyVaultCertificateName))
+		result.DryRun = true
+		return result, nil
+	}
 
-	if newConfig.Spec.AzKeyVaultClientSecret != "" && newConfig.Spec.AzKeyVaultClientID != "" && newConfig.Spec.AzKeyVaultTenantID != "" {
-		log.Log.Info("SyncSecretAKVController - Using Client Secret for Azure Key Vault Authentication with TenantID: " + newConfig.Spec.AzKeyVaultTenantID + ", ClientID: " + newConfig.Spec.AzKeyVaultClientID)
-		var err error
-		cred, err = azidentity.NewClientSecretCredential(newConfig.Spec.AzKeyVaultTenantID, newConfig.Spec.AzKeyVaultClientID, newConfig.Spec.AzKeyVaultClientSecret, nil)
-		if err != nil {
-			log.Log.Error(err, "SyncSecretAKVController - Failed to obtain a NewClientSecretCredential")
-		}
+	// Stop before deleting too many certificates at once, a misconfiguration can orphan every Secret
+	if !deletionBrake.Allow(config) {
+		log.Log.Info("SyncSecretAKVController - Deletion brake engaged, not deleting Azure Key Vault Certificate: " + azKeyVaultCertificateName)
+		return result, ErrDeletionBrakeEngaged
+	}
 
-	} else if newConfig.Spec.AzKeyVaultClientID != "" {
-		log.Log.Info("SyncSecretAKVController - Using Managed Identity for Azure Key Vault Authentication with ClientID: " + newConfig.Spec.AzKeyVaultClientID)
-		clientID := azidentity.ClientID(newConfig.Spec.AzKeyVaultClientID)
-		msiOPtions := azidentity.ManagedIdentityCredentialOptions{ID: &clientID}
-		var err error
-		cred, err = azidentity.NewManagedIdentityCredential(&msiOPtions)
-		if err != nil {
-			log.Log.Error(err, "SyncSecretAKVController - Failed to obtain a NewManagedIdentityCredential")
-		}
-	} else {
-		log.Log.Info("SyncSecretAKVController - Using Default Azure Credential for Azure Key Vault Authentication")
-		var err error
-		cred, err = azidentity.NewDefaultAzureCredential(nil)
-		if err != nil {
-			log.Log.Error(err, "SyncSecretAKVController - Failed to obtain a NewDefaultAzureCredential")
-		}
+	// Delete Certificate, the store returns once the deletion completed and the certificate can be purged
+	callCtx, cancel = keyVaultContext(ctx, OperationDeleteCertificate)
+	start = time.Now()
+	err = store.Delete(callCtx, azKeyVaultCertificateName)
+	cancel()
+	observeKeyVaultOperation(config, OperationDeleteCertificate, start, err)
+	deletionBrake.Done(config, err == nil)
+	if err != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Failed to delete certificate from Azure Key Vault")
+		return result, err
+	}
+	result.Deleted = true
+	log.Log.Info("SyncSecretAKVController - Successfuly deleted Azure Key Vault Certificate: " + azKeyVaultCertificateName)
+
+	//Purge Certificate
+	callCtx, cancel = keyVaultContext(ctx, OperationPurgeDeletedCertificate)
+	start = time.Now()
+	err = store.Purge(callCtx, azKeyVaultCertificateName)
+	cancel()
+	observeKeyVaultOperation(config, OperationPurgeDeletedCertificate, start, err)
+	if err != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Failed to purge certificate from Azure Key Vault")
+		return result, err
+	}
+	result.Purged = true
+	log.Log.Info("SyncSecretAKVController - Successfuly purged Azure Key Vault Certificate: " + azKeyVaultCertificateName)
+
+	return result, nil
+}
+
+// purgeDeletedCertificate purges the certificate left deleted but not purged by an earlier DeleteCertificate,
+// once its tags show it is owned by the Secret. Stores without soft delete have nothing to purge.
+func purgeDeletedCertificate(ctx context.Context, store certstore.Store, config *apiv1alpha1.Config, azKeyVaultCertificateName string, secretName types.NamespacedName, synced bool) (CertificateDeletionResult, error) {
+
+	result := CertificateDeletionResult{}
+	deletedStore, ok := store.(certstore.DeletedStore)
+	if !ok {
+		log.Log.Info("SyncSecretAKVController - Azure Key Vault Certificate not found, nothing to delete: " + azKeyVaultCertificateName)
+		return result, nil
 	}
 
-	clientCertificate, err := azcertificates.NewClient(keyVaultUrl, cred, nil)
+	callCtx, cancel := keyVaultContext(ctx, OperationGetDeletedCertificate)
+	start := time.Now()
+	deleted, err := deletedStore.GetDeleted(callCtx, azKeyVaultCertificateName)
+	cancel()
+	observeKeyVaultOperation(config, OperationGetDeletedCertificate, start, err)
+	if certstore.IsNotFound(err) {
+		log.Log.Info("SyncSecretAKVController - Azure Key Vault Certificate not found, nothing to delete: " + azKeyVaultCertificateName)
+		return result, nil
+	}
 	if err != nil {
-		log.Log.Error(err, "SyncSecretAKVController - Failed to create a client connection to Azure Key Vault")
+		log.Log.Error(err, "SyncSecretAKVController - Failed to get deleted certificate from Azure Key Vault")
+		return result, err
+	}
+	ownership := GetCertificateOwnership(deleted.Tags, config, secretName.Namespace, secretName.Name)
+	if !IsCertificateManageable(ownership, config.Spec.AdoptionPolicy) && !IsLegacyCertificate(ownership, azKeyVaultCertificateName, secretName, synced) {
+		log.Log.Info("SyncSecretAKVController - Refusing to purge deleted Azure Key Vault Certificate not owned by this controller: " + azKeyVaultCertificateName + ", Ownership: " + string(ownership))
+		return result, ErrCertificateNotOwned
 	}
-	return clientCertificate
+
+	if IsDryRun(config) {
+		log.Log.Info("SyncSecretAKVController - " + dryRunMessage("purge deleted Azure Key Vault Certificate: "+azKeyVaultCertificateName))
+		result.DryRun = true
+		return result, nil
+	}
+
+	log.Log.Info("SyncSecretAKVController - Purging Azure Key Vault Certificate left deleted by an earlier attempt: " + azKeyVaultCertificateName)
+	callCtx, cancel = keyVaultContext(ctx, OperationPurgeDeletedCertificate)
+	start = time.Now()
+	err = deletedStore.Purge(callCtx, azKeyVaultCertificateName)
+	cancel()
+	observeKeyVaultOperation(config, OperationPurgeDeletedCertificate, start, err)
+	if err != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Failed to purge certificate from Azure Key Vault")
+		return result, err
+	}
+	result.Purged = true
+	log.Log.Info("SyncSecretAKVController - Successfuly purged Azure Key Vault Certificate: " + azKeyVaultCertificateName)
+
+	return result, nil
 }
 
 func ConvertToConfig(clusterConfig *v1alpha1.ClusterConfig) *v1alpha1.Config {
 	var config v1alpha1.Config
 
+	config.Name = clusterConfig.Name
+	config.Annotations = clusterConfig.Annotations
 	config.Spec.AzKeyVaultURL = clusterConfig.Spec.AzKeyVaultURL
 	config.Spec.AzKeyVaultTenantID = clusterConfig.Spec.AzKeyVaultTenantID
 	config.Spec.AzKeyVaultClientID = clusterConfig.Spec.AzKeyVaultClientID
@@ -264,6 +689,26 @@ func ConvertToConfig(clusterConfig *v1alpha1.ClusterConfig) *v1alpha1.Config {
 	config.Spec.FilterMatchingAnnotations = clusterConfig.Spec.FilterMatchingAnnotations
 	config.Spec.AllowAzKeyVaultCertificateDeletion = clusterConfig.Spec.AllowAzKeyVaultCertificateDeletion
 	config.Spec.FilterMatchingNamespace = clusterConfig.Spec.FilterMatchingNamespace
+	config.Spec.ClusterID = clusterConfig.Spec.ClusterID
+	config.Spec.AdoptionPolicy = clusterConfig.Spec.AdoptionPolicy
+	config.Spec.CertificateTags = clusterConfig.Spec.CertificateTags
+	config.Spec.CertificateTagTemplates = clusterConfig.Spec.CertificateTagTemplates
+	config.Spec.PropagateLabels = clusterConfig.Spec.PropagateLabels
+	config.Spec.PropagateAnnotations = clusterConfig.Spec.PropagateAnnotations
+	config.Spec.CertificatePolicy = clusterConfig.Spec.CertificatePolicy
+	config.Spec.MinimumRSAKeySize = clusterConfig.Spec.MinimumRSAKeySize
+	config.Spec.AllowedDNSNames = clusterConfig.Spec.AllowedDNSNames
+	config.Spec.UnmatchPolicy = clusterConfig.Spec.UnmatchPolicy
+	config.Spec.GarbageCollection = clusterConfig.Spec.GarbageCollection
+	config.Spec.MaxDeletionsPerWindow = clusterConfig.Spec.MaxDeletionsPerWindow
+	config.Spec.DeletionWindow = clusterConfig.Spec.DeletionWindow
+	config.Spec.DeletionGracePeriod = clusterConfig.Spec.DeletionGracePeriod
+	config.Spec.CertificateDiscovery = clusterConfig.Spec.CertificateDiscovery
+	config.Spec.CertificateNameTemplate = clusterConfig.Spec.CertificateNameTemplate
+	config.Spec.DryRun = clusterConfig.Spec.DryRun
+	config.Spec.Backend = clusterConfig.Spec.Backend
+	config.Spec.HashiCorpVault = clusterConfig.Spec.HashiCorpVault
+	config.Spec.Filesystem = clusterConfig.Spec.Filesystem
 
 	return &config
 }
@@ -286,42 +731,72 @@ func convertToConfig(data interface{}) (*v1alpha1.Config, error) {
 	return &config, nil
 }
 
-func ImportOrUpdateAzKeyVaultCertificate(config *apiv1alpha1.Config, azKeyVaultCertificateName string, secret *corev1.Secret) error {
+// ImportOrUpdateCertificate imports the Secret certificate as a new version of the certificate in the store and
+// returns the imported certificate. synced tells whether the SyncSecretAKV of the Secret shows an earlier sync, see
+// HasSyncedCertificate. In dry run nothing is imported and the certificate is nil.
+func ImportOrUpdateCertificate(ctx context.Context, store certstore.Store, config *apiv1alpha1.Config, azKeyVaultCertificateName string, secret *corev1.Secret, synced bool) (*certstore.Certificate, error) {
 
 	log.Log.Info("SyncSecretAKVController - Importing or Updating Azure Key Vault Certificate")
 
-	// Create Azure Credential
-	clientCertificate := NewAzKeyVaultClientConfig(config)
-
-	var pubKey string
-	var privKey string
-
-	// Need to take care of the ca.crt in case it exist
-	for key, value := range secret.Data {
-		//log.Log.Info("SyncSecretAKVController - Key: ", key, "\n", "Value: ", string(value))
-		log.Log.Info("SyncSecretAKVController - Secret Key: " + key)
-		if key == "tls.crt" {
-			pubKey = string(value)
+	// Refuse to import a new version over a certificate owned by someone else
+	callCtx, cancel := keyVaultContext(ctx, OperationGetCertificate)
+	start := time.Now()
+	existing, err := store.Get(callCtx, azKeyVaultCertificateName)
+	cancel()
+	observeKeyVaultOperation(config, OperationGetCertificate, start, err)
+	if err != nil && !certstore.IsNotFound(err) {
+		log.Log.Error(err, "SyncSecretAKVController - Failed to get certificate from Azure Key Vault")
+		return nil, err
+	}
+	if err == nil {
+		ownership := GetCertificateOwnership(existing.Tags, config, secret.Namespace, secret.Name)
+		legacy := IsLegacyCertificate(ownership, azKeyVaultCertificateName, types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}, synced)
+		if !IsCertificateManageable(ownership, config.Spec.AdoptionPolicy) && !legacy {
+			log.Log.Info("SyncSecretAKVController - Refusing to update Azure Key Vault Certificate not owned by this controller: " + azKeyVaultCertificateName + ", Ownership: " + string(ownership))
+			return nil, ErrCertificateNotOwned
 		}
-		if key == "tls.key" {
-			privKey = string(value)
+		if legacy {
+			log.Log.Info("SyncSecretAKVController - Tagging legacy Azure Key Vault Certificate with the ownership tags on import: " + azKeyVaultCertificateName)
+		} else if ownership != CertificateOwned {
+			log.Log.Info("SyncSecretAKVController - Adopting Azure Key Vault Certificate per AdoptionPolicy " + string(config.Spec.AdoptionPolicy) + ": " + azKeyVaultCertificateName)
 		}
 	}
 
-	fullCert := ConvertToPkcs8PEM(&privKey)
-	fullCert = pubKey + "\n" + fullCert
+	tags, err := BuildCertificateTags(config, secret)
+	if err != nil {
+		log.Log.Error(err, "SyncSecretAKVController - Failed to build Azure Key Vault Certificate tags")
+		return nil, err
+	}
 
 	//Import Certificate
-	_, err := clientCertificate.ImportCertificate(context.TODO(), azKeyVaultCertificateName, azcertificates.ImportCertificateParameters{Base64EncodedCertificate: &fullCert}, nil)
+	request := certstore.ImportRequest{
+		CertificatePEM: secret.Data[corev1.TLSCertKey],
+		PrivateKeyPEM:  secret.Data[corev1.TLSPrivateKeyKey],
+		Tags:           tags,
+		Policy:         config.Spec.CertificatePolicy,
+	}
+	if IsDryRun(config) {
+		log.Log.Info("SyncSecretAKVController - " + dryRunMessage("import or update Azure Key Vault Certificate: "+azKeyVaultCertificateName))
+		return nil, nil
+	}
+	callCtx, cancel = keyVaultContext(ctx, OperationImportCertificate)
+	start = time.Now()
+	certificate, err := store.Import(callCtx, azKeyVaultCertificateName, request)
+	cancel()
+	observeKeyVaultOperation(config, OperationImportCertificate, start, err)
 	if err != nil {
 		log.Log.Error(err, "SyncSecretAKVController - Failed to import or update certificate into Azure Key Vault")
+		return nil, err
 	}
-	return err
+	return certificate, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *SyncSecretAKVReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&apiv1alpha1.SyncSecretAKV{}).
+		Watches(&apiv1alpha1.Config{}, handler.EnqueueRequestsFromMapFunc(r.syncSecretAKVsForConfig), builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&apiv1alpha1.ClusterConfig{}, handler.EnqueueRequestsFromMapFunc(r.syncSecretAKVsForConfig), builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
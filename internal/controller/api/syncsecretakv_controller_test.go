@@ -69,8 +69,9 @@ var _ = Describe("SyncSecretAKV Controller", func() {
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
 			controllerReconciler := &SyncSecretAKVReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				NewStore: testStoreFactory,
 			}
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
@@ -0,0 +1,73 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/controller/api"
+)
+
+// secretsForConfig maps a change of a Config or ClusterConfig to the Secrets it affects: the kubernetes.io/tls
+// Secrets of the namespaces selected by the Config in effect, and every Secret that already has a SyncSecretAKV
+// so Secrets that no longer match the filters are re-evaluated as well
+func (r *SecretReconciler) secretsForConfig(ctx context.Context, _ client.Object) []reconcile.Request {
+	seen := map[types.NamespacedName]bool{}
+	requests := []reconcile.Request{}
+	enqueue := func(name types.NamespacedName) {
+		if !seen[name] {
+			seen[name] = true
+			requests = append(requests, reconcile.Request{NamespacedName: name})
+		}
+	}
+
+	syncSecretAKVs := &apiv1alpha1.SyncSecretAKVList{}
+	if err := r.List(ctx, syncSecretAKVs); err != nil {
+		log.Log.Error(err, "SecretController - Unable to list SyncSecretAKVs after a Config change")
+	}
+	for _, syncSecretAKV := range syncSecretAKVs.Items {
+		enqueue(types.NamespacedName{Namespace: syncSecretAKV.Namespace, Name: syncSecretAKV.Name})
+	}
+
+	// The Config may have been deleted, in which case only the synced Secrets are re-evaluated
+	config, err := api.LoadConfig(ctx, r.Client)
+	if err != nil {
+		return requests
+	}
+	for _, namespace := range config.Spec.FilterMatchingNamespace {
+		secrets := &corev1.SecretList{}
+		if err := r.List(ctx, secrets, client.InNamespace(namespace)); err != nil {
+			log.Log.Error(err, "SecretController - Unable to list Secrets in namespace "+namespace+" after a Config change")
+			continue
+		}
+		for _, secret := range secrets.Items {
+			if isCandidateSecret(&secret, r.LabelSelector) {
+				enqueue(types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name})
+			}
+		}
+	}
+
+	log.Log.Info("SecretController - Config changed, re-evaluating affected Secrets")
+	return requests
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+var _ = Describe("Config watch", func() {
+	It("should enqueue the TLS Secrets of the Config namespaces and the synced Secrets", func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(apiv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+		secret := func(namespace string, name string, secretType corev1.SecretType) *corev1.Secret {
+			return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}, Type: secretType}
+		}
+		config := &apiv1alpha1.Config{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "syncsecretakv-system", Name: "config"},
+			Spec:       apiv1alpha1.ConfigSpec{FilterMatchingNamespace: []string{"apps"}},
+		}
+		r := &SecretReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			config,
+			secret("apps", "app-tls", corev1.SecretTypeTLS),
+			secret("apps", "app-token", corev1.SecretTypeServiceAccountToken),
+			secret("other", "other-tls", corev1.SecretTypeTLS),
+			&apiv1alpha1.SyncSecretAKV{ObjectMeta: metav1.ObjectMeta{Namespace: "legacy", Name: "legacy-tls"}},
+			&apiv1alpha1.SyncSecretAKV{ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "app-tls"}},
+		).Build()}
+
+		Expect(r.secretsForConfig(context.Background(), config)).To(ConsistOf(
+			reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "apps", Name: "app-tls"}},
+			reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "legacy", Name: "legacy-tls"}},
+		))
+	})
+})
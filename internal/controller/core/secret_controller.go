@@ -22,24 +22,38 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
 	"github.com/welasco/syncsecretakv/internal/controller/api"
+	"github.com/welasco/syncsecretakv/internal/events"
 )
 
 // SecretReconciler reconciles a Secret object
 type SecretReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// MaxConcurrentReconciles is the number of Secrets reconciled in parallel, 1 when unset
+	MaxConcurrentReconciles int
+	// LabelSelector limits the synced Secrets to the ones matching it, all kubernetes.io/tls Secrets when nil.
+	// Secrets that stop matching it are handled by the Config UnmatchPolicy.
+	LabelSelector labels.Selector
 }
 
 // +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=secrets/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=core,resources=secrets/finalizers,verbs=update
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -61,8 +75,9 @@ func (r *SecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	// LoadConfig function is defined in the api package at internal/controller/api/config_controller.go
 	config, err := api.LoadConfig(ctx, r.Client)
 	if err != nil {
+		// The Secret is enqueued again by the Config and ClusterConfig watches once a Config is created
 		log.Log.Info("SecretController - Config not found. Unable to cind a Config in namespace: " + req.NamespacedName.Namespace + ". Unable to find ClusterConfig in the cluster.")
-		return ctrl.Result{Requeue: true, RequeueAfter: time.Duration(30 * time.Second)}, nil
+		return ctrl.Result{}, nil
 	}
 
 	secret := &corev1.Secret{}
@@ -74,6 +89,15 @@ func (r *SecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		deleteSyncSecretAKV := &apiv1alpha1.SyncSecretAKV{}
 		if err := r.Get(ctx, req.NamespacedName, deleteSyncSecretAKV); err != nil && errors.IsNotFound(err) {
 			log.Log.Info("SecretController - Unable to fetch SyncSecretAKV, resource was probably deleted")
+		} else if api.IsPaused(deleteSyncSecretAKV, nil) {
+			log.Log.Info("SecretController - SyncSecretAKV is paused, not deleting it: " + deleteSyncSecretAKV.Name)
+		} else if api.DeletionGracePeriod(config) > 0 {
+			// The SyncSecretAKV controller deletes it once the grace period has passed, unless the Secret is re-created
+			log.Log.Info("SecretController - Keeping SyncSecretAKV during the DeletionGracePeriod: " + deleteSyncSecretAKV.Name)
+			if err := api.MarkSecretDeleted(ctx, r.Client, deleteSyncSecretAKV, time.Now()); err != nil {
+				log.Log.Error(err, "SecretController - Unable to mark the Secret of SyncSecretAKV as deleted")
+				return ctrl.Result{}, err
+			}
 		} else {
 			if err := r.Delete(ctx, deleteSyncSecretAKV); err != nil {
 				log.Log.Error(err, "SecretController - Unable to delete SyncSecretAKV")
@@ -84,6 +108,18 @@ func (r *SecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	// Leave the SyncSecretAKV untouched while the Secret is paused, changes are synced once it is resumed
+	if api.IsPaused(nil, secret) {
+		log.Log.Info("SecretController - Secret is paused, Ignoring Secret. Secret Name: " + secret.Name + " Namespace Name: " + secret.Namespace)
+		return ctrl.Result{}, nil
+	}
+
+	// Check if the secret matches the --secret-label-selector
+	if r.LabelSelector != nil && !r.LabelSelector.Matches(labels.Set(secret.Labels)) {
+		log.Log.Info("SecretController - Secret does not match the secret label selector, Ignoring Secret. Secret Name: " + secret.Name + " Namespace Name: " + secret.Namespace)
+		return r.handleUnmatchedSecret(ctx, config, secret, "Secret does not match --secret-label-selector "+r.LabelSelector.String())
+	}
+
 	// Check if the secret is in the Config.FilterMatchingNamespace
 	namespaceFound := false
 	for _, namespace := range config.Spec.FilterMatchingNamespace {
@@ -93,7 +129,7 @@ func (r *SecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	}
 	if !namespaceFound {
 		log.Log.Info("SecretController - Namespace not listed in FilterMatchingNamespace, Ignoring Secret. Secret Name: " + secret.Name + " Namespace Name: " + secret.Namespace)
-		return ctrl.Result{}, nil
+		return r.handleUnmatchedSecret(ctx, config, secret, "Namespace "+secret.Namespace+" is not listed in Config filterMatchingNamespace")
 	}
 
 	// Check if Secret type is kubernetes.io/tls
@@ -106,7 +142,8 @@ func (r *SecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	for key, value := range config.Spec.FilterMatchingLabels {
 		if secret.Labels[key] != value {
 			log.Log.Info("SecretController - Label not found in Secret: " + secret.Name + ", Label Key: " + key + " Label Value " + value + ". Ignoring the Secret because of label mismatch comparing with Config FilterMatchingLabels")
-			return ctrl.Result{}, nil
+			events.Emit(r.Recorder, secret, corev1.EventTypeNormal, events.ReasonSkipped, "Secret does not match Config filterMatchingLabels "+key+"="+value+", not syncing to Azure Key Vault")
+			return r.handleUnmatchedSecret(ctx, config, secret, "Secret does not match Config filterMatchingLabels "+key+"="+value)
 		}
 	}
 
@@ -114,7 +151,8 @@ func (r *SecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	for key, value := range config.Spec.FilterMatchingAnnotations {
 		if secret.Annotations[key] != value {
 			log.Log.Info("SecretController - Annotation not found in Secret: " + secret.Name + ", Annotation Key: " + key + " Annotation Value " + value + ". Ignoring the Secret because of Annotation mismatch comparing with Config FilterMatchingAnnotations")
-			return ctrl.Result{}, nil
+			events.Emit(r.Recorder, secret, corev1.EventTypeNormal, events.ReasonSkipped, "Secret does not match Config filterMatchingAnnotations "+key+"="+value+", not syncing to Azure Key Vault")
+			return r.handleUnmatchedSecret(ctx, config, secret, "Secret does not match Config filterMatchingAnnotations "+key+"="+value)
 		}
 	}
 
@@ -146,9 +184,15 @@ func (r *SecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	} else {
 		// SyncSecretAKV already exist in the cluster, updating it
 		// Update if secret.ResourceVersion is different then SyncSecretAKV.Spec.SecretResourceVersion
-		if secret.ResourceVersion != syncSecretAKV.Spec.SecretResourceVersion {
+		// Resume syncing a Secret that matches the filters again after the UnmatchPolicy StopSyncing,
+		// or that was re-created within the DeletionGracePeriod
+		_, unmatched := syncSecretAKV.Annotations[apiv1alpha1.AnnotationUnmatched]
+		_, deleted := syncSecretAKV.Annotations[apiv1alpha1.AnnotationSecretDeletedAt]
+		if secret.ResourceVersion != syncSecretAKV.Spec.SecretResourceVersion || unmatched || deleted {
 			log.Log.Info("SecretController - Secret Update detected, Updating SyncSecretAKV with new Secret Resource Version")
 			syncSecretAKV.Spec.SecretResourceVersion = secret.ResourceVersion
+			delete(syncSecretAKV.Annotations, apiv1alpha1.AnnotationUnmatched)
+			delete(syncSecretAKV.Annotations, apiv1alpha1.AnnotationSecretDeletedAt)
 			if err := r.Update(ctx, syncSecretAKV); err != nil {
 				log.Log.Error(err, "Unable to Update SyncSecretAKV")
 				//return ctrl.Result{}, err
@@ -165,6 +209,9 @@ func (r *SecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 // SetupWithManager sets up the controller with the Manager.
 func (r *SecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.Secret{}).
+		For(&corev1.Secret{}, builder.WithPredicates(SecretPredicate(r.LabelSelector))).
+		Watches(&apiv1alpha1.Config{}, handler.EnqueueRequestsFromMapFunc(r.secretsForConfig), builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&apiv1alpha1.ClusterConfig{}, handler.EnqueueRequestsFromMapFunc(r.secretsForConfig), builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
@@ -0,0 +1,86 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+var _ = Describe("Paused Secrets", func() {
+	var (
+		scheme        *runtime.Scheme
+		config        *apiv1alpha1.Config
+		syncSecretAKV *apiv1alpha1.SyncSecretAKV
+		key           client.ObjectKey
+	)
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(apiv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+		config = &apiv1alpha1.Config{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "config"},
+			Spec:       apiv1alpha1.ConfigSpec{FilterMatchingNamespace: []string{"apps"}},
+		}
+		syncSecretAKV = &apiv1alpha1.SyncSecretAKV{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "app-tls"},
+			Spec:       apiv1alpha1.SyncSecretAKVSpec{SecretName: "app-tls", SecretResourceVersion: "1"},
+		}
+		key = client.ObjectKeyFromObject(syncSecretAKV)
+	})
+
+	reconcile := func(objects ...client.Object) client.Client {
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+		r := &SecretReconciler{Client: c, Recorder: record.NewFakeRecorder(10)}
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		return c
+	}
+
+	It("should not record changes of a paused Secret", func() {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "app-tls", Annotations: map[string]string{apiv1alpha1.AnnotationPaused: "true"}},
+			Type:       corev1.SecretTypeTLS,
+		}
+		c := reconcile(config, secret, syncSecretAKV)
+
+		stored := &apiv1alpha1.SyncSecretAKV{}
+		Expect(c.Get(context.Background(), key, stored)).To(Succeed())
+		Expect(stored.Spec.SecretResourceVersion).To(Equal("1"))
+	})
+
+	It("should keep a paused SyncSecretAKV whose Secret was deleted", func() {
+		syncSecretAKV.Annotations = map[string]string{apiv1alpha1.AnnotationPaused: "true"}
+		c := reconcile(config, syncSecretAKV)
+
+		Expect(c.Get(context.Background(), key, &apiv1alpha1.SyncSecretAKV{})).To(Succeed())
+	})
+})
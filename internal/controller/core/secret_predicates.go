@@ -0,0 +1,82 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// SecretCacheOptions restricts the manager cache to kubernetes.io/tls Secrets and drops their managed fields, so
+// the informer does not hold every Secret of the cluster in memory. The label selector is deliberately not applied
+// to the cache: a Secret leaving it would be reported as deleted instead of going through the Config UnmatchPolicy.
+func SecretCacheOptions() cache.ByObject {
+	return cache.ByObject{
+		Field:     fields.OneTermEqualSelector("type", string(corev1.SecretTypeTLS)),
+		Transform: cache.TransformStripManagedFields(),
+	}
+}
+
+// SecretPredicate drops the events of Secrets that can never be synced before they are enqueued, and the
+// updates that leave the certificate, labels and annotations of a Secret unchanged
+func SecretPredicate(labelSelector labels.Selector) predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return isCandidateSecret(e.Object, labelSelector)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return isCandidateSecret(e.Object, labelSelector)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			// A Secret leaving the label selector is still enqueued, the reconciler applies the UnmatchPolicy to it
+			if !isCandidateSecret(e.ObjectOld, labelSelector) && !isCandidateSecret(e.ObjectNew, labelSelector) {
+				return false
+			}
+			return secretChanged(e.ObjectOld, e.ObjectNew)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return isCandidateSecret(e.Object, labelSelector)
+		},
+	}
+}
+
+func isCandidateSecret(obj client.Object, labelSelector labels.Selector) bool {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok || secret.Type != corev1.SecretTypeTLS {
+		return false
+	}
+	return labelSelector == nil || labelSelector.Matches(labels.Set(secret.Labels))
+}
+
+func secretChanged(oldObj client.Object, newObj client.Object) bool {
+	oldSecret, oldOk := oldObj.(*corev1.Secret)
+	newSecret, newOk := newObj.(*corev1.Secret)
+	if !oldOk || !newOk {
+		return true
+	}
+	return !reflect.DeepEqual(oldSecret.Data, newSecret.Data) ||
+		!reflect.DeepEqual(oldSecret.Labels, newSecret.Labels) ||
+		!reflect.DeepEqual(oldSecret.Annotations, newSecret.Annotations) ||
+		!oldSecret.DeletionTimestamp.Equal(newSecret.DeletionTimestamp)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("Secret predicates", func() {
+	newSecret := func(secretType corev1.SecretType, secretLabels map[string]string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-tls", Namespace: "default", Labels: secretLabels, ResourceVersion: "1"},
+			Type:       secretType,
+			Data:       map[string][]byte{"tls.crt": []byte("certificate")},
+		}
+	}
+
+	It("should only enqueue kubernetes.io/tls Secrets", func() {
+		p := SecretPredicate(nil)
+		Expect(p.Create(event.CreateEvent{Object: newSecret(corev1.SecretTypeTLS, nil)})).To(BeTrue())
+		Expect(p.Delete(event.DeleteEvent{Object: newSecret(corev1.SecretTypeTLS, nil)})).To(BeTrue())
+		Expect(p.Create(event.CreateEvent{Object: newSecret(corev1.SecretTypeServiceAccountToken, nil)})).To(BeFalse())
+		Expect(p.Create(event.CreateEvent{Object: newSecret("helm.sh/release.v1", nil)})).To(BeFalse())
+	})
+
+	It("should only enqueue Secrets matching the label selector", func() {
+		selector, err := labels.Parse("syncsecretakv.io/sync=true")
+		Expect(err).NotTo(HaveOccurred())
+		p := SecretPredicate(selector)
+
+		matching := newSecret(corev1.SecretTypeTLS, map[string]string{"syncsecretakv.io/sync": "true"})
+		other := newSecret(corev1.SecretTypeTLS, nil)
+		Expect(p.Create(event.CreateEvent{Object: matching})).To(BeTrue())
+		Expect(p.Create(event.CreateEvent{Object: other})).To(BeFalse())
+
+		// Removing the label is still enqueued so the UnmatchPolicy applies
+		Expect(p.Update(event.UpdateEvent{ObjectOld: matching, ObjectNew: other})).To(BeTrue())
+	})
+
+	It("should drop updates that do not change the Secret content", func() {
+		p := SecretPredicate(nil)
+		oldSecret := newSecret(corev1.SecretTypeTLS, nil)
+
+		resynced := oldSecret.DeepCopy()
+		resynced.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubectl"}}
+		resynced.ResourceVersion = "2"
+		Expect(p.Update(event.UpdateEvent{ObjectOld: oldSecret, ObjectNew: resynced})).To(BeFalse())
+
+		renewed := oldSecret.DeepCopy()
+		renewed.Data["tls.crt"] = []byte("renewed certificate")
+		Expect(p.Update(event.UpdateEvent{ObjectOld: oldSecret, ObjectNew: renewed})).To(BeTrue())
+
+		annotated := oldSecret.DeepCopy()
+		annotated.Annotations = map[string]string{"syncsecretakv.io/sync": "true"}
+		Expect(p.Update(event.UpdateEvent{ObjectOld: oldSecret, ObjectNew: annotated})).To(BeTrue())
+	})
+
+	It("should cache only kubernetes.io/tls Secrets", func() {
+		options := SecretCacheOptions()
+		Expect(options.Field.String()).To(Equal("type=kubernetes.io/tls"))
+		Expect(options.Label).To(BeNil())
+		Expect(options.Transform).NotTo(BeNil())
+	})
+})
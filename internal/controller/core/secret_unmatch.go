@@ -0,0 +1,69 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+	"github.com/welasco/syncsecretakv/internal/events"
+)
+
+// handleUnmatchedSecret applies the Config UnmatchPolicy to a Secret that does not match the filters.
+// Secrets that were never synced have no SyncSecretAKV and are simply ignored.
+func (r *SecretReconciler) handleUnmatchedSecret(ctx context.Context, config *apiv1alpha1.Config, secret *corev1.Secret, message string) (ctrl.Result, error) {
+	syncSecretAKV := &apiv1alpha1.SyncSecretAKV{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(secret), syncSecretAKV); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	switch config.Spec.UnmatchPolicy {
+	case apiv1alpha1.UnmatchPolicyDelete:
+		// The SyncSecretAKV controller deletes the certificate when the Config allows deletion
+		log.Log.Info("SecretController - Secret no longer matches the Config filters, deleting SyncSecretAKV per UnmatchPolicy Delete: " + syncSecretAKV.Name)
+		if err := r.Delete(ctx, syncSecretAKV); client.IgnoreNotFound(err) != nil {
+			log.Log.Error(err, "SecretController - Unable to delete SyncSecretAKV")
+			return ctrl.Result{}, err
+		}
+		events.Emit(r.Recorder, secret, corev1.EventTypeNormal, events.ReasonUnmatched, message+", deleted SyncSecretAKV")
+
+	case apiv1alpha1.UnmatchPolicyStopSyncing:
+		if _, unmatched := syncSecretAKV.Annotations[apiv1alpha1.AnnotationUnmatched]; unmatched {
+			return ctrl.Result{}, nil
+		}
+		log.Log.Info("SecretController - Secret no longer matches the Config filters, stop syncing per UnmatchPolicy StopSyncing: " + syncSecretAKV.Name)
+		if syncSecretAKV.Annotations == nil {
+			syncSecretAKV.Annotations = map[string]string{}
+		}
+		syncSecretAKV.Annotations[apiv1alpha1.AnnotationUnmatched] = "true"
+		if err := r.Update(ctx, syncSecretAKV); err != nil {
+			log.Log.Error(err, "SecretController - Unable to update SyncSecretAKV")
+			return ctrl.Result{}, err
+		}
+		events.Emit(r.Recorder, secret, corev1.EventTypeNormal, events.ReasonUnmatched, message+", stopped syncing to Azure Key Vault")
+
+	default:
+		log.Log.Info("SecretController - Secret no longer matches the Config filters, retaining SyncSecretAKV per UnmatchPolicy Retain: " + syncSecretAKV.Name)
+	}
+
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apiv1alpha1 "github.com/welasco/syncsecretakv/api/api/v1alpha1"
+)
+
+var _ = Describe("Unmatched Secrets", func() {
+	var (
+		r      *SecretReconciler
+		secret *corev1.Secret
+		key    client.ObjectKey
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(apiv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+		secret = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "app-tls"}, Type: corev1.SecretTypeTLS}
+		key = client.ObjectKeyFromObject(secret)
+		r = &SecretReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				secret,
+				&apiv1alpha1.SyncSecretAKV{ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "app-tls"}},
+			).Build(),
+			Recorder: record.NewFakeRecorder(10),
+		}
+	})
+
+	handle := func(policy apiv1alpha1.UnmatchPolicy) {
+		config := &apiv1alpha1.Config{Spec: apiv1alpha1.ConfigSpec{UnmatchPolicy: policy}}
+		_, err := r.handleUnmatchedSecret(context.Background(), config, secret, "Secret does not match")
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("should keep the SyncSecretAKV with the Retain policy", func() {
+		handle(apiv1alpha1.UnmatchPolicyRetain)
+		syncSecretAKV := &apiv1alpha1.SyncSecretAKV{}
+		Expect(r.Get(context.Background(), key, syncSecretAKV)).To(Succeed())
+		Expect(syncSecretAKV.Annotations).NotTo(HaveKey(apiv1alpha1.AnnotationUnmatched))
+	})
+
+	It("should mark the SyncSecretAKV with the StopSyncing policy", func() {
+		handle(apiv1alpha1.UnmatchPolicyStopSyncing)
+		syncSecretAKV := &apiv1alpha1.SyncSecretAKV{}
+		Expect(r.Get(context.Background(), key, syncSecretAKV)).To(Succeed())
+		Expect(syncSecretAKV.Annotations).To(HaveKeyWithValue(apiv1alpha1.AnnotationUnmatched, "true"))
+	})
+
+	It("should delete the SyncSecretAKV with the Delete policy", func() {
+		handle(apiv1alpha1.UnmatchPolicyDelete)
+		err := r.Get(context.Background(), key, &apiv1alpha1.SyncSecretAKV{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should apply the UnmatchPolicy to a Secret leaving the label selector", func() {
+		selector, err := labels.Parse("syncsecretakv.io/sync=true")
+		Expect(err).NotTo(HaveOccurred())
+		config := &apiv1alpha1.Config{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "config"},
+			Spec: apiv1alpha1.ConfigSpec{
+				FilterMatchingNamespace: []string{"apps"},
+				UnmatchPolicy:           apiv1alpha1.UnmatchPolicyStopSyncing,
+			},
+		}
+		Expect(r.Create(context.Background(), config)).To(Succeed())
+		r.LabelSelector = selector
+
+		_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		syncSecretAKV := &apiv1alpha1.SyncSecretAKV{}
+		Expect(r.Get(context.Background(), key, syncSecretAKV)).To(Succeed())
+		Expect(syncSecretAKV.Annotations).To(HaveKeyWithValue(apiv1alpha1.AnnotationUnmatched, "true"))
+	})
+})
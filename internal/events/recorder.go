@@ -0,0 +1,134 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// Event reasons emitted by the controllers
+const (
+	ReasonImported        = "Imported"
+	ReasonImportFailed    = "ImportFailed"
+	ReasonSkipped         = "Skipped"
+	ReasonDeleted         = "Deleted"
+	ReasonDeleteFailed    = "DeleteFailed"
+	ReasonPurged          = "Purged"
+	ReasonDriftRepaired   = "DriftRepaired"
+	ReasonRepairFailed    = "RepairFailed"
+	ReasonVerified        = "Verified"
+	ReasonVerifyFailed    = "VerifyFailed"
+	ReasonUnmatched       = "Unmatched"
+	ReasonDeletionBlocked = "DeletionBlocked"
+	ReasonAdopted         = "Adopted"
+	ReasonDryRun          = "DryRun"
+)
+
+// DefaultDeduplicationWindow is how long an identical event is suppressed after it was emitted
+const DefaultDeduplicationWindow = time.Hour
+
+type eventKey struct {
+	objectType string
+	namespace  string
+	name       string
+	eventtype  string
+	reason     string
+	message    string
+}
+
+// DeduplicatingRecorder wraps an EventRecorder and drops an event when the same object already received an
+// event with the same type, reason and message within the window, so periodic resyncs and certificate
+// renewals don't flood the API server with repeated events.
+type DeduplicatingRecorder struct {
+	recorder record.EventRecorder
+	window   time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	seen      map[eventKey]time.Time
+	lastPrune time.Time
+}
+
+// NewDeduplicatingRecorder returns a DeduplicatingRecorder emitting through recorder
+func NewDeduplicatingRecorder(recorder record.EventRecorder, window time.Duration) *DeduplicatingRecorder {
+	return &DeduplicatingRecorder{
+		recorder: recorder,
+		window:   window,
+		now:      time.Now,
+		seen:     map[eventKey]time.Time{},
+	}
+}
+
+// Event implements record.EventRecorder
+func (r *DeduplicatingRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if r.shouldEmit(object, eventtype, reason, message) {
+		r.recorder.Event(object, eventtype, reason, message)
+	}
+}
+
+// Eventf implements record.EventRecorder
+func (r *DeduplicatingRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// AnnotatedEventf implements record.EventRecorder
+func (r *DeduplicatingRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	message := fmt.Sprintf(messageFmt, args...)
+	if r.shouldEmit(object, eventtype, reason, message) {
+		r.recorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", message)
+	}
+}
+
+func (r *DeduplicatingRecorder) shouldEmit(object runtime.Object, eventtype, reason, message string) bool {
+	key := eventKey{objectType: fmt.Sprintf("%T", object), eventtype: eventtype, reason: reason, message: message}
+	if accessor, err := meta.Accessor(object); err == nil {
+		key.namespace = accessor.GetNamespace()
+		key.name = accessor.GetName()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if now.Sub(r.lastPrune) > r.window {
+		for seenKey, emitted := range r.seen {
+			if now.Sub(emitted) >= r.window {
+				delete(r.seen, seenKey)
+			}
+		}
+		r.lastPrune = now
+	}
+
+	if emitted, ok := r.seen[key]; ok && now.Sub(emitted) < r.window {
+		return false
+	}
+	r.seen[key] = now
+	return true
+}
+
+// Emit records an event when the recorder is set, controllers built without a recorder emit nothing
+func Emit(recorder record.EventRecorder, object runtime.Object, eventtype, reason, message string) {
+	if recorder != nil {
+		recorder.Event(object, eventtype, reason, message)
+	}
+}
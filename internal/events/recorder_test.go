@@ -0,0 +1,72 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+var _ = Describe("DeduplicatingRecorder", func() {
+	var (
+		fake     *record.FakeRecorder
+		recorder *DeduplicatingRecorder
+		now      time.Time
+		secret   *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		fake = record.NewFakeRecorder(10)
+		recorder = NewDeduplicatingRecorder(fake, time.Hour)
+		now = time.Now()
+		recorder.now = func() time.Time { return now }
+		secret = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "app-tls", Namespace: "default"}}
+	})
+
+	It("should drop identical events within the window", func() {
+		recorder.Event(secret, corev1.EventTypeNormal, ReasonImported, "Imported certificate")
+		recorder.Eventf(secret, corev1.EventTypeNormal, ReasonImported, "Imported %s", "certificate")
+		Expect(fake.Events).To(HaveLen(1))
+	})
+
+	It("should emit events that differ in object, reason or message", func() {
+		other := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other-tls", Namespace: "default"}}
+
+		recorder.Event(secret, corev1.EventTypeNormal, ReasonImported, "Imported certificate")
+		recorder.Event(other, corev1.EventTypeNormal, ReasonImported, "Imported certificate")
+		recorder.Event(secret, corev1.EventTypeWarning, ReasonImportFailed, "Imported certificate")
+		recorder.Event(secret, corev1.EventTypeNormal, ReasonImported, "Imported certificate again")
+		Expect(fake.Events).To(HaveLen(4))
+	})
+
+	It("should emit the event again once the window has passed", func() {
+		recorder.Event(secret, corev1.EventTypeNormal, ReasonImported, "Imported certificate")
+		now = now.Add(2 * time.Hour)
+		recorder.Event(secret, corev1.EventTypeNormal, ReasonImported, "Imported certificate")
+		Expect(fake.Events).To(HaveLen(2))
+		Expect(recorder.seen).To(HaveLen(1))
+	})
+
+	It("should ignore a nil recorder", func() {
+		Expect(func() { Emit(nil, secret, corev1.EventTypeNormal, ReasonImported, "Imported certificate") }).NotTo(Panic())
+	})
+})
@@ -0,0 +1,50 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakekeyvault
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// Token is the access token the Server accepts and Credential returns by default
+const Token = "fake-key-vault-token"
+
+// Credential is an azcore.TokenCredential returning a static token without calling Microsoft Entra ID
+type Credential struct {
+	// Token is the returned access token, the Token accepted by the Server when empty
+	Token string
+	// Err is returned instead of a token when set, to test authentication failures
+	Err error
+}
+
+var _ azcore.TokenCredential = Credential{}
+
+// GetToken returns the token of the Credential, valid for an hour
+func (c Credential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if c.Err != nil {
+		return azcore.AccessToken{}, c.Err
+	}
+	token := c.Token
+	if token == "" {
+		token = Token
+	}
+	return azcore.AccessToken{Token: token, ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
@@ -0,0 +1,648 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fakekeyvault is an in-process Azure Key Vault serving the certificate API over HTTPS, so tests can
+// exercise the Azure Key Vault store and the reconcilers end to end without network access
+package fakekeyvault
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azcertificates"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+const (
+	// DefaultPageSize is the number of certificates of a list page when the request sets no maxresults
+	DefaultPageSize = 25
+	// RecoverableDays is the soft-delete retention reported in the certificate attributes
+	RecoverableDays = 90
+
+	contentTypePEM    = "application/x-pem-file"
+	contentTypePKCS12 = "application/x-pkcs12"
+)
+
+// Fault is an error response the Server returns instead of handling a request
+type Fault struct {
+	StatusCode int
+	Code       string
+	Message    string
+	// RetryAfter is sent in the Retry-After header when not zero
+	RetryAfter time.Duration
+	// Method and PathPrefix restrict the fault to the matching requests when set
+	Method     string
+	PathPrefix string
+}
+
+// matches reports whether the fault applies to the request
+func (f Fault) matches(r *http.Request) bool {
+	return (f.Method == "" || f.Method == r.Method) && strings.HasPrefix(r.URL.Path, f.PathPrefix)
+}
+
+// Server is a fake Azure Key Vault. It supports importing, getting, updating, listing, deleting, recovering and
+// purging certificates with the soft-delete states of a vault with purge protection disabled, and answers
+// unauthenticated requests with the challenge the Key Vault clients expect.
+type Server struct {
+	// DeletionDelay is how long a deleted certificate stays in the deleting state, where it is neither found nor
+	// deleted and purging or recovering it conflicts. Set it before the first request.
+	DeletionDelay time.Duration
+
+	server       *httptest.Server
+	mu           sync.Mutex
+	certificates map[string]*certificate
+	faults       []Fault
+	requests     []string
+}
+
+// certificate is a certificate of the vault with all its versions
+type certificate struct {
+	versions map[string]*azcertificates.CertificateBundle
+	latest   string
+	policy   *azcertificates.CertificatePolicy
+	deleted  *deletion
+}
+
+// deletion is the soft-delete state of a certificate
+type deletion struct {
+	deletedDate time.Time
+	readyAt     time.Time
+}
+
+// NewServer starts a Server, which must be closed with Close
+func NewServer() *Server {
+	s := &Server{certificates: map[string]*certificate{}}
+	s.server = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Close shuts the Server down
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// URL returns the vault URL of the Server
+func (s *Server) URL() string {
+	return s.server.URL + "/"
+}
+
+// ClientOptions returns the options connecting an azcertificates client to the Server: its TLS certificate
+// is trusted, the challenge resource is not verified and retries are disabled so every fault reaches the caller
+func (s *Server) ClientOptions() *azcertificates.ClientOptions {
+	return &azcertificates.ClientOptions{
+		ClientOptions: azcore.ClientOptions{
+			Transport: s.server.Client(),
+			Retry:     policy.RetryOptions{MaxRetries: -1},
+		},
+		DisableChallengeResourceVerification: true,
+	}
+}
+
+// NewClient returns an azcertificates client of the Server authenticating with Credential
+func (s *Server) NewClient() (*azcertificates.Client, error) {
+	return azcertificates.NewClient(s.URL(), Credential{}, s.ClientOptions())
+}
+
+// FailNext answers the next count authenticated requests matching fault with fault
+func (s *Server) FailNext(count int, fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < count; i++ {
+		s.faults = append(s.faults, fault)
+	}
+}
+
+// Throttle answers the next count authenticated requests with 429 Too Many Requests and the Retry-After delay
+func (s *Server) Throttle(count int, retryAfter time.Duration) {
+	s.FailNext(count, Fault{
+		StatusCode: http.StatusTooManyRequests,
+		Code:       "Throttled",
+		Message:    "Request was not processed because too many requests were received. Reason: VaultRequestTypeLimitReached",
+		RetryAfter: retryAfter,
+	})
+}
+
+// Requests returns the method and path of every authenticated request, in order
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+// Certificate returns the current version of the certificate, false when it does not exist or is deleted
+func (s *Server) Certificate(name string) (*azcertificates.CertificateBundle, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.certificates[strings.ToLower(name)]
+	if !ok || c.deleted != nil {
+		return nil, false
+	}
+	return c.bundle(c.latest), true
+}
+
+// IsDeleted reports whether the certificate is deleted and not purged or recovered yet
+func (s *Server) IsDeleted(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.certificates[strings.ToLower(name)]
+	return ok && c.deleted != nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	// The Key Vault clients send a request without token first and authenticate with the challenge
+	if r.Header.Get("Authorization") != "Bearer "+Token {
+		w.Header().Set("WWW-Authenticate", `Bearer authorization="https://login.microsoftonline.com/00000000-0000-0000-0000-000000000000", resource="https://vault.azure.net"`)
+		writeError(w, http.StatusUnauthorized, "Unauthorized", "AKV10000: Request is missing a Bearer or PoP token.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	for i, fault := range s.faults {
+		if !fault.matches(r) {
+			continue
+		}
+		s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+		if fault.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(fault.RetryAfter.Seconds()))))
+		}
+		writeError(w, fault.StatusCode, fault.Code, fault.Message)
+		return
+	}
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	route := r.Method + " " + segments[0]
+	switch {
+	case route == "GET certificates" && len(segments) == 1:
+		s.listCertificates(w, r)
+	case route == "POST certificates" && len(segments) == 3 && segments[2] == "import":
+		s.importCertificate(w, r, segments[1])
+	case route == "GET certificates" && len(segments) == 3 && segments[2] == "policy":
+		s.getPolicy(w, segments[1])
+	case route == "PATCH certificates" && len(segments) == 3 && segments[2] == "policy":
+		s.updatePolicy(w, r, segments[1])
+	case route == "GET certificates" && (len(segments) == 2 || len(segments) == 3):
+		s.getCertificate(w, segments[1], version(segments))
+	case route == "PATCH certificates" && (len(segments) == 2 || len(segments) == 3):
+		s.updateCertificate(w, r, segments[1], version(segments))
+	case route == "DELETE certificates" && len(segments) == 2:
+		s.deleteCertificate(w, segments[1])
+	case route == "GET deletedcertificates" && len(segments) == 1:
+		s.listDeletedCertificates(w, r)
+	case route == "GET deletedcertificates" && len(segments) == 2:
+		s.getDeletedCertificate(w, segments[1])
+	case route == "DELETE deletedcertificates" && len(segments) == 2:
+		s.purgeDeletedCertificate(w, segments[1])
+	case route == "POST deletedcertificates" && len(segments) == 3 && segments[2] == "recover":
+		s.recoverDeletedCertificate(w, segments[1])
+	default:
+		writeError(w, http.StatusNotFound, "NotFound", "The fake Key Vault does not implement "+r.Method+" "+r.URL.Path)
+	}
+}
+
+func (s *Server) importCertificate(w http.ResponseWriter, r *http.Request, name string) {
+	c := s.certificates[strings.ToLower(name)]
+	if c != nil && c.deleted != nil {
+		writeError(w, http.StatusConflict, "Conflict", fmt.Sprintf("Certificate %s is currently in a deleted but recoverable state, and its name cannot be reused; in this state, the certificate can only be recovered or purged.", name))
+		return
+	}
+	var parameters azcertificates.ImportCertificateParameters
+	if err := json.NewDecoder(r.Body).Decode(&parameters); err != nil || parameters.Base64EncodedCertificate == nil {
+		writeError(w, http.StatusBadRequest, "BadParameter", "The request body is not a valid certificate import")
+		return
+	}
+	if c == nil {
+		c = &certificate{versions: map[string]*azcertificates.CertificateBundle{}, policy: s.defaultPolicy(name)}
+	}
+	policy := mergePolicy(c.policy, parameters.CertificatePolicy)
+
+	password := ""
+	if parameters.Password != nil {
+		password = *parameters.Password
+	}
+	leaf, err := parseCertificate(*parameters.Base64EncodedCertificate, *policy.SecretProperties.ContentType, password)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BadParameter", err.Error())
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	attributes := &azcertificates.CertificateAttributes{
+		Enabled:         to.Ptr(true),
+		Expires:         to.Ptr(leaf.NotAfter.UTC()),
+		NotBefore:       to.Ptr(leaf.NotBefore.UTC()),
+		Created:         to.Ptr(now),
+		Updated:         to.Ptr(now),
+		RecoverableDays: to.Ptr(int32(RecoverableDays)),
+		RecoveryLevel:   to.Ptr(azcertificates.DeletionRecoveryLevelRecoverablePurgeable),
+	}
+	if parameters.CertificateAttributes != nil && parameters.CertificateAttributes.Enabled != nil {
+		attributes.Enabled = parameters.CertificateAttributes.Enabled
+	}
+	thumbprint := sha1.Sum(leaf.Raw)
+	versionID := newVersion()
+	c.versions[versionID] = &azcertificates.CertificateBundle{
+		Attributes:     attributes,
+		CER:            leaf.Raw,
+		ContentType:    policy.SecretProperties.ContentType,
+		Tags:           parameters.Tags,
+		ID:             to.Ptr(azcertificates.ID(s.objectURL("certificates", name, versionID))),
+		KID:            to.Ptr(s.objectURL("keys", name, versionID)),
+		SID:            to.Ptr(s.objectURL("secrets", name, versionID)),
+		X509Thumbprint: thumbprint[:],
+	}
+	c.latest = versionID
+	c.policy = policy
+	s.certificates[strings.ToLower(name)] = c
+	writeJSON(w, http.StatusOK, c.bundle(versionID))
+}
+
+func (s *Server) getCertificate(w http.ResponseWriter, name string, versionID string) {
+	c, ok := s.active(w, name)
+	if !ok {
+		return
+	}
+	if versionID == "" {
+		versionID = c.latest
+	}
+	if _, ok := c.versions[versionID]; !ok {
+		writeNotFound(w, name)
+		return
+	}
+	writeJSON(w, http.StatusOK, c.bundle(versionID))
+}
+
+func (s *Server) updateCertificate(w http.ResponseWriter, r *http.Request, name string, versionID string) {
+	c, ok := s.active(w, name)
+	if !ok {
+		return
+	}
+	if versionID == "" {
+		versionID = c.latest
+	}
+	bundle, ok := c.versions[versionID]
+	if !ok {
+		writeNotFound(w, name)
+		return
+	}
+	var parameters azcertificates.UpdateCertificateParameters
+	if err := json.NewDecoder(r.Body).Decode(&parameters); err != nil {
+		writeError(w, http.StatusBadRequest, "BadParameter", "The request body is not a valid certificate update")
+		return
+	}
+	if parameters.Tags != nil {
+		bundle.Tags = parameters.Tags
+	}
+	if attributes := parameters.CertificateAttributes; attributes != nil {
+		if attributes.Enabled != nil {
+			bundle.Attributes.Enabled = attributes.Enabled
+		}
+		if attributes.Expires != nil {
+			bundle.Attributes.Expires = attributes.Expires
+		}
+		if attributes.NotBefore != nil {
+			bundle.Attributes.NotBefore = attributes.NotBefore
+		}
+	}
+	c.policy = mergePolicy(c.policy, parameters.CertificatePolicy)
+	bundle.Attributes.Updated = to.Ptr(time.Now().UTC().Truncate(time.Second))
+	writeJSON(w, http.StatusOK, c.bundle(versionID))
+}
+
+func (s *Server) getPolicy(w http.ResponseWriter, name string) {
+	c, ok := s.active(w, name)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, c.policy)
+}
+
+func (s *Server) updatePolicy(w http.ResponseWriter, r *http.Request, name string) {
+	c, ok := s.active(w, name)
+	if !ok {
+		return
+	}
+	var update azcertificates.CertificatePolicy
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, http.StatusBadRequest, "BadParameter", "The request body is not a valid certificate policy")
+		return
+	}
+	c.policy = mergePolicy(c.policy, &update)
+	writeJSON(w, http.StatusOK, c.policy)
+}
+
+func (s *Server) deleteCertificate(w http.ResponseWriter, name string) {
+	c, ok := s.active(w, name)
+	if !ok {
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	c.deleted = &deletion{deletedDate: now, readyAt: time.Now().Add(s.DeletionDelay)}
+	writeJSON(w, http.StatusOK, s.deletedBundle(name, c))
+}
+
+func (s *Server) getDeletedCertificate(w http.ResponseWriter, name string) {
+	c := s.certificates[strings.ToLower(name)]
+	if c == nil || c.deleted == nil || time.Now().Before(c.deleted.readyAt) {
+		writeError(w, http.StatusNotFound, "CertificateNotFound", fmt.Sprintf("Deleted Certificate not found: %s", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.deletedBundle(name, c))
+}
+
+func (s *Server) purgeDeletedCertificate(w http.ResponseWriter, name string) {
+	if _, ok := s.deletedAndReady(w, name); !ok {
+		return
+	}
+	delete(s.certificates, strings.ToLower(name))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) recoverDeletedCertificate(w http.ResponseWriter, name string) {
+	c, ok := s.deletedAndReady(w, name)
+	if !ok {
+		return
+	}
+	c.deleted = nil
+	writeJSON(w, http.StatusOK, c.bundle(c.latest))
+}
+
+func (s *Server) listCertificates(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for key, c := range s.certificates {
+		if c.deleted == nil {
+			names = append(names, key)
+		}
+	}
+	page, nextLink := s.page(r, "certificates", names)
+	result := azcertificates.CertificateListResult{Value: []*azcertificates.CertificateItem{}, NextLink: nextLink}
+	for _, key := range page {
+		bundle := s.certificates[key].bundle(s.certificates[key].latest)
+		result.Value = append(result.Value, &azcertificates.CertificateItem{
+			Attributes:     bundle.Attributes,
+			ID:             to.Ptr(azcertificates.ID(s.objectURL("certificates", bundle.ID.Name(), ""))),
+			Tags:           bundle.Tags,
+			X509Thumbprint: bundle.X509Thumbprint,
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) listDeletedCertificates(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for key, c := range s.certificates {
+		if c.deleted != nil && !time.Now().Before(c.deleted.readyAt) {
+			names = append(names, key)
+		}
+	}
+	page, nextLink := s.page(r, "deletedcertificates", names)
+	result := azcertificates.DeletedCertificateListResult{Value: []*azcertificates.DeletedCertificateItem{}, NextLink: nextLink}
+	for _, key := range page {
+		c := s.certificates[key]
+		deleted := s.deletedBundle(c.bundle(c.latest).ID.Name(), c)
+		result.Value = append(result.Value, &azcertificates.DeletedCertificateItem{
+			Attributes:         deleted.Attributes,
+			ID:                 to.Ptr(azcertificates.ID(s.objectURL("certificates", deleted.ID.Name(), ""))),
+			RecoveryID:         deleted.RecoveryID,
+			Tags:               deleted.Tags,
+			X509Thumbprint:     deleted.X509Thumbprint,
+			DeletedDate:        deleted.DeletedDate,
+			ScheduledPurgeDate: deleted.ScheduledPurgeDate,
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// page returns the names of the requested page, sorted, and the link of the next page
+func (s *Server) page(r *http.Request, collection string, names []string) ([]string, *string) {
+	sort.Strings(names)
+	size := DefaultPageSize
+	if maxResults, err := strconv.Atoi(r.URL.Query().Get("maxresults")); err == nil && maxResults > 0 {
+		size = maxResults
+	}
+	skip, _ := strconv.Atoi(r.URL.Query().Get("$skiptoken"))
+	if skip > len(names) {
+		skip = len(names)
+	}
+	end := skip + size
+	if end >= len(names) {
+		return names[skip:], nil
+	}
+	nextLink := fmt.Sprintf("%s/%s?maxresults=%d&$skiptoken=%d", s.server.URL, collection, size, end)
+	return names[skip:end], &nextLink
+}
+
+// active returns the certificate when it exists and is not deleted, and answers 404 otherwise
+func (s *Server) active(w http.ResponseWriter, name string) (*certificate, bool) {
+	c := s.certificates[strings.ToLower(name)]
+	if c == nil || c.deleted != nil {
+		writeNotFound(w, name)
+		return nil, false
+	}
+	return c, true
+}
+
+// deletedAndReady returns the deleted certificate once its deletion completed, and answers 404 when it is not
+// deleted and 409 while it is being deleted
+func (s *Server) deletedAndReady(w http.ResponseWriter, name string) (*certificate, bool) {
+	c := s.certificates[strings.ToLower(name)]
+	if c == nil || c.deleted == nil {
+		writeError(w, http.StatusNotFound, "CertificateNotFound", fmt.Sprintf("Deleted Certificate not found: %s", name))
+		return nil, false
+	}
+	if time.Now().Before(c.deleted.readyAt) {
+		writeError(w, http.StatusConflict, "Conflict", fmt.Sprintf("Certificate %s is currently being deleted.", name))
+		return nil, false
+	}
+	return c, true
+}
+
+func (s *Server) deletedBundle(name string, c *certificate) *azcertificates.DeletedCertificateBundle {
+	bundle := c.bundle(c.latest)
+	return &azcertificates.DeletedCertificateBundle{
+		Attributes:         bundle.Attributes,
+		CER:                bundle.CER,
+		ContentType:        bundle.ContentType,
+		RecoveryID:         to.Ptr(s.server.URL + "/deletedcertificates/" + name),
+		Tags:               bundle.Tags,
+		DeletedDate:        to.Ptr(c.deleted.deletedDate),
+		ID:                 bundle.ID,
+		KID:                bundle.KID,
+		Policy:             bundle.Policy,
+		SID:                bundle.SID,
+		ScheduledPurgeDate: to.Ptr(c.deleted.deletedDate.Add(RecoverableDays * 24 * time.Hour)),
+		X509Thumbprint:     bundle.X509Thumbprint,
+	}
+}
+
+func (s *Server) defaultPolicy(name string) *azcertificates.CertificatePolicy {
+	return &azcertificates.CertificatePolicy{
+		ID:               to.Ptr(s.server.URL + "/certificates/" + name + "/policy"),
+		IssuerParameters: &azcertificates.IssuerParameters{Name: to.Ptr("Unknown")},
+		KeyProperties:    &azcertificates.KeyProperties{Exportable: to.Ptr(true), ReuseKey: to.Ptr(false)},
+		SecretProperties: &azcertificates.SecretProperties{ContentType: to.Ptr(contentTypePEM)},
+	}
+}
+
+func (s *Server) objectURL(collection string, name string, versionID string) string {
+	url := s.server.URL + "/" + collection + "/" + name
+	if versionID != "" {
+		url += "/" + versionID
+	}
+	return url
+}
+
+// bundle returns a copy of the version with the policy of the certificate
+func (c *certificate) bundle(versionID string) *azcertificates.CertificateBundle {
+	bundle := *c.versions[versionID]
+	attributes := *bundle.Attributes
+	bundle.Attributes = &attributes
+	bundle.Policy = c.policy
+	return &bundle
+}
+
+// mergePolicy returns policy with the sections set in update replaced
+func mergePolicy(policy *azcertificates.CertificatePolicy, update *azcertificates.CertificatePolicy) *azcertificates.CertificatePolicy {
+	merged := *policy
+	if update == nil {
+		return &merged
+	}
+	if update.IssuerParameters != nil {
+		merged.IssuerParameters = update.IssuerParameters
+	}
+	if update.KeyProperties != nil {
+		merged.KeyProperties = update.KeyProperties
+	}
+	if update.LifetimeActions != nil {
+		merged.LifetimeActions = update.LifetimeActions
+	}
+	if update.SecretProperties != nil && update.SecretProperties.ContentType != nil {
+		merged.SecretProperties = update.SecretProperties
+	}
+	if update.X509CertificateProperties != nil {
+		merged.X509CertificateProperties = update.X509CertificateProperties
+	}
+	if update.Attributes != nil {
+		merged.Attributes = update.Attributes
+	}
+	return &merged
+}
+
+// parseCertificate returns the leaf of an imported certificate, checking it comes with its private key like
+// Azure Key Vault does
+func parseCertificate(value string, contentType string, password string) (*x509.Certificate, error) {
+	var leaf *x509.Certificate
+	var key crypto.PrivateKey
+	switch contentType {
+	case contentTypePKCS12:
+		pfx, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, errors.New("the specified PKCS#12 X.509 certificate content is not base64 encoded")
+		}
+		key, leaf, _, err = pkcs12.DecodeChain(pfx, password)
+		if err != nil {
+			return nil, errors.New("the specified PKCS#12 X.509 certificate content can not be read")
+		}
+	case contentTypePEM:
+		rest := []byte(value)
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			switch block.Type {
+			case "CERTIFICATE":
+				if leaf == nil {
+					parsed, err := x509.ParseCertificate(block.Bytes)
+					if err != nil {
+						return nil, errors.New("the specified PEM X.509 certificate content can not be read")
+					}
+					leaf = parsed
+				}
+			case "PRIVATE KEY":
+				parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+				if err != nil {
+					return nil, errors.New("the specified PEM private key is not a PKCS#8 key")
+				}
+				key = parsed
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content type %s", contentType)
+	}
+
+	if leaf == nil || key == nil {
+		return nil, errors.New("the specified X.509 certificate content is in an unexpected format, it must contain the certificate and its private key")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("the specified private key is not supported")
+	}
+	if publicKey, ok := leaf.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !publicKey.Equal(signer.Public()) {
+		return nil, errors.New("the private key does not match the public key of the certificate")
+	}
+	return leaf, nil
+}
+
+func version(segments []string) string {
+	if len(segments) == 3 {
+		return segments[2]
+	}
+	return ""
+}
+
+func newVersion() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func writeNotFound(w http.ResponseWriter, name string) {
+	writeError(w, http.StatusNotFound, "CertificateNotFound", fmt.Sprintf("A certificate with (name/id) %s was not found in this key vault.", name))
+}
+
+func writeError(w http.ResponseWriter, statusCode int, code string, message string) {
+	body := map[string]map[string]string{"error": {"code": code, "message": message}}
+	writeJSON(w, statusCode, body)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
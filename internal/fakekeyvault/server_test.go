@@ -0,0 +1,221 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakekeyvault
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azcertificates"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/welasco/syncsecretakv/internal/certstore/certstoretest"
+)
+
+func importParameters(value string, tags map[string]*string) azcertificates.ImportCertificateParameters {
+	return azcertificates.ImportCertificateParameters{Base64EncodedCertificate: &value, Tags: tags}
+}
+
+func statusCode(err error) int {
+	var responseErr *azcore.ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.StatusCode
+	}
+	return 0
+}
+
+var _ = Describe("Server", func() {
+	var (
+		ctx    context.Context
+		server *Server
+		client *azcertificates.Client
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		server = NewServer()
+		DeferCleanup(server.Close)
+		var err error
+		client, err = server.NewClient()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should import, get, update and list certificates", func() {
+		certificate := certstoretest.SelfSigned("app.example.com")
+		thumbprint := sha1.Sum(certificate.Leaf.Raw)
+
+		imported, err := client.ImportCertificate(ctx, "default-app", importParameters(certificate.Bundle(), map[string]*string{"owner": to.Ptr("default/app")}), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(imported.X509Thumbprint).To(Equal(thumbprint[:]))
+		Expect(imported.ID.Name()).To(Equal("default-app"))
+		Expect(*imported.Attributes.RecoveryLevel).To(Equal(azcertificates.DeletionRecoveryLevelRecoverablePurgeable))
+		Expect(*imported.Policy.SecretProperties.ContentType).To(Equal("application/x-pem-file"))
+
+		got, err := client.GetCertificate(ctx, "default-app", "", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*got.ID).To(Equal(*imported.ID))
+		Expect(got.CER).To(Equal(certificate.Leaf.Raw))
+		Expect(*got.Tags["owner"]).To(Equal("default/app"))
+
+		updated, err := client.UpdateCertificate(ctx, "default-app", "", azcertificates.UpdateCertificateParameters{Tags: map[string]*string{"owner": to.Ptr("other/app")}}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*updated.Tags["owner"]).To(Equal("other/app"))
+
+		policy, err := client.UpdateCertificatePolicy(ctx, "default-app", azcertificates.CertificatePolicy{
+			KeyProperties: &azcertificates.KeyProperties{Exportable: to.Ptr(false)},
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*policy.KeyProperties.Exportable).To(BeFalse())
+
+		for _, name := range []string{"default-api", "default-web"} {
+			_, err := client.ImportCertificate(ctx, name, importParameters(certstoretest.SelfSigned(name+".example.com").Bundle(), nil), nil)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		names := []string{}
+		pages := 0
+		pager := client.NewListCertificatesPager(&azcertificates.ListCertificatesOptions{MaxResults: to.Ptr(int32(2))})
+		for pager.More() {
+			page, err := pager.NextPage(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			pages++
+			for _, item := range page.Value {
+				names = append(names, item.ID.Name())
+			}
+		}
+		Expect(names).To(Equal([]string{"default-api", "default-app", "default-web"}))
+		Expect(pages).To(Equal(2))
+	})
+
+	It("should import PKCS#12 archives and reject keys not matching the certificate", func() {
+		certificate := certstoretest.SelfSigned("app.example.com")
+		pfx, err := pkcs12.Modern.Encode(certificate.Key, certificate.Leaf, nil, "secret")
+		Expect(err).NotTo(HaveOccurred())
+		parameters := importParameters(base64.StdEncoding.EncodeToString(pfx), nil)
+		parameters.Password = to.Ptr("secret")
+		parameters.CertificatePolicy = &azcertificates.CertificatePolicy{
+			SecretProperties: &azcertificates.SecretProperties{ContentType: to.Ptr("application/x-pkcs12")},
+		}
+		imported, err := client.ImportCertificate(ctx, "default-app", parameters, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(imported.CER).To(Equal(certificate.Leaf.Raw))
+
+		mismatched := string(certificate.CertificatePEM) + string(certstoretest.SelfSigned("other.example.com").PrivateKeyPEM)
+		_, err = client.ImportCertificate(ctx, "mismatch", importParameters(mismatched, nil), nil)
+		Expect(statusCode(err)).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should soft delete, recover and purge certificates", func() {
+		value := certstoretest.SelfSigned("app.example.com").Bundle()
+		_, err := client.ImportCertificate(ctx, "default-app", importParameters(value, nil), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		deleted, err := client.DeleteCertificate(ctx, "default-app", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deleted.RecoveryID).NotTo(BeNil())
+		Expect(server.IsDeleted("default-app")).To(BeTrue())
+		_, err = client.GetCertificate(ctx, "default-app", "", nil)
+		Expect(statusCode(err)).To(Equal(http.StatusNotFound))
+		_, err = client.ImportCertificate(ctx, "default-app", importParameters(value, nil), nil)
+		Expect(statusCode(err)).To(Equal(http.StatusConflict))
+
+		_, err = client.GetDeletedCertificate(ctx, "default-app", nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.RecoverDeletedCertificate(ctx, "default-app", nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, ok := server.Certificate("default-app")
+		Expect(ok).To(BeTrue())
+
+		_, err = client.DeleteCertificate(ctx, "default-app", nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.PurgeDeletedCertificate(ctx, "default-app", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.IsDeleted("default-app")).To(BeFalse())
+		_, err = client.GetDeletedCertificate(ctx, "default-app", nil)
+		Expect(statusCode(err)).To(Equal(http.StatusNotFound))
+		_, err = client.PurgeDeletedCertificate(ctx, "default-app", nil)
+		Expect(statusCode(err)).To(Equal(http.StatusNotFound))
+	})
+
+	It("should conflict on purge until the deletion completed", func() {
+		server.DeletionDelay = time.Hour
+		value := certstoretest.SelfSigned("app.example.com").Bundle()
+		_, err := client.ImportCertificate(ctx, "default-app", importParameters(value, nil), nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.DeleteCertificate(ctx, "default-app", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.GetDeletedCertificate(ctx, "default-app", nil)
+		Expect(statusCode(err)).To(Equal(http.StatusNotFound))
+		_, err = client.PurgeDeletedCertificate(ctx, "default-app", nil)
+		Expect(statusCode(err)).To(Equal(http.StatusConflict))
+		_, err = client.RecoverDeletedCertificate(ctx, "default-app", nil)
+		Expect(statusCode(err)).To(Equal(http.StatusConflict))
+	})
+
+	It("should throttle and fail requests on demand", func() {
+		server.Throttle(1, 3*time.Second)
+		_, err := client.GetCertificate(ctx, "default-app", "", nil)
+		var responseErr *azcore.ResponseError
+		Expect(errors.As(err, &responseErr)).To(BeTrue())
+		Expect(responseErr.StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(responseErr.ErrorCode).To(Equal("Throttled"))
+		Expect(responseErr.RawResponse.Header.Get("Retry-After")).To(Equal("3"))
+
+		server.FailNext(1, Fault{StatusCode: http.StatusServiceUnavailable, Code: "ServiceUnavailable"})
+		_, err = client.GetCertificate(ctx, "default-app", "", nil)
+		Expect(statusCode(err)).To(Equal(http.StatusServiceUnavailable))
+
+		_, err = client.GetCertificate(ctx, "default-app", "", nil)
+		Expect(statusCode(err)).To(Equal(http.StatusNotFound))
+		Expect(server.Requests()).To(Equal([]string{
+			"GET /certificates/default-app/",
+			"GET /certificates/default-app/",
+			"GET /certificates/default-app/",
+		}))
+	})
+
+	It("should only fail the requests matching the fault", func() {
+		server.FailNext(1, Fault{StatusCode: http.StatusServiceUnavailable, Code: "ServiceUnavailable", Method: http.MethodDelete, PathPrefix: "/deletedcertificates/"})
+		_, err := client.GetCertificate(ctx, "default-app", "", nil)
+		Expect(statusCode(err)).To(Equal(http.StatusNotFound))
+		_, err = client.PurgeDeletedCertificate(ctx, "default-app", nil)
+		Expect(statusCode(err)).To(Equal(http.StatusServiceUnavailable))
+		_, err = client.PurgeDeletedCertificate(ctx, "default-app", nil)
+		Expect(statusCode(err)).To(Equal(http.StatusNotFound))
+	})
+
+	It("should refuse tokens it did not issue", func() {
+		wrongToken, err := azcertificates.NewClient(server.URL(), Credential{Token: "stolen"}, server.ClientOptions())
+		Expect(err).NotTo(HaveOccurred())
+		_, err = wrongToken.GetCertificate(ctx, "default-app", "", nil)
+		Expect(statusCode(err)).To(Equal(http.StatusUnauthorized))
+
+		noToken, err := azcertificates.NewClient(server.URL(), Credential{Err: errors.New("no credential")}, server.ClientOptions())
+		Expect(err).NotTo(HaveOccurred())
+		_, err = noToken.GetCertificate(ctx, "default-app", "", nil)
+		Expect(err).To(MatchError(ContainSubstring("no credential")))
+		Expect(server.Requests()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,145 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "syncsecretakv"
+
+// Results of an Azure Key Vault operation
+const (
+	ResultSuccess  = "success"
+	ResultNotFound = "not_found"
+	ResultError    = "error"
+)
+
+var (
+	// KeyVaultOperations counts Azure Key Vault operations by vault, operation and result
+	KeyVaultOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "keyvault_operations_total",
+		Help:      "Number of Azure Key Vault operations by vault, operation and result.",
+	}, []string{"vault", "operation", "result"})
+
+	// KeyVaultOperationDuration observes the latency of Azure Key Vault operations by vault, operation and result
+	KeyVaultOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "keyvault_operation_duration_seconds",
+		Help:      "Latency of Azure Key Vault operations by vault, operation and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"vault", "operation", "result"})
+
+	// SecretsBySyncState counts the synced Secrets by sync state for each Config
+	SecretsBySyncState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "secrets",
+		Help:      "Number of Secrets tracked by a SyncSecretAKV by Config and sync state.",
+	}, []string{"config", "state"})
+
+	// OrphanedCertificates is the number of certificates owned by this cluster whose Secret no longer exists
+	OrphanedCertificates = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "orphaned_certificates",
+		Help:      "Number of Azure Key Vault certificates owned by this cluster without a matching SyncSecretAKV.",
+	}, []string{"vault"})
+
+	// CertificateExpiry reports the seconds until expiry of every synced certificate
+	CertificateExpiry = newExpiryCollector()
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		KeyVaultOperations,
+		KeyVaultOperationDuration,
+		SecretsBySyncState,
+		OrphanedCertificates,
+		CertificateExpiry,
+	)
+}
+
+// ObserveOperation records an Azure Key Vault operation that started at start
+func ObserveOperation(vault string, operation string, result string, start time.Time) {
+	KeyVaultOperations.WithLabelValues(vault, operation, result).Inc()
+	KeyVaultOperationDuration.WithLabelValues(vault, operation, result).Observe(time.Since(start).Seconds())
+}
+
+type certificateKey struct {
+	namespace string
+	name      string
+}
+
+type certificateExpiry struct {
+	vault    string
+	notAfter time.Time
+}
+
+// ExpiryCollector exports the seconds until expiry of the synced certificates. The value is computed at
+// scrape time from the certificate notAfter, so it keeps counting down between reconciliations.
+type ExpiryCollector struct {
+	desc *prometheus.Desc
+	now  func() time.Time
+
+	mu           sync.Mutex
+	certificates map[certificateKey]certificateExpiry
+}
+
+func newExpiryCollector() *ExpiryCollector {
+	return &ExpiryCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "certificate_expiry_seconds"),
+			"Seconds until the synced certificate expires, negative once expired.",
+			[]string{"namespace", "name", "vault"}, nil,
+		),
+		now:          time.Now,
+		certificates: map[certificateKey]certificateExpiry{},
+	}
+}
+
+// Set records the expiry of the certificate synced from the Secret
+func (c *ExpiryCollector) Set(namespace string, name string, vault string, notAfter time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.certificates[certificateKey{namespace: namespace, name: name}] = certificateExpiry{vault: vault, notAfter: notAfter}
+}
+
+// Delete stops reporting the certificate synced from the Secret
+func (c *ExpiryCollector) Delete(namespace string, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.certificates, certificateKey{namespace: namespace, name: name})
+}
+
+// Describe implements prometheus.Collector
+func (c *ExpiryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector
+func (c *ExpiryCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for key, expiry := range c.certificates {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, expiry.notAfter.Sub(now).Seconds(), key.namespace, key.name, expiry.vault)
+	}
+}
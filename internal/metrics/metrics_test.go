@@ -0,0 +1,52 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("Metrics", func() {
+	It("should count Azure Key Vault operations by vault, operation and result", func() {
+		ObserveOperation("https://test.vault.azure.net/", "ImportCertificate", ResultSuccess, time.Now())
+		ObserveOperation("https://test.vault.azure.net/", "ImportCertificate", ResultSuccess, time.Now())
+		ObserveOperation("https://test.vault.azure.net/", "ImportCertificate", ResultError, time.Now())
+
+		Expect(testutil.ToFloat64(KeyVaultOperations.WithLabelValues("https://test.vault.azure.net/", "ImportCertificate", ResultSuccess))).To(Equal(2.0))
+		Expect(testutil.ToFloat64(KeyVaultOperations.WithLabelValues("https://test.vault.azure.net/", "ImportCertificate", ResultError))).To(Equal(1.0))
+	})
+
+	It("should report the seconds until expiry at scrape time", func() {
+		collector := newExpiryCollector()
+		now := time.Now()
+		collector.now = func() time.Time { return now }
+
+		collector.Set("default", "app-tls", "https://test.vault.azure.net/", now.Add(time.Hour))
+		Expect(testutil.CollectAndCount(collector)).To(Equal(1))
+		Expect(testutil.ToFloat64(collector)).To(Equal(3600.0))
+
+		now = now.Add(2 * time.Hour)
+		Expect(testutil.ToFloat64(collector)).To(Equal(-3600.0))
+
+		collector.Delete("default", "app-tls")
+		Expect(testutil.CollectAndCount(collector)).To(BeZero())
+	})
+})
@@ -0,0 +1,176 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"golang.org/x/time/rate"
+)
+
+// Defaults for the per-vault token bucket, well below the Azure Key Vault service limits
+const (
+	DefaultQPS   = 10
+	DefaultBurst = 20
+)
+
+// VaultLimiter is the token bucket of a single Azure Key Vault. After a 429 response it also holds every
+// request to the vault until the Retry-After delay has passed.
+type VaultLimiter struct {
+	limiter *rate.Limiter
+	now     func() time.Time
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+// Wait blocks until the vault accepts another request or the context is done
+func (l *VaultLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	pause := l.pausedUntil.Sub(l.now())
+	l.mu.Unlock()
+
+	if pause > 0 {
+		timer := time.NewTimer(pause)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return l.limiter.Wait(ctx)
+}
+
+// PauseFor holds requests to the vault for the given duration, extending any pause already in place
+func (l *VaultLimiter) PauseFor(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := l.now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// Registry hands out one VaultLimiter per vault URL so every reconciler talking to a vault shares its budget
+type Registry struct {
+	mu       sync.Mutex
+	qps      rate.Limit
+	burst    int
+	limiters map[string]*VaultLimiter
+}
+
+// NewRegistry returns a Registry whose limiters allow qps requests per second with the given burst
+func NewRegistry(qps float64, burst int) *Registry {
+	return &Registry{qps: rate.Limit(qps), burst: burst, limiters: map[string]*VaultLimiter{}}
+}
+
+// Vaults is the Registry shared by all reconcilers of the manager
+var Vaults = NewRegistry(DefaultQPS, DefaultBurst)
+
+// Configure changes the rate of the limiters handed out by the Registry, including existing ones
+func (r *Registry) Configure(qps float64, burst int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.qps = rate.Limit(qps)
+	r.burst = burst
+	for _, limiter := range r.limiters {
+		limiter.limiter.SetLimit(r.qps)
+		limiter.limiter.SetBurst(r.burst)
+	}
+}
+
+// For returns the limiter of the vault
+func (r *Registry) For(vaultURL string) *VaultLimiter {
+	key := strings.TrimSuffix(strings.ToLower(vaultURL), "/")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	limiter, ok := r.limiters[key]
+	if !ok {
+		limiter = &VaultLimiter{limiter: rate.NewLimiter(r.qps, r.burst), now: time.Now}
+		r.limiters[key] = limiter
+	}
+	return limiter
+}
+
+// Policy returns an azcore pipeline policy that waits for the vault limiter before every attempt,
+// including the SDK retries, and pauses the vault when Azure Key Vault answers 429 with a Retry-After
+func Policy(limiter *VaultLimiter) policy.Policy {
+	return vaultPolicy{limiter: limiter}
+}
+
+type vaultPolicy struct {
+	limiter *VaultLimiter
+}
+
+func (p vaultPolicy) Do(req *policy.Request) (*http.Response, error) {
+	if err := p.limiter.Wait(req.Raw().Context()); err != nil {
+		return nil, err
+	}
+	resp, err := req.Next()
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		if delay, ok := RetryAfter(resp); ok {
+			p.limiter.PauseFor(delay)
+		}
+	}
+	return resp, err
+}
+
+// RetryAfter reads the delay requested by a throttled response from the retry-after-ms, x-ms-retry-after-ms
+// or Retry-After headers
+func RetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	for _, header := range []string{"retry-after-ms", "x-ms-retry-after-ms"} {
+		if value := resp.Header.Get(header); value != "" {
+			if ms, err := strconv.ParseInt(value, 10, 64); err == nil && ms > 0 {
+				return time.Duration(ms) * time.Millisecond, true
+			}
+		}
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, seconds > 0
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		return delay, delay > 0
+	}
+	return 0, false
+}
+
+// RetryAfterFromError returns the Retry-After delay of a throttled Azure Key Vault error
+func RetryAfterFromError(err error) (time.Duration, bool) {
+	var responseErr *azcore.ResponseError
+	if !errors.As(err, &responseErr) || responseErr.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	return RetryAfter(responseErr.RawResponse)
+}
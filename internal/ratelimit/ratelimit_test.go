@@ -0,0 +1,117 @@
+/*
+Copyright 2024 welasco.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RetryAfter", func() {
+	response := func(header string, value string) *http.Response {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Set(header, value)
+		return resp
+	}
+
+	It("should read the delay in milliseconds, seconds or as a date", func() {
+		delay, ok := RetryAfter(response("retry-after-ms", "1500"))
+		Expect(ok).To(BeTrue())
+		Expect(delay).To(Equal(1500 * time.Millisecond))
+
+		delay, ok = RetryAfter(response("Retry-After", "7"))
+		Expect(ok).To(BeTrue())
+		Expect(delay).To(Equal(7 * time.Second))
+
+		delay, ok = RetryAfter(response("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)))
+		Expect(ok).To(BeTrue())
+		Expect(delay).To(BeNumerically("~", time.Minute, 2*time.Second))
+	})
+
+	It("should ignore missing or invalid headers", func() {
+		_, ok := RetryAfter(&http.Response{Header: http.Header{}})
+		Expect(ok).To(BeFalse())
+		_, ok = RetryAfter(response("Retry-After", "soon"))
+		Expect(ok).To(BeFalse())
+		_, ok = RetryAfter(nil)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should only read the delay of throttled errors", func() {
+		throttled := &azcore.ResponseError{StatusCode: http.StatusTooManyRequests, RawResponse: response("Retry-After", "3")}
+		delay, ok := RetryAfterFromError(fmt.Errorf("import failed: %w", throttled))
+		Expect(ok).To(BeTrue())
+		Expect(delay).To(Equal(3 * time.Second))
+
+		unavailable := &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable, RawResponse: response("Retry-After", "3")}
+		_, ok = RetryAfterFromError(unavailable)
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("Registry", func() {
+	It("should share one limiter per vault", func() {
+		registry := NewRegistry(1, 1)
+		Expect(registry.For("https://vault.vault.azure.net/")).To(BeIdenticalTo(registry.For("https://VAULT.vault.azure.net")))
+		Expect(registry.For("https://vault.vault.azure.net")).NotTo(BeIdenticalTo(registry.For("https://other.vault.azure.net")))
+	})
+
+	It("should hold requests while the vault is paused", func() {
+		limiter := NewRegistry(1000, 10).For("https://vault.vault.azure.net")
+		limiter.PauseFor(time.Hour)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		Expect(limiter.Wait(ctx)).To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("should pause the vault when a request is throttled", func() {
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		limiter := NewRegistry(1000, 10).For(server.URL)
+		pipeline := runtime.NewPipeline("test", "v0.0.0", runtime.PipelineOptions{}, &policy.ClientOptions{
+			PerRetryPolicies: []policy.Policy{Policy(limiter)},
+			Retry:            policy.RetryOptions{MaxRetries: -1},
+		})
+		req, err := runtime.NewRequest(context.Background(), http.MethodGet, server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := pipeline.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(requests.Load()).To(Equal(int32(1)))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		Expect(limiter.Wait(ctx)).To(MatchError(context.DeadlineExceeded))
+	})
+})